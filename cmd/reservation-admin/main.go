@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/backup"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/migrations"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/reservation"
+)
+
+// reservation-admin performs maintenance of the reservation database, it
+// connects using the same RESERVATION_API_MONGODB_* variables as the service
+func main() {
+    if len(os.Args) < 2 {
+        usage()
+        os.Exit(2)
+    }
+
+    var err error
+    switch os.Args[1] {
+    case "export":
+        err = export(context.Background(), os.Args[2:])
+    case "restore":
+        err = restore(context.Background(), os.Args[2:])
+    default:
+        usage()
+        os.Exit(2)
+    }
+    if err != nil {
+        log.Fatalf("%v failed: %v", os.Args[1], err)
+    }
+}
+
+func usage() {
+    fmt.Fprintf(os.Stderr, "Usage: %v export [-o FILE]\n", os.Args[0])
+    fmt.Fprintf(os.Stderr, "       %v restore [-conflict skip|overwrite|fail] [-dry-run] FILE\n", os.Args[0])
+}
+
+// export writes ambulances, patients and reservations to the archive
+func export(ctx context.Context, args []string) error {
+    flags := flag.NewFlagSet("export", flag.ExitOnError)
+    output := flags.String("o", "-", "archive file, - writes to standard output")
+    flags.Parse(args)
+
+    dbs := newDatabases()
+    defer dbs.Disconnect(ctx)
+
+    migrator := db_service.NewMongoMigrator(db_service.MongoServiceConfig{})
+    defer migrator.Disconnect(ctx)
+    applied, err := migrator.AppliedMigrations(ctx)
+    if err != nil {
+        return err
+    }
+    schemaVersion := 0
+    if len(applied) > 0 {
+        schemaVersion = applied[len(applied)-1].Version
+    }
+
+    archive, err := backup.Export(ctx, dbs, schemaVersion)
+    if err != nil {
+        return err
+    }
+
+    var writer io.Writer = os.Stdout
+    if *output != "-" {
+        file, err := os.Create(*output)
+        if err != nil {
+            return err
+        }
+        defer file.Close()
+        writer = file
+    }
+    if err := archive.Write(writer, backup.Collections); err != nil {
+        return err
+    }
+
+    for _, collection := range backup.Collections {
+        log.Printf("Exported %v %v document(s)", archive.Header.Collections[collection], collection)
+    }
+    return nil
+}
+
+// restore checks the archive and writes its documents to the database
+func restore(ctx context.Context, args []string) error {
+    flags := flag.NewFlagSet("restore", flag.ExitOnError)
+    conflict := flags.String("conflict", string(backup.ConflictFail), "policy for documents already stored: skip, overwrite or fail")
+    dryRun := flags.Bool("dry-run", false, "check the archive and report the changes without writing them")
+    flags.Parse(args)
+    if flags.NArg() != 1 {
+        usage()
+        os.Exit(2)
+    }
+
+    policy, err := backup.ParseConflictPolicy(*conflict)
+    if err != nil {
+        return err
+    }
+
+    var reader io.Reader = os.Stdin
+    if path := flags.Arg(0); path != "-" {
+        file, err := os.Open(path)
+        if err != nil {
+            return err
+        }
+        defer file.Close()
+        reader = file
+    }
+    archive, err := backup.Read(reader)
+    if err != nil {
+        return err
+    }
+
+    latestVersion := 0
+    for _, migration := range migrations.All {
+        latestVersion = max(latestVersion, migration.Version)
+    }
+    if archive.Header.SchemaVersion > latestVersion {
+        return fmt.Errorf("archive schema version %v is newer than %v supported by this binary", archive.Header.SchemaVersion, latestVersion)
+    }
+
+    dbs := newDatabases()
+    defer dbs.Disconnect(ctx)
+
+    migrator := db_service.NewMongoMigrator(db_service.MongoServiceConfig{})
+    defer migrator.Disconnect(ctx)
+    if !*dryRun {
+        // the restored collections need their indexes, e.g. an empty environment
+        if _, err := migrator.Migrate(ctx, migrations.All); err != nil {
+            return err
+        }
+    }
+
+    results, err := backup.Restore(ctx, dbs, archive, policy, *dryRun)
+    for _, collection := range backup.Collections {
+        if result, ok := results[collection]; ok {
+            log.Printf("%v: %v created, %v overwritten, %v skipped", collection, result.Created, result.Overwritten, result.Skipped)
+        }
+    }
+    if err != nil {
+        return err
+    }
+
+    // documents of older archives miss the changes of newer data migrations,
+    // migrations are idempotent so they are applied again
+    newer := []db_service.Migration{}
+    for _, migration := range migrations.All {
+        if migration.Version > archive.Header.SchemaVersion {
+            newer = append(newer, migration)
+        }
+    }
+    if *dryRun {
+        if len(newer) > 0 {
+            log.Printf("Dry run, %v newer migration(s) would be applied again", len(newer))
+        }
+        return nil
+    }
+    return migrator.Rerun(ctx, newer)
+}
+
+func newDatabases() backup.Databases {
+    // services share one client, see db_service.NewMongoService
+    return backup.Databases{
+        AmbulanceDB: db_service.NewMongoService[reservation.Ambulance](db_service.MongoServiceConfig{
+            Collection: backup.CollectionAmbulance,
+        }),
+        PatientDB: db_service.NewMongoService[reservation.Patient](db_service.MongoServiceConfig{
+            Collection: backup.CollectionPatient,
+        }),
+        StaffDB: db_service.NewMongoService[reservation.Staff](db_service.MongoServiceConfig{
+            Collection: backup.CollectionStaff,
+        }),
+        ReservationSeriesDB: db_service.NewMongoService[reservation.ReservationSeries](db_service.MongoServiceConfig{
+            Collection: backup.CollectionReservationSeries,
+        }),
+        ReservationDB: db_service.NewMongoService[reservation.ReservationInput](db_service.MongoServiceConfig{
+            Collection: backup.CollectionReservation,
+        }),
+        Transactor: db_service.NewMongoTransactor(db_service.MongoServiceConfig{}),
+    }
+}
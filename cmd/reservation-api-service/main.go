@@ -2,21 +2,52 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/api"
 	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/hl7"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/idempotency"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/migrations"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/notification"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/ratelimit"
 	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/reservation"
 
 	"time"
+	// ambulance time zones are loaded in the scratch image without zoneinfo
+	_ "time/tzdata"
 
 	"github.com/gin-contrib/cors"
 )
 
 func main() {
+    if len(os.Args) > 1 && os.Args[1] == "migrate" {
+        if err := migrate(context.Background()); err != nil {
+            log.Fatalf("Migration failed: %v", err)
+        }
+        return
+    }
+
+    if len(os.Args) > 1 && os.Args[1] == "import-patients" {
+        if err := importPatients(context.Background(), os.Args[2:]); err != nil {
+            log.Fatalf("Import failed: %v", err)
+        }
+        return
+    }
+
+    if !strings.EqualFold(os.Getenv("RESERVATION_API_MONGODB_MIGRATE"), "false") {
+        if err := migrate(context.Background()); err != nil {
+            log.Fatalf("Migration failed: %v", err)
+        }
+    }
+
     log.Printf("Server started")
     port := os.Getenv("RESERVATION_API_PORT")
     if port == "" {
@@ -32,13 +63,39 @@ func main() {
 		    corsMiddleware := cors.New(cors.Config{
         AllowOrigins:     []string{"*"},
         AllowMethods:     []string{"GET", "PUT", "POST", "DELETE", "PATCH"},
-        AllowHeaders:     []string{"Origin", "Authorization", "Content-Type"},
-        ExposeHeaders:    []string{""},
+        AllowHeaders:     []string{"Origin", "Authorization", "Content-Type", "Idempotency-Key"},
+        ExposeHeaders:    []string{"X-Total-Count", "Retry-After", "Idempotent-Replayed"},
         AllowCredentials: false,
         MaxAge: 12 * time.Hour,
     })
     engine.Use(corsMiddleware)
 
+    // client IP is taken from X-Forwarded-For only when sent by the trusted proxies
+    if proxies := os.Getenv("RESERVATION_API_TRUSTED_PROXIES"); proxies != "" {
+        if err := engine.SetTrustedProxies(strings.Split(proxies, ",")); err != nil {
+            log.Fatalf("Invalid RESERVATION_API_TRUSTED_PROXIES: %v", err)
+        }
+    }
+    limiter, err := newRateLimiter()
+    if err != nil {
+        log.Fatalf("Invalid rate limit configuration: %v", err)
+    }
+    engine.Use(limiter.Middleware())
+
+    idempotencyTTL, err := time.ParseDuration(envOrDefault("RESERVATION_API_IDEMPOTENCY_TTL", "24h"))
+    if err != nil || idempotencyTTL <= 0 {
+        log.Fatalf("Invalid RESERVATION_API_IDEMPOTENCY_TTL: %v", err)
+    }
+    idempotencyKeys := &idempotency.Middleware{
+        RecordDB: db_service.NewMongoService[idempotency.Record](db_service.MongoServiceConfig{
+            Collection: "idempotency_key",
+        }),
+        TTL:         idempotencyTTL,
+        LockTimeout: time.Minute,
+        Identity:    limiter.Identity,
+    }
+    engine.Use(idempotencyKeys.Handler())
+
 	// setup context update  middleware
     dbServiceAmbulance := db_service.NewMongoService[reservation.Ambulance](db_service.MongoServiceConfig{
         Collection: "ambulance",
@@ -49,17 +106,271 @@ func main() {
     dbServiceReservation := db_service.NewMongoService[reservation.ReservationInput](db_service.MongoServiceConfig{
         Collection: "reservation",
     })
-    defer dbServiceAmbulance.Disconnect(context.Background())
+    dbServiceStaff := db_service.NewMongoService[reservation.Staff](db_service.MongoServiceConfig{
+        Collection: "staff",
+    })
+    // services share one client, so the transactor can span all collections
+    dbTransactor := db_service.NewMongoTransactor(db_service.MongoServiceConfig{})
+    // checks the topology at startup, so the transaction mode is logged before
+    // the first booking
+    if err := dbTransactor.WithTransaction(context.Background(), func(ctx context.Context) error { return nil }); err == db_service.ErrTransactionsUnsupported {
+        log.Fatalf("Transactions unavailable: %v", err)
+    } else if err != nil {
+        log.Printf("Cannot check MongoDB transactions: %v", err)
+    }
+    notifier, err := notification.NewNotifierFromEnv()
+    if err != nil {
+        log.Fatalf("Invalid notification configuration: %v", err)
+    }
+    dbServiceReminder := db_service.NewMongoService[reservation.ReminderRecord](db_service.MongoServiceConfig{
+        Collection: "reminder",
+    })
+    reminderOffsets, err := reservation.ParseReminderOffsets(envOrDefault("RESERVATION_API_REMINDER_OFFSETS", "24h,2h"))
+    if err != nil {
+        log.Fatalf("Invalid RESERVATION_API_REMINDER_OFFSETS: %v", err)
+    }
+    reminderInterval, err := time.ParseDuration(envOrDefault("RESERVATION_API_REMINDER_INTERVAL", "1m"))
+    if err != nil || reminderInterval <= 0 {
+        log.Fatalf("Invalid RESERVATION_API_REMINDER_INTERVAL: %v", err)
+    }
+    reminderScheduler := &reservation.ReminderScheduler{
+        ReservationDB: dbServiceReservation,
+        PatientDB:     dbServicePatient,
+        AmbulanceDB:   dbServiceAmbulance,
+        ReminderDB:    dbServiceReminder,
+        Notifier:      notifier,
+        Offsets:       reminderOffsets,
+        Interval:      reminderInterval,
+    }
+    go reminderScheduler.Run(context.Background())
+
+    hl7Outbox := &reservation.Hl7Outbox{
+        OutboxDB: db_service.NewMongoService[reservation.Hl7Message](db_service.MongoServiceConfig{
+            Collection: "hl7_outbox",
+        }),
+        Header: hl7.Header{
+            SendingApplication:   "RESERVATION_API",
+            SendingFacility:      envOrDefault("RESERVATION_API_HL7_SENDING_FACILITY", "RESERVATION"),
+            ReceivingApplication: envOrDefault("RESERVATION_API_HL7_RECEIVING_APPLICATION", "RIS"),
+            ReceivingFacility:    os.Getenv("RESERVATION_API_HL7_RECEIVING_FACILITY"),
+            ProcessingId:         envOrDefault("RESERVATION_API_HL7_PROCESSING_ID", "P"),
+        },
+        MaxAttempts: 10,
+    }
+    // messages are only available through the pull endpoint unless the MLLP listener is configured
+    if address := os.Getenv("RESERVATION_API_HL7_MLLP_ADDRESS"); address != "" {
+        hl7Outbox.Sender = hl7.NewMLLPSender(address, 30*time.Second)
+    }
+    go hl7Outbox.Run(context.Background(), time.Minute)
+
+    webhookBackoff, err := time.ParseDuration(envOrDefault("RESERVATION_API_WEBHOOK_BACKOFF", "30s"))
+    if err != nil || webhookBackoff <= 0 {
+        log.Fatalf("Invalid RESERVATION_API_WEBHOOK_BACKOFF: %v", err)
+    }
+    webhooks := &reservation.WebhookDispatcher{
+        WebhookDB: db_service.NewMongoService[reservation.WebhookRecord](db_service.MongoServiceConfig{
+            Collection: "webhook",
+        }),
+        DeliveryDB: db_service.NewMongoService[reservation.WebhookDelivery](db_service.MongoServiceConfig{
+            Collection: "webhook_delivery",
+        }),
+        Client:      &http.Client{Timeout: 10 * time.Second},
+        MaxAttempts: 8,
+        Backoff:     webhookBackoff,
+        MaxBackoff:  6 * time.Hour,
+    }
+    go webhooks.Run(context.Background(), 10*time.Second)
+
+    offerTTL, err := time.ParseDuration(envOrDefault("RESERVATION_API_WAITLIST_OFFER_TTL", "2h"))
+    if err != nil || offerTTL <= 0 {
+        log.Fatalf("Invalid RESERVATION_API_WAITLIST_OFFER_TTL: %v", err)
+    }
+    waitlist := &reservation.WaitlistService{
+        WaitlistDB: db_service.NewMongoService[reservation.WaitlistEntry](db_service.MongoServiceConfig{
+            Collection: "waitlist",
+        }),
+        ReservationDB: dbServiceReservation,
+        PatientDB:     dbServicePatient,
+        AmbulanceDB:   dbServiceAmbulance,
+        StaffDB:       dbServiceStaff,
+        Transactor:    dbTransactor,
+        Notifier:      notifier,
+        OfferTTL:      offerTTL,
+        Outbox:        hl7Outbox,
+        Webhooks:      webhooks,
+    }
+    go waitlist.Run(context.Background(), time.Minute)
+
+    dbServiceReservationSeries := db_service.NewMongoService[reservation.ReservationSeries](db_service.MongoServiceConfig{
+        Collection: "reservation_series",
+    })
+    dbServiceCalendarFeed := db_service.NewMongoService[reservation.CalendarFeedRecord](db_service.MongoServiceConfig{
+        Collection: "calendar_feed",
+    })
     engine.Use(func(ctx *gin.Context) {
         ctx.Set("db_service_ambulance", dbServiceAmbulance)
         ctx.Set("db_service_patient", dbServicePatient)
         ctx.Set("db_service_reservation", dbServiceReservation)
+        ctx.Set("db_service_reservation_series", dbServiceReservationSeries)
+        ctx.Set("db_service_staff", dbServiceStaff)
+        ctx.Set("db_service_waitlist", waitlist.WaitlistDB)
+        ctx.Set("db_service_calendar_feed", dbServiceCalendarFeed)
+        ctx.Set("db_transactor", dbTransactor)
+        ctx.Set("notifier", notifier)
+        ctx.Set("waitlist", waitlist)
+        ctx.Set("db_service_hl7_message", hl7Outbox.OutboxDB)
+        ctx.Set("hl7_outbox", hl7Outbox)
+        ctx.Set("db_service_webhook", webhooks.WebhookDB)
+        ctx.Set("db_service_webhook_delivery", webhooks.DeliveryDB)
+        ctx.Set("webhooks", webhooks)
         ctx.Next()
     })
 
+    // the services share one client, it is closed when the last of them disconnects
+    defer func() {
+        services := []interface{ Disconnect(ctx context.Context) error }{
+            idempotencyKeys.RecordDB, dbServiceAmbulance, dbServicePatient, dbServiceReservation,
+            dbServiceStaff, dbServiceReminder, hl7Outbox.OutboxDB, webhooks.WebhookDB, webhooks.DeliveryDB,
+            waitlist.WaitlistDB, dbServiceReservationSeries, dbServiceCalendarFeed, dbTransactor,
+        }
+        if store, ok := limiter.Store.(*ratelimit.MongoStore); ok {
+            services = append(services, store.BucketDB)
+        }
+        for _, service := range services {
+            if err := service.Disconnect(context.Background()); err != nil {
+                log.Printf("Failed to disconnect from MongoDB: %v", err)
+            }
+        }
+    }()
+
     // request routings
 		reservation.AddRoutes(engine)
+    reservation.AddFhirRoutes(engine)
 
     engine.GET("/openapi", api.HandleOpenApi)
     engine.Run(":" + port)
-}
\ No newline at end of file
+}
+
+// newRateLimiter configures limits of the route groups, the expensive
+// examination search and patient import have their own groups
+func newRateLimiter() (*ratelimit.Limiter, error) {
+    limits, err := ratelimit.ParseLimits(envOrDefault("RESERVATION_API_RATE_LIMITS", "default=600/1m,examination=10/1m,import=10/1h"))
+    if err != nil {
+        return nil, err
+    }
+
+    var store ratelimit.Store
+    switch storeName := envOrDefault("RESERVATION_API_RATE_LIMIT_STORE", "memory"); storeName {
+    case "memory":
+        store = ratelimit.NewMemoryStore()
+    case "mongo":
+        // shared by all replicas
+        store = &ratelimit.MongoStore{
+            BucketDB: db_service.NewMongoService[ratelimit.Bucket](db_service.MongoServiceConfig{
+                Collection: "rate_limit",
+            }),
+        }
+    default:
+        return nil, fmt.Errorf("unknown RESERVATION_API_RATE_LIMIT_STORE %q, use memory or mongo", storeName)
+    }
+
+    apiKeys := map[string]bool{}
+    for _, apiKey := range strings.Split(os.Getenv("RESERVATION_API_RATE_LIMIT_API_KEYS"), ",") {
+        if apiKey = strings.TrimSpace(apiKey); apiKey != "" {
+            apiKeys[apiKey] = true
+        }
+    }
+
+    return &ratelimit.Limiter{
+        Store:  store,
+        Limits: limits,
+        Routes: []ratelimit.Route{
+            {Method: http.MethodPost, Path: "/api/patients/:patientId/request-examination", Group: "examination"},
+            {Method: http.MethodPost, Path: "/api/patients/import", Group: "import"},
+        },
+        Identity: &ratelimit.Identity{
+            UserHeader:   os.Getenv("RESERVATION_API_RATE_LIMIT_USER_HEADER"),
+            APIKeyHeader: envOrDefault("RESERVATION_API_RATE_LIMIT_API_KEY_HEADER", "X-API-Key"),
+            APIKeys:      apiKeys,
+        },
+    }, nil
+}
+
+// envOrDefault returns value of the environment variable or the default when not set
+func envOrDefault(name string, defaultValue string) string {
+    if value, ok := os.LookupEnv(name); ok {
+        return value
+    }
+    return defaultValue
+}
+
+// migrate applies pending database migrations, see internal/migrations
+func migrate(ctx context.Context) error {
+    migrator := db_service.NewMongoMigrator(db_service.MongoServiceConfig{})
+    defer migrator.Disconnect(ctx)
+
+    applied, err := migrator.Migrate(ctx, migrations.All)
+    if err != nil {
+        return err
+    }
+    log.Printf("Applied %v migration(s)", len(applied))
+    return nil
+}
+
+// importPatients creates patients from the CSV or JSON Lines file, the format
+// is derived from the file extension unless -format is given
+func importPatients(ctx context.Context, args []string) error {
+    flags := flag.NewFlagSet("import-patients", flag.ExitOnError)
+    dryRun := flags.Bool("dry-run", false, "validate the rows and detect duplicates without creating patients")
+    formatName := flags.String("format", "", "csv or jsonl, derived from the file extension by default")
+    flags.Usage = func() {
+        fmt.Fprintf(flags.Output(), "Usage: %v import-patients [-dry-run] [-format csv|jsonl] FILE\n", os.Args[0])
+        flags.PrintDefaults()
+    }
+    flags.Parse(args)
+    if flags.NArg() != 1 {
+        flags.Usage()
+        os.Exit(2)
+    }
+
+    path := flags.Arg(0)
+    if *formatName == "" {
+        *formatName = filepath.Ext(path)
+    }
+    format, ok := reservation.PatientImportFormat(*formatName)
+    if !ok {
+        return fmt.Errorf("unsupported format %q, use -format csv or -format jsonl", *formatName)
+    }
+
+    file, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    dbServicePatient := db_service.NewMongoService[reservation.Patient](db_service.MongoServiceConfig{
+        Collection: "patient",
+    })
+    defer dbServicePatient.Disconnect(ctx)
+
+    importer := &reservation.PatientImporter{PatientDB: dbServicePatient}
+    report, err := importer.Import(ctx, file, format, *dryRun)
+    if err != nil {
+        return err
+    }
+
+    for _, row := range report.Rows {
+        switch row.Status {
+        case reservation.INVALID:
+            log.Printf("Line %v: invalid: %v", row.Line, row.Error)
+        case reservation.DUPLICATE:
+            log.Printf("Line %v: duplicate of patient %v", row.Line, row.PatientId)
+        }
+    }
+    verb := "Imported"
+    if report.DryRun {
+        verb = "Dry run, would import"
+    }
+    log.Printf("%v %v of %v patient(s), %v duplicate(s), %v invalid", verb, report.Imported, report.Total, report.Duplicates, report.Invalid)
+    return nil
+}
@@ -42,8 +42,8 @@ if (databases.includes(database)) {
 const db = connection.getDB(database);
 db.createCollection(collection);
 
-// create indexes
-db[collection].createIndex({ id: 1 });
+// indexes are created by the webapi migrations at startup
+// (see internal/migrations in the webapi sources)
 
 // exit with success
 process.exit(0);
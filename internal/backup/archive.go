@@ -0,0 +1,136 @@
+// Package backup exports the reservation database to a JSON Lines archive
+// and restores it. The first line of the archive is the Header, every other
+// line is a Record holding one document.
+package backup
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Format identifies the backup archives in the Header
+const Format = "reservation-webapi-backup"
+
+// Version of the archive layout, readers reject archives of other versions
+const Version = 1
+
+// maxRecordSize limits the length of one line of the archive
+const maxRecordSize = 16 * 1024 * 1024
+
+// Header is the first line of the archive
+type Header struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	// SchemaVersion is the latest database migration applied when exported
+	SchemaVersion int       `json:"schemaVersion"`
+	CreatedAt     time.Time `json:"createdAt"`
+	// Collections maps the collection name to its number of documents,
+	// truncated archives are detected by comparing the counts
+	Collections map[string]int `json:"collections"`
+}
+
+// Record is a document of the collection
+type Record struct {
+	Collection string          `json:"collection"`
+	Document   json.RawMessage `json:"document"`
+}
+
+// Archive holds the documents of the collections in the order they are written
+type Archive struct {
+	Header    Header
+	Documents map[string][]json.RawMessage
+}
+
+// NewArchive creates empty archive of the database at the schema version
+func NewArchive(schemaVersion int, now time.Time) *Archive {
+	return &Archive{
+		Header: Header{
+			Format:        Format,
+			Version:       Version,
+			SchemaVersion: schemaVersion,
+			CreatedAt:     now.UTC(),
+			Collections:   map[string]int{},
+		},
+		Documents: map[string][]json.RawMessage{},
+	}
+}
+
+// Add appends the document to the collection
+func (this *Archive) Add(collection string, document interface{}) error {
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("failed to encode document of %v: %w", collection, err)
+	}
+	this.Documents[collection] = append(this.Documents[collection], encoded)
+	this.Header.Collections[collection] = len(this.Documents[collection])
+	return nil
+}
+
+// Write writes the header and the documents of the collections in the order
+func (this *Archive) Write(w io.Writer, order []string) error {
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+	if err := encoder.Encode(this.Header); err != nil {
+		return err
+	}
+	for _, collection := range order {
+		for _, document := range this.Documents[collection] {
+			if err := encoder.Encode(Record{Collection: collection, Document: document}); err != nil {
+				return err
+			}
+		}
+	}
+	return writer.Flush()
+}
+
+// Read reads the archive and checks its format, version and document counts
+func Read(r io.Reader) (*Archive, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("archive is empty")
+	}
+	archive := &Archive{Documents: map[string][]json.RawMessage{}}
+	if err := json.Unmarshal(scanner.Bytes(), &archive.Header); err != nil {
+		return nil, fmt.Errorf("invalid archive header: %w", err)
+	}
+	if archive.Header.Format != Format {
+		return nil, fmt.Errorf("not a backup archive, format is %q", archive.Header.Format)
+	}
+	if archive.Header.Version != Version {
+		return nil, fmt.Errorf("unsupported archive version %v, expected %v", archive.Header.Version, Version)
+	}
+
+	line := 1
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		record := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("invalid record on line %v: %w", line, err)
+		}
+		if _, ok := archive.Header.Collections[record.Collection]; !ok {
+			return nil, fmt.Errorf("record on line %v belongs to collection %q missing in the header", line, record.Collection)
+		}
+		archive.Documents[record.Collection] = append(archive.Documents[record.Collection], record.Document)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for collection, count := range archive.Header.Collections {
+		if read := len(archive.Documents[collection]); read != count {
+			return nil, fmt.Errorf("archive is truncated, %v has %v of %v documents", collection, read, count)
+		}
+	}
+	return archive, nil
+}
@@ -0,0 +1,442 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/reservation"
+)
+
+// Names of the backed up collections
+const (
+	CollectionAmbulance         = "ambulance"
+	CollectionPatient           = "patient"
+	CollectionStaff             = "staff"
+	CollectionReservationSeries = "reservation_series"
+	CollectionReservation       = "reservation"
+)
+
+// Collections in the order they are written and restored, referenced
+// documents come before the referencing ones
+var Collections = []string{CollectionAmbulance, CollectionPatient, CollectionStaff, CollectionReservationSeries, CollectionReservation}
+
+// ConflictPolicy decides what happens with archived documents whose id
+// already exists in the database
+type ConflictPolicy string
+
+const (
+	// ConflictSkip keeps the stored document
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the stored document with the archived one
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictFail aborts the restore before anything is written
+	ConflictFail ConflictPolicy = "fail"
+)
+
+// ParseConflictPolicy returns the policy of the name
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(name); policy {
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown conflict policy %q, use skip, overwrite or fail", name)
+	}
+}
+
+// Databases are the services of the backed up collections
+type Databases struct {
+	AmbulanceDB         db_service.DbService[reservation.Ambulance]
+	PatientDB           db_service.DbService[reservation.Patient]
+	StaffDB             db_service.DbService[reservation.Staff]
+	ReservationSeriesDB db_service.DbService[reservation.ReservationSeries]
+	ReservationDB       db_service.DbService[reservation.ReservationInput]
+	// Transactor restores the collections atomically
+	Transactor db_service.Transactor
+}
+
+// Disconnect disconnects all the services, the client they share is
+// disconnected with the last one
+func (this Databases) Disconnect(ctx context.Context) {
+	this.AmbulanceDB.Disconnect(ctx)
+	this.PatientDB.Disconnect(ctx)
+	this.StaffDB.Disconnect(ctx)
+	this.ReservationSeriesDB.Disconnect(ctx)
+	this.ReservationDB.Disconnect(ctx)
+	this.Transactor.Disconnect(ctx)
+}
+
+// IntegrityError lists the problems found in the archive, nothing is
+// restored when the check fails
+type IntegrityError struct {
+	Problems []string
+}
+
+func (this *IntegrityError) Error() string {
+	return fmt.Sprintf("archive failed %v integrity check(s):\n  %v", len(this.Problems), strings.Join(this.Problems, "\n  "))
+}
+
+// RestoreResult counts the documents of the collection by outcome
+type RestoreResult struct {
+	Created     int
+	Overwritten int
+	Skipped     int
+}
+
+// Export loads all documents of the collections into a new archive
+func Export(ctx context.Context, dbs Databases, schemaVersion int) (*Archive, error) {
+	archive := NewArchive(schemaVersion, time.Now())
+	if err := exportCollection(ctx, archive, CollectionAmbulance, dbs.AmbulanceDB); err != nil {
+		return nil, err
+	}
+	if err := exportCollection(ctx, archive, CollectionPatient, dbs.PatientDB); err != nil {
+		return nil, err
+	}
+	if err := exportCollection(ctx, archive, CollectionStaff, dbs.StaffDB); err != nil {
+		return nil, err
+	}
+	if err := exportCollection(ctx, archive, CollectionReservationSeries, dbs.ReservationSeriesDB); err != nil {
+		return nil, err
+	}
+	if err := exportCollection(ctx, archive, CollectionReservation, dbs.ReservationDB); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+func exportCollection[DocType interface{}](ctx context.Context, archive *Archive, collection string, db db_service.DbService[DocType]) error {
+	documents, err := db.GetDocuments(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load %v: %w", collection, err)
+	}
+	// empty collections are listed in the header as well
+	archive.Header.Collections[collection] = 0
+	for i := range documents {
+		if err := archive.Add(collection, &documents[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ambulanceId(ambulance *reservation.Ambulance) string            { return ambulance.Id }
+func patientId(patient *reservation.Patient) string                  { return patient.Id }
+func staffId(staff *reservation.Staff) string                        { return staff.Id }
+func seriesId(series *reservation.ReservationSeries) string          { return series.Id }
+func reservationId(reservation *reservation.ReservationInput) string { return reservation.Id }
+
+// restorePlan holds the decoded documents and the ids already stored in the database
+type restorePlan struct {
+	ambulances   []reservation.Ambulance
+	patients     []reservation.Patient
+	staff        []reservation.Staff
+	series       []reservation.ReservationSeries
+	reservations []reservation.ReservationInput
+	existing     map[string]map[string]bool
+	problems     []string
+}
+
+func (this *restorePlan) problem(format string, args ...interface{}) {
+	this.problems = append(this.problems, fmt.Sprintf(format, args...))
+}
+
+// Restore writes the archived documents to the database in one transaction,
+// so a failed restore leaves the database unchanged. The archive is checked
+// first: every document must decode and have unique id, every reservation and
+// reservation series must reference an ambulance, a patient, a series and a
+// staff member that is either in the archive or already stored, and staff
+// members must reference stored or archived ambulances. With dryRun the
+// checks run and the results are counted, but nothing is written.
+func Restore(ctx context.Context, dbs Databases, archive *Archive, policy ConflictPolicy, dryRun bool) (map[string]RestoreResult, error) {
+	plan := &restorePlan{existing: map[string]map[string]bool{}}
+	for collection := range archive.Header.Collections {
+		if !slices.Contains(Collections, collection) {
+			plan.problem("collection %q is not supported", collection)
+		}
+	}
+
+	var err error
+	plan.ambulances, err = decodeCollection(ctx, plan, archive, CollectionAmbulance, dbs.AmbulanceDB, ambulanceId)
+	if err != nil {
+		return nil, err
+	}
+	plan.patients, err = decodeCollection(ctx, plan, archive, CollectionPatient, dbs.PatientDB, patientId)
+	if err != nil {
+		return nil, err
+	}
+	plan.staff, err = decodeCollection(ctx, plan, archive, CollectionStaff, dbs.StaffDB, staffId)
+	if err != nil {
+		return nil, err
+	}
+	plan.series, err = decodeCollection(ctx, plan, archive, CollectionReservationSeries, dbs.ReservationSeriesDB, seriesId)
+	if err != nil {
+		return nil, err
+	}
+	plan.reservations, err = decodeCollection(ctx, plan, archive, CollectionReservation, dbs.ReservationDB, reservationId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkReferences(ctx, plan, dbs); err != nil {
+		return nil, err
+	}
+
+	if policy == ConflictFail {
+		for _, collection := range Collections {
+			if conflicts := len(plan.existing[collection]); conflicts > 0 {
+				plan.problem("%v has %v document(s) already stored in the database", collection, conflicts)
+			}
+		}
+	}
+	if len(plan.problems) > 0 {
+		return nil, &IntegrityError{Problems: plan.problems}
+	}
+
+	if dryRun {
+		return restoreCollections(ctx, plan, dbs, policy, dryRun)
+	}
+	var results map[string]RestoreResult
+	err = dbs.Transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		results, err = restoreCollections(txCtx, plan, dbs, policy, dryRun)
+		return err
+	})
+	if err != nil {
+		// the transaction was rolled back, nothing is restored
+		return nil, err
+	}
+	return results, nil
+}
+
+// restoreCollections writes the checked documents, referenced collections first
+func restoreCollections(ctx context.Context, plan *restorePlan, dbs Databases, policy ConflictPolicy, dryRun bool) (map[string]RestoreResult, error) {
+	var err error
+	results := map[string]RestoreResult{}
+	results[CollectionAmbulance], err = restoreCollection(ctx, plan, CollectionAmbulance, dbs.AmbulanceDB, plan.ambulances,
+		ambulanceId, policy, dryRun)
+	if err != nil {
+		return results, err
+	}
+	results[CollectionPatient], err = restoreCollection(ctx, plan, CollectionPatient, dbs.PatientDB, plan.patients,
+		patientId, policy, dryRun)
+	if err != nil {
+		return results, err
+	}
+	results[CollectionStaff], err = restoreCollection(ctx, plan, CollectionStaff, dbs.StaffDB, plan.staff,
+		staffId, policy, dryRun)
+	if err != nil {
+		return results, err
+	}
+	results[CollectionReservationSeries], err = restoreCollection(ctx, plan, CollectionReservationSeries, dbs.ReservationSeriesDB, plan.series,
+		seriesId, policy, dryRun)
+	if err != nil {
+		return results, err
+	}
+	results[CollectionReservation], err = restoreCollection(ctx, plan, CollectionReservation, dbs.ReservationDB, plan.reservations,
+		reservationId, policy, dryRun)
+	return results, err
+}
+
+// decodeCollection decodes the archived documents, checks their ids and
+// records which of them are already stored in the database
+func decodeCollection[DocType interface{}](
+	ctx context.Context,
+	plan *restorePlan,
+	archive *Archive,
+	collection string,
+	db db_service.DbService[DocType],
+	idOf func(document *DocType) string,
+) ([]DocType, error) {
+	raw := archive.Documents[collection]
+	documents := make([]DocType, 0, len(raw))
+	ids := make([]string, 0, len(raw))
+	seen := map[string]bool{}
+	for i, encoded := range raw {
+		var document DocType
+		if err := json.Unmarshal(encoded, &document); err != nil {
+			plan.problem("%v document %v cannot be decoded: %v", collection, i+1, err)
+			continue
+		}
+		id := idOf(&document)
+		switch {
+		case id == "":
+			plan.problem("%v document %v has no id", collection, i+1)
+			continue
+		case seen[id]:
+			plan.problem("%v document %v is archived more than once", collection, id)
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+		documents = append(documents, document)
+	}
+
+	existing, err := storedIds(ctx, db, ids, idOf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %v: %w", collection, err)
+	}
+	plan.existing[collection] = existing
+	return documents, nil
+}
+
+// checkReferences verifies that staff, reservations and reservation series
+// reference archived or stored ambulances, patients, series and staff
+func checkReferences(ctx context.Context, plan *restorePlan, dbs Databases) error {
+	ambulances := map[string]bool{}
+	for _, ambulance := range plan.ambulances {
+		ambulances[ambulance.Id] = true
+	}
+	patients := map[string]bool{}
+	for _, patient := range plan.patients {
+		patients[patient.Id] = true
+	}
+
+	series := map[string]bool{}
+	for _, archived := range plan.series {
+		series[archived.Id] = true
+	}
+	staff := map[string]bool{}
+	for _, member := range plan.staff {
+		staff[member.Id] = true
+	}
+
+	missingAmbulances, missingPatients, missingSeries, missingStaff := []string{}, []string{}, []string{}, []string{}
+	for _, member := range plan.staff {
+		for _, id := range member.AmbulanceIds {
+			if !ambulances[id] {
+				missingAmbulances = append(missingAmbulances, id)
+			}
+		}
+	}
+	for _, archived := range plan.series {
+		if !ambulances[archived.AmbulanceId] {
+			missingAmbulances = append(missingAmbulances, archived.AmbulanceId)
+		}
+		if !patients[archived.PatientId] {
+			missingPatients = append(missingPatients, archived.PatientId)
+		}
+	}
+	for _, reservation := range plan.reservations {
+		if !ambulances[reservation.AmbulanceId] {
+			missingAmbulances = append(missingAmbulances, reservation.AmbulanceId)
+		}
+		if reservation.PatientId != "" && !patients[reservation.PatientId] {
+			missingPatients = append(missingPatients, reservation.PatientId)
+		}
+		if reservation.SeriesId != "" && !series[reservation.SeriesId] {
+			missingSeries = append(missingSeries, reservation.SeriesId)
+		}
+		if reservation.StaffId != "" && !staff[reservation.StaffId] {
+			missingStaff = append(missingStaff, reservation.StaffId)
+		}
+	}
+
+	storedAmbulances, err := storedIds(ctx, dbs.AmbulanceDB, missingAmbulances, ambulanceId)
+	if err != nil {
+		return fmt.Errorf("failed to load %v: %w", CollectionAmbulance, err)
+	}
+	storedPatients, err := storedIds(ctx, dbs.PatientDB, missingPatients, patientId)
+	if err != nil {
+		return fmt.Errorf("failed to load %v: %w", CollectionPatient, err)
+	}
+	storedSeries, err := storedIds(ctx, dbs.ReservationSeriesDB, missingSeries, seriesId)
+	if err != nil {
+		return fmt.Errorf("failed to load %v: %w", CollectionReservationSeries, err)
+	}
+	storedStaff, err := storedIds(ctx, dbs.StaffDB, missingStaff, staffId)
+	if err != nil {
+		return fmt.Errorf("failed to load %v: %w", CollectionStaff, err)
+	}
+
+	for _, member := range plan.staff {
+		for _, id := range member.AmbulanceIds {
+			if !ambulances[id] && !storedAmbulances[id] {
+				plan.problem("staff member %v references missing ambulance %q", member.Id, id)
+			}
+		}
+	}
+
+	for _, archived := range plan.series {
+		if !ambulances[archived.AmbulanceId] && !storedAmbulances[archived.AmbulanceId] {
+			plan.problem("reservation series %v references missing ambulance %q", archived.Id, archived.AmbulanceId)
+		}
+		if !patients[archived.PatientId] && !storedPatients[archived.PatientId] {
+			plan.problem("reservation series %v references missing patient %q", archived.Id, archived.PatientId)
+		}
+	}
+
+	for _, reservation := range plan.reservations {
+		if !ambulances[reservation.AmbulanceId] && !storedAmbulances[reservation.AmbulanceId] {
+			plan.problem("reservation %v references missing ambulance %q", reservation.Id, reservation.AmbulanceId)
+		}
+		if reservation.PatientId != "" && !patients[reservation.PatientId] && !storedPatients[reservation.PatientId] {
+			plan.problem("reservation %v references missing patient %q", reservation.Id, reservation.PatientId)
+		}
+		if reservation.SeriesId != "" && !series[reservation.SeriesId] && !storedSeries[reservation.SeriesId] {
+			plan.problem("reservation %v references missing reservation series %q", reservation.Id, reservation.SeriesId)
+		}
+		if reservation.StaffId != "" && !staff[reservation.StaffId] && !storedStaff[reservation.StaffId] {
+			plan.problem("reservation %v references missing staff member %q", reservation.Id, reservation.StaffId)
+		}
+	}
+	return nil
+}
+
+// storedIds returns which of the ids are stored in the database
+func storedIds[DocType interface{}](ctx context.Context, db db_service.DbService[DocType], ids []string, idOf func(document *DocType) string) (map[string]bool, error) {
+	stored := map[string]bool{}
+	if len(ids) == 0 {
+		return stored, nil
+	}
+	documents, err := db.FindDocuments(ctx, db_service.NewQuery(db_service.In("id", ids)).Project("id"))
+	if err != nil {
+		return nil, err
+	}
+	for i := range documents {
+		stored[idOf(&documents[i])] = true
+	}
+	return stored, nil
+}
+
+func restoreCollection[DocType interface{}](
+	ctx context.Context,
+	plan *restorePlan,
+	collection string,
+	db db_service.DbService[DocType],
+	documents []DocType,
+	idOf func(document *DocType) string,
+	policy ConflictPolicy,
+	dryRun bool,
+) (RestoreResult, error) {
+	result := RestoreResult{}
+	for i := range documents {
+		document := &documents[i]
+		id := idOf(document)
+		exists := plan.existing[collection][id]
+		if exists && policy == ConflictSkip {
+			result.Skipped++
+			continue
+		}
+
+		if !dryRun {
+			var err error
+			if exists {
+				err = db.UpdateDocument(ctx, id, document)
+			} else {
+				err = db.CreateDocument(ctx, id, document)
+			}
+			if err != nil {
+				return result, fmt.Errorf("failed to restore %v document %v: %w", collection, id, err)
+			}
+		}
+		if exists {
+			result.Overwritten++
+		} else {
+			result.Created++
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,243 @@
+package db_service
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Filter selects documents by their fields. The zero value matches all documents.
+// Field names are the lower-cased names of the document struct fields.
+type Filter struct {
+    document bson.D
+}
+
+func fieldFilter(field string, operator string, value interface{}) Filter {
+    return Filter{bson.D{{Key: field, Value: bson.D{{Key: operator, Value: value}}}}}
+}
+
+// Eq matches documents where field equals the value
+func Eq(field string, value interface{}) Filter {
+    return fieldFilter(field, "$eq", value)
+}
+
+// Ne matches documents where field does not equal the value, including documents without the field
+func Ne(field string, value interface{}) Filter {
+    return fieldFilter(field, "$ne", value)
+}
+
+// Gt matches documents where field is greater than the value
+func Gt(field string, value interface{}) Filter {
+    return fieldFilter(field, "$gt", value)
+}
+
+// Gte matches documents where field is greater than or equal to the value
+func Gte(field string, value interface{}) Filter {
+    return fieldFilter(field, "$gte", value)
+}
+
+// Lt matches documents where field is less than the value
+func Lt(field string, value interface{}) Filter {
+    return fieldFilter(field, "$lt", value)
+}
+
+// Lte matches documents where field is less than or equal to the value
+func Lte(field string, value interface{}) Filter {
+    return fieldFilter(field, "$lte", value)
+}
+
+// In matches documents where field equals any of the values. For array fields
+// it matches documents where the array contains any of the values.
+func In[T any](field string, values []T) Filter {
+    return fieldFilter(field, "$in", values)
+}
+
+// Exists matches documents which have (or have not) the field
+func Exists(field string, exists bool) Filter {
+    return fieldFilter(field, "$exists", exists)
+}
+
+// Text matches documents by the text index of the collection. The search
+// terms are matched case and diacritics insensitively, see MongoDB $text.
+func Text(search string) Filter {
+    return Filter{bson.D{{Key: "$text", Value: bson.D{{Key: "$search", Value: search}}}}}
+}
+
+// And matches documents matching all of the filters
+func And(filters ...Filter) Filter {
+    return logicalFilter("$and", filters)
+}
+
+// Or matches documents matching any of the filters
+func Or(filters ...Filter) Filter {
+    return logicalFilter("$or", filters)
+}
+
+func logicalFilter(operator string, filters []Filter) Filter {
+    documents := bson.A{}
+    for _, filter := range filters {
+        if len(filter.document) > 0 {
+            documents = append(documents, filter.document)
+        }
+    }
+    switch len(documents) {
+    case 0:
+        return Filter{}
+    case 1:
+        return Filter{documents[0].(bson.D)}
+    default:
+        return Filter{bson.D{{Key: operator, Value: documents}}}
+    }
+}
+
+// withPrefix prefixes the field names of the filter, e.g. to match the
+// fullDocument of change events
+func (this Filter) withPrefix(prefix string) Filter {
+    return Filter{prefixFields(this.document, prefix)}
+}
+
+func prefixFields(document bson.D, prefix string) bson.D {
+    if document == nil {
+        return nil
+    }
+    prefixed := make(bson.D, 0, len(document))
+    for _, element := range document {
+        if len(element.Key) > 0 && element.Key[0] == '$' {
+            // logical operators hold nested filters
+            if filters, ok := element.Value.(bson.A); ok {
+                nested := make(bson.A, len(filters))
+                for i, filter := range filters {
+                    if filterDocument, ok := filter.(bson.D); ok {
+                        nested[i] = prefixFields(filterDocument, prefix)
+                    } else {
+                        nested[i] = filter
+                    }
+                }
+                element.Value = nested
+            }
+        } else {
+            element.Key = prefix + element.Key
+        }
+        prefixed = append(prefixed, element)
+    }
+    return prefixed
+}
+
+func (this Filter) toBson() bson.D {
+    if this.document == nil {
+        return bson.D{}
+    }
+    return this.document
+}
+
+// SortField orders the query results by the field
+type SortField struct {
+    Field      string
+    Descending bool
+}
+
+// Collation specifies language specific comparison of strings, see
+// https://www.mongodb.com/docs/manual/reference/collation/
+type Collation struct {
+    Locale string
+    // Strength 1 compares base letters only (case and diacritics insensitive),
+    // 2 adds diacritics, 3 adds case
+    Strength int
+}
+
+// Query describes documents to find and the shape of the result
+type Query struct {
+    Filter Filter
+    // Collation is used for string comparisons, the query can use only indexes with the same collation
+    Collation *Collation
+    // Projection limits the fields loaded into the documents, all fields are loaded when empty
+    Projection []string
+    Sort       []SortField
+    // SortByTextScore orders the results by relevance of the Text filter, before the Sort fields
+    SortByTextScore bool
+    // Skip and Limit page the results, zero Limit means no limit
+    Skip  int64
+    Limit int64
+}
+
+// NewQuery creates query for documents matching the filter
+func NewQuery(filter Filter) Query {
+    return Query{Filter: filter}
+}
+
+// SortBy appends sort field to the query
+func (this Query) SortBy(field string, descending bool) Query {
+    this.Sort = append(append([]SortField{}, this.Sort...), SortField{Field: field, Descending: descending})
+    return this
+}
+
+// SortByRelevance orders the results by relevance of the Text filter
+func (this Query) SortByRelevance() Query {
+    this.SortByTextScore = true
+    return this
+}
+
+// WithCollation sets collation used for string comparisons
+func (this Query) WithCollation(locale string, strength int) Query {
+    this.Collation = &Collation{Locale: locale, Strength: strength}
+    return this
+}
+
+// Project limits the fields loaded into the documents
+func (this Query) Project(fields ...string) Query {
+    this.Projection = append(append([]string{}, this.Projection...), fields...)
+    return this
+}
+
+// Page sets skip and limit of the query
+func (this Query) Page(skip int64, limit int64) Query {
+    this.Skip = skip
+    this.Limit = limit
+    return this
+}
+
+func (this Query) findOptions() *options.FindOptions {
+    findOptions := options.Find()
+    if len(this.Projection) > 0 {
+        projection := bson.D{}
+        for _, field := range this.Projection {
+            projection = append(projection, bson.E{Key: field, Value: 1})
+        }
+        findOptions.SetProjection(projection)
+    }
+    if len(this.Sort) > 0 || this.SortByTextScore {
+        sort := bson.D{}
+        if this.SortByTextScore {
+            sort = append(sort, bson.E{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}})
+        }
+        for _, field := range this.Sort {
+            direction := 1
+            if field.Descending {
+                direction = -1
+            }
+            sort = append(sort, bson.E{Key: field.Field, Value: direction})
+        }
+        findOptions.SetSort(sort)
+    }
+    if this.Collation != nil {
+        findOptions.SetCollation(this.Collation.toOptions())
+    }
+    if this.Skip > 0 {
+        findOptions.SetSkip(this.Skip)
+    }
+    if this.Limit > 0 {
+        findOptions.SetLimit(this.Limit)
+    }
+    return findOptions
+}
+
+func (this Query) countOptions() *options.CountOptions {
+    countOptions := options.Count()
+    if this.Collation != nil {
+        countOptions.SetCollation(this.Collation.toOptions())
+    }
+    return countOptions
+}
+
+func (this *Collation) toOptions() *options.Collation {
+    return &options.Collation{Locale: this.Locale, Strength: this.Strength}
+}
@@ -0,0 +1,209 @@
+package db_service
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestFilterToBson(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bson.D
+	}{
+		{
+			name:   "zero value matches all",
+			filter: Filter{},
+			want:   bson.D{},
+		},
+		{
+			name:   "eq",
+			filter: Eq("ambulanceid", "a1"),
+			want:   bson.D{{Key: "ambulanceid", Value: bson.D{{Key: "$eq", Value: "a1"}}}},
+		},
+		{
+			name:   "in",
+			filter: In("id", []string{"r1", "r2"}),
+			want:   bson.D{{Key: "id", Value: bson.D{{Key: "$in", Value: []string{"r1", "r2"}}}}},
+		},
+		{
+			name:   "exists",
+			filter: Exists("timezone", false),
+			want:   bson.D{{Key: "timezone", Value: bson.D{{Key: "$exists", Value: false}}}},
+		},
+		{
+			name:   "text",
+			filter: Text("novak"),
+			want:   bson.D{{Key: "$text", Value: bson.D{{Key: "$search", Value: "novak"}}}},
+		},
+		{
+			name:   "and",
+			filter: And(Gte("start", 1), Lt("end", 2)),
+			want: bson.D{{Key: "$and", Value: bson.A{
+				bson.D{{Key: "start", Value: bson.D{{Key: "$gte", Value: 1}}}},
+				bson.D{{Key: "end", Value: bson.D{{Key: "$lt", Value: 2}}}},
+			}}},
+		},
+		{
+			name:   "or",
+			filter: Or(Eq("status", "WAITING"), Ne("status", "BOOKED")),
+			want: bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "status", Value: bson.D{{Key: "$eq", Value: "WAITING"}}}},
+				bson.D{{Key: "status", Value: bson.D{{Key: "$ne", Value: "BOOKED"}}}},
+			}}},
+		},
+		{
+			name:   "and skips empty filters",
+			filter: And(Filter{}, Gt("sequence", 0), Filter{}),
+			want:   bson.D{{Key: "sequence", Value: bson.D{{Key: "$gt", Value: 0}}}},
+		},
+		{
+			name:   "or of empty filters matches all",
+			filter: Or(Filter{}, Filter{}),
+			want:   bson.D{},
+		},
+		{
+			name:   "nested",
+			filter: And(Lte("start", 1), Or(Exists("staffid", false), Eq("staffid", "s1"))),
+			want: bson.D{{Key: "$and", Value: bson.A{
+				bson.D{{Key: "start", Value: bson.D{{Key: "$lte", Value: 1}}}},
+				bson.D{{Key: "$or", Value: bson.A{
+					bson.D{{Key: "staffid", Value: bson.D{{Key: "$exists", Value: false}}}},
+					bson.D{{Key: "staffid", Value: bson.D{{Key: "$eq", Value: "s1"}}}},
+				}}},
+			}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.filter.toBson(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("toBson() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterWithPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bson.D
+	}{
+		{
+			name:   "zero value",
+			filter: Filter{},
+			want:   bson.D{},
+		},
+		{
+			name:   "field",
+			filter: Eq("ambulanceid", "a1"),
+			want:   bson.D{{Key: "fullDocument.ambulanceid", Value: bson.D{{Key: "$eq", Value: "a1"}}}},
+		},
+		{
+			name:   "logical operators are kept",
+			filter: Or(Eq("ambulanceid", "a1"), And(Eq("patientid", "p1"), Exists("staffid", true))),
+			want: bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "fullDocument.ambulanceid", Value: bson.D{{Key: "$eq", Value: "a1"}}}},
+				bson.D{{Key: "$and", Value: bson.A{
+					bson.D{{Key: "fullDocument.patientid", Value: bson.D{{Key: "$eq", Value: "p1"}}}},
+					bson.D{{Key: "fullDocument.staffid", Value: bson.D{{Key: "$exists", Value: true}}}},
+				}}},
+			}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := test.filter.toBson()
+			if got := test.filter.withPrefix("fullDocument.").toBson(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("withPrefix() = %v, want %v", got, test.want)
+			}
+			if !reflect.DeepEqual(test.filter.toBson(), original) {
+				t.Errorf("withPrefix() changed the original filter to %v", test.filter.toBson())
+			}
+		})
+	}
+}
+
+func TestQueryFindOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+		want  *options.FindOptions
+	}{
+		{
+			name:  "defaults",
+			query: NewQuery(Filter{}),
+			want:  options.Find(),
+		},
+		{
+			name:  "projection",
+			query: NewQuery(Filter{}).Project("id", "start").Project("end"),
+			want:  options.Find().SetProjection(bson.D{{Key: "id", Value: 1}, {Key: "start", Value: 1}, {Key: "end", Value: 1}}),
+		},
+		{
+			name:  "sort",
+			query: NewQuery(Filter{}).SortBy("start", false).SortBy("id", true),
+			want:  options.Find().SetSort(bson.D{{Key: "start", Value: 1}, {Key: "id", Value: -1}}),
+		},
+		{
+			name:  "sort by relevance first",
+			query: NewQuery(Text("novak")).SortBy("name", false).SortByRelevance(),
+			want: options.Find().SetSort(bson.D{
+				{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}},
+				{Key: "name", Value: 1},
+			}),
+		},
+		{
+			name:  "collation",
+			query: NewQuery(Filter{}).WithCollation("sk", 1),
+			want:  options.Find().SetCollation(&options.Collation{Locale: "sk", Strength: 1}),
+		},
+		{
+			name:  "paging",
+			query: NewQuery(Filter{}).Page(20, 10),
+			want:  options.Find().SetSkip(20).SetLimit(10),
+		},
+		{
+			name:  "zero limit means no limit",
+			query: NewQuery(Filter{}).Page(0, 0),
+			want:  options.Find(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.query.findOptions(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("findOptions() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQueryBuildersDoNotShareSlices(t *testing.T) {
+	base := NewQuery(Filter{}).SortBy("start", false).Project("id")
+	first := base.SortBy("end", false).Project("start")
+	second := base.SortBy("id", true).Project("end")
+
+	if len(base.Sort) != 1 || len(base.Projection) != 1 {
+		t.Errorf("base query changed to %+v", base)
+	}
+	if first.Sort[1].Field != "end" || first.Projection[1] != "start" {
+		t.Errorf("first query changed to %+v", first)
+	}
+	if second.Sort[1].Field != "id" || second.Projection[1] != "end" {
+		t.Errorf("second query changed to %+v", second)
+	}
+}
+
+func TestQueryCountOptions(t *testing.T) {
+	query := NewQuery(Filter{}).WithCollation("sk", 2).Page(10, 5).SortBy("name", false)
+	want := options.Count().SetCollation(&options.Collation{Locale: "sk", Strength: 2})
+	if got := query.countOptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("countOptions() = %+v, want %+v", got, want)
+	}
+}
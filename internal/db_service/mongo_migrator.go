@@ -0,0 +1,139 @@
+package db_service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is a single versioned change of the database schema or data.
+// Migrations must be idempotent - several replicas may run the same
+// migration concurrently before its version gets recorded.
+type Migration struct {
+    Version     int
+    Description string
+    Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// MigrationRecord is stored in the migrations collection for every applied migration
+type MigrationRecord struct {
+    Version     int       `json:"version"`
+    Description string    `json:"description"`
+    AppliedAt   time.Time `json:"appliedAt"`
+}
+
+type Migrator interface {
+    // Migrate applies all migrations which are not yet recorded in the database
+    // and returns the records of the migrations applied by this call
+    Migrate(ctx context.Context, migrations []Migration) ([]MigrationRecord, error)
+    // AppliedMigrations returns records of all migrations applied so far
+    AppliedMigrations(ctx context.Context) ([]MigrationRecord, error)
+    // Rerun applies the migrations again even if they are recorded, e.g. to
+    // upgrade documents restored from an older backup
+    Rerun(ctx context.Context, migrations []Migration) error
+    Disconnect(ctx context.Context) error
+}
+
+type mongoMigrator struct {
+    *mongoSvc[MigrationRecord]
+}
+
+// NewMongoMigrator creates migrator which records applied versions in the
+// collection given by config.Collection (defaults to "schema_migrations")
+func NewMongoMigrator(config MongoServiceConfig) Migrator {
+    if config.Collection == "" {
+        config.Collection = "schema_migrations"
+    }
+    return &mongoMigrator{newMongoSvc[MigrationRecord](config)}
+}
+
+func (this *mongoMigrator) AppliedMigrations(ctx context.Context) ([]MigrationRecord, error) {
+    records, err := this.GetDocuments(ctx)
+    if err != nil {
+        return nil, err
+    }
+    sort.Slice(records, func(i, j int) bool { return records[i].Version < records[j].Version })
+    return records, nil
+}
+
+func (this *mongoMigrator) Migrate(ctx context.Context, migrations []Migration) ([]MigrationRecord, error) {
+    client, err := this.connect(ctx)
+    if err != nil {
+        return nil, err
+    }
+    db := client.Database(this.DbName)
+    collection := db.Collection(this.Collection)
+
+    _, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+        Keys:    bson.D{{Key: "version", Value: 1}},
+        Options: options.Index().SetUnique(true),
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to create index on %v: %w", this.Collection, err)
+    }
+
+    records, err := this.AppliedMigrations(ctx)
+    if err != nil {
+        return nil, err
+    }
+    appliedVersions := make(map[int]bool, len(records))
+    for _, record := range records {
+        appliedVersions[record.Version] = true
+    }
+
+    pending := make([]Migration, 0, len(migrations))
+    for _, migration := range migrations {
+        if !appliedVersions[migration.Version] {
+            pending = append(pending, migration)
+        }
+    }
+    sort.Slice(pending, func(i, j int) bool { return pending[i].Version < pending[j].Version })
+
+    applied := make([]MigrationRecord, 0, len(pending))
+    for _, migration := range pending {
+        log.Printf("Applying migration %v: %v", migration.Version, migration.Description)
+        if err := migration.Up(ctx, db); err != nil {
+            return applied, fmt.Errorf("migration %v (%v) failed: %w", migration.Version, migration.Description, err)
+        }
+
+        record := MigrationRecord{
+            Version:     migration.Version,
+            Description: migration.Description,
+            AppliedAt:   time.Now().UTC(),
+        }
+        _, err := collection.InsertOne(ctx, record)
+        switch {
+        case err == nil:
+            applied = append(applied, record)
+        case mongo.IsDuplicateKeyError(err):
+            // another replica recorded the same migration meanwhile
+        default:
+            return applied, fmt.Errorf("failed to record migration %v: %w", migration.Version, err)
+        }
+    }
+    return applied, nil
+}
+
+func (this *mongoMigrator) Rerun(ctx context.Context, migrations []Migration) error {
+    client, err := this.connect(ctx)
+    if err != nil {
+        return err
+    }
+    db := client.Database(this.DbName)
+
+    sorted := append([]Migration{}, migrations...)
+    sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+    for _, migration := range sorted {
+        log.Printf("Rerunning migration %v: %v", migration.Version, migration.Description)
+        if err := migration.Up(ctx, db); err != nil {
+            return fmt.Errorf("migration %v (%v) failed: %w", migration.Version, migration.Description, err)
+        }
+    }
+    return nil
+}
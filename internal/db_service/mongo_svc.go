@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -19,11 +20,23 @@ type DbService[DocType interface{}] interface {
     GetDocuments(ctx context.Context) ([]DocType, error)
     GetDocumentsByField(ctx context.Context, field string, value string) ([]DocType, error)
     GetDocumentsByArrayField(ctx context.Context, field string, value []string) ([]DocType, error)
+    FindDocuments(ctx context.Context, query Query) ([]DocType, error)
+    // CountDocuments counts documents matching the query, its sort and paging are ignored
+    CountDocuments(ctx context.Context, query Query) (int64, error)
     CreateDocument(ctx context.Context, id string, document *DocType) error
     FindDocument(ctx context.Context, id string) (*DocType, error)
     UpdateDocument(ctx context.Context, id string, document *DocType) error
+    // UpdateDocumentIf replaces the document only if it still matches the filter,
+    // it returns ErrNotFound otherwise. It serves as compare-and-swap for state changes.
+    UpdateDocumentIf(ctx context.Context, id string, filter Filter, document *DocType) error
     DeleteDocument(ctx context.Context, id string) error
     DeleteDocumentsByField(ctx context.Context, field string, value string) error
+    LockDocument(ctx context.Context, id string) error
+    // Watch passes changes of the documents matching the filter to the handler
+    // until the context is cancelled or the handler fails. The filter matches
+    // the document after the change, or before it for deletions. It returns
+    // ErrWatchNotSupported when changes cannot be watched, callers poll instead.
+    Watch(ctx context.Context, filter Filter, handler func(change ChangeEvent[DocType]) error) error
     Disconnect(ctx context.Context) error
 }
 
@@ -40,13 +53,29 @@ type MongoServiceConfig struct {
     Timeout    time.Duration
 }
 
-type mongoSvc[DocType interface{}] struct {
-    MongoServiceConfig
+// mongoConnection holds the client shared by all services connecting to the same
+// server with the same credentials, so that their operations can take part
+// in one session and transaction. The client is disconnected when the last
+// service using it disconnects.
+type mongoConnection struct {
     client     atomic.Pointer[mongo.Client]
     clientLock sync.Mutex
+    services   int // guarded by clientLock
+}
+
+var connections sync.Map // connection key -> *mongoConnection
+
+type mongoSvc[DocType interface{}] struct {
+    MongoServiceConfig
+    *mongoConnection
+    disconnected atomic.Bool
 }
 
 func NewMongoService[DocType interface{}](config MongoServiceConfig) DbService[DocType] {
+    return newMongoSvc[DocType](config)
+}
+
+func newMongoSvc[DocType interface{}](config MongoServiceConfig) *mongoSvc[DocType] {
      enviro := func(name string, defaultValue string) string {
          if value, ok := os.LookupEnv(name); ok {
              return value
@@ -105,6 +134,13 @@ func NewMongoService[DocType interface{}](config MongoServiceConfig) DbService[D
          svc.DbName,
          svc.Collection,
      )
+
+     connectionKey := fmt.Sprintf("%v@%v:%v", svc.UserName, svc.ServerHost, svc.ServerPort)
+     connection, _ := connections.LoadOrStore(connectionKey, &mongoConnection{})
+     svc.mongoConnection = connection.(*mongoConnection)
+     svc.clientLock.Lock()
+     svc.services++
+     svc.clientLock.Unlock()
      return svc
  }
 
@@ -141,19 +177,26 @@ func NewMongoService[DocType interface{}](config MongoServiceConfig) DbService[D
     }
 }
 
+// Disconnect releases the shared client, it is disconnected once all services
+// using it are disconnected. The service must not be used afterwards.
 func (this *mongoSvc[DocType]) Disconnect(ctx context.Context) error {
-    client := this.client.Load()
+    if this.disconnected.Swap(true) {
+        return nil
+    }
+
+    this.clientLock.Lock()
+    defer this.clientLock.Unlock()
+
+    this.services--
+    if this.services > 0 {
+        return nil
+    }
 
+    client := this.client.Load()
+    this.client.Store(nil)
     if client != nil {
-        this.clientLock.Lock()
-        defer this.clientLock.Unlock()
-
-        client = this.client.Load()
-        defer this.client.Store(nil)
-        if client != nil {
-            if err := client.Disconnect(ctx); err != nil {
-                return err
-            }
+        if err := client.Disconnect(ctx); err != nil {
+            return err
         }
     }
     return nil
@@ -222,6 +265,39 @@ func (this *mongoSvc[DocType]) GetDocumentsByArrayField(ctx context.Context, fie
     return documents, nil
 }
 
+func (this *mongoSvc[DocType]) FindDocuments(ctx context.Context, query Query) ([]DocType, error) {
+    ctx, contextCancel := context.WithTimeout(ctx, this.Timeout)
+    defer contextCancel()
+    client, err := this.connect(ctx)
+    if err != nil {
+        return nil, err
+    }
+    db := client.Database(this.DbName)
+    collection := db.Collection(this.Collection)
+    cursor, err := collection.Find(ctx, query.Filter.toBson(), query.findOptions())
+    if err != nil {
+        return nil, err
+    }
+    defer cursor.Close(ctx)
+    var documents []DocType
+    if err := cursor.All(ctx, &documents); err != nil {
+        return nil, err
+    }
+    return documents, nil
+}
+
+func (this *mongoSvc[DocType]) CountDocuments(ctx context.Context, query Query) (int64, error) {
+    ctx, contextCancel := context.WithTimeout(ctx, this.Timeout)
+    defer contextCancel()
+    client, err := this.connect(ctx)
+    if err != nil {
+        return 0, err
+    }
+    db := client.Database(this.DbName)
+    collection := db.Collection(this.Collection)
+    return collection.CountDocuments(ctx, query.Filter.toBson(), query.countOptions())
+}
+
 func (this *mongoSvc[DocType]) CreateDocument(ctx context.Context, id string, document *DocType) error {
     ctx, contextCancel := context.WithTimeout(ctx, this.Timeout)
     defer contextCancel()
@@ -231,17 +307,11 @@ func (this *mongoSvc[DocType]) CreateDocument(ctx context.Context, id string, do
     }
     db := client.Database(this.DbName)
     collection := db.Collection(this.Collection)
-    result := collection.FindOne(ctx, bson.D{{Key: "id", Value: id}})
-    switch result.Err() {
-    case nil: // no error means there is conflicting document
+    // uniqueness of the id is guarded by the unique index, see internal/migrations
+    _, err = collection.InsertOne(ctx, document)
+    if mongo.IsDuplicateKeyError(err) {
         return ErrConflict
-    case mongo.ErrNoDocuments:
-        // do nothing, this is expected
-    default: // other errors - return them
-        return result.Err()
     }
-
-    _, err = collection.InsertOne(ctx, document)
     return err
 }
 
@@ -290,6 +360,25 @@ func (this *mongoSvc[DocType]) UpdateDocument(ctx context.Context, id string, do
     return err
 }
 
+func (this *mongoSvc[DocType]) UpdateDocumentIf(ctx context.Context, id string, filter Filter, document *DocType) error {
+    ctx, contextCancel := context.WithTimeout(ctx, this.Timeout)
+    defer contextCancel()
+    client, err := this.connect(ctx)
+    if err != nil {
+        return err
+    }
+    db := client.Database(this.DbName)
+    collection := db.Collection(this.Collection)
+    result, err := collection.ReplaceOne(ctx, And(Eq("id", id), filter).toBson(), document)
+    if err != nil {
+        return err
+    }
+    if result.MatchedCount == 0 {
+        return ErrNotFound
+    }
+    return nil
+}
+
 func (this *mongoSvc[DocType]) DeleteDocument(ctx context.Context, id string) error {
     ctx, contextCancel := context.WithTimeout(ctx, this.Timeout)
     defer contextCancel()
@@ -322,4 +411,30 @@ func (this *mongoSvc[DocType]) DeleteDocumentsByField(ctx context.Context, field
     collection := db.Collection(this.Collection)
     _, err = collection.DeleteMany(ctx, bson.D{{Key: field, Value: value}})
     return err
-}
\ No newline at end of file
+}
+
+// LockDocument writes a lock marker into the document. Concurrent transactions
+// locking the same document conflict with each other and are retried, which
+// serializes check-then-write sequences guarded by the document.
+func (this *mongoSvc[DocType]) LockDocument(ctx context.Context, id string) error {
+    ctx, contextCancel := context.WithTimeout(ctx, this.Timeout)
+    defer contextCancel()
+    client, err := this.connect(ctx)
+    if err != nil {
+        return err
+    }
+    db := client.Database(this.DbName)
+    collection := db.Collection(this.Collection)
+    result, err := collection.UpdateOne(
+        ctx,
+        bson.D{{Key: "id", Value: id}},
+        bson.D{{Key: "$set", Value: bson.D{{Key: "_lock", Value: primitive.NewObjectID()}}}},
+    )
+    if err != nil {
+        return err
+    }
+    if result.MatchedCount == 0 {
+        return ErrNotFound
+    }
+    return nil
+}
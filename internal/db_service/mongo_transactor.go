@@ -0,0 +1,97 @@
+package db_service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Transactor runs units of work spanning several collections atomically.
+type Transactor interface {
+    // WithTransaction runs fn in a transaction. All DbService calls inside fn
+    // must receive the context passed to fn to take part in the transaction.
+    // The fn may be called repeatedly when the transaction is retried,
+    // therefore it must not have side effects outside of the database.
+    WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+    // Disconnect releases the client shared with the services
+    Disconnect(ctx context.Context) error
+}
+
+// ErrTransactionsUnsupported is returned on a standalone server unless running
+// without transactions is allowed
+var ErrTransactionsUnsupported = fmt.Errorf("MongoDB is a standalone server without transactions, set RESERVATION_API_MONGODB_ALLOW_STANDALONE=true to run without them")
+
+type mongoTransactor struct {
+    *mongoSvc[bson.M]
+    allowStandalone  bool
+    supportLock      sync.Mutex
+    supportChecked   bool
+    supportsSessions bool
+}
+
+// NewMongoTransactor creates transactor for services sharing the same server and
+// credentials. Transactions need replica set or sharded cluster, on standalone
+// server the units of work fail with ErrTransactionsUnsupported, unless
+// RESERVATION_API_MONGODB_ALLOW_STANDALONE is true, then they run without
+// transaction and lose their atomicity.
+func NewMongoTransactor(config MongoServiceConfig) Transactor {
+    allowStandalone, _ := strconv.ParseBool(os.Getenv("RESERVATION_API_MONGODB_ALLOW_STANDALONE"))
+    return &mongoTransactor{mongoSvc: newMongoSvc[bson.M](config), allowStandalone: allowStandalone}
+}
+
+func (this *mongoTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+    client, err := this.connect(ctx)
+    if err != nil {
+        return err
+    }
+
+    supported, err := this.transactionsSupported(ctx, client)
+    if err != nil {
+        return err
+    }
+    if !supported {
+        if !this.allowStandalone {
+            return ErrTransactionsUnsupported
+        }
+        return fn(ctx)
+    }
+
+    return client.UseSession(ctx, func(sessionCtx mongo.SessionContext) error {
+        _, err := sessionCtx.WithTransaction(sessionCtx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+            return nil, fn(sessionCtx)
+        })
+        return err
+    })
+}
+
+// transactionsSupported checks whether the server is member of replica set or mongos router
+func (this *mongoTransactor) transactionsSupported(ctx context.Context, client *mongo.Client) (bool, error) {
+    this.supportLock.Lock()
+    defer this.supportLock.Unlock()
+    if this.supportChecked {
+        return this.supportsSessions, nil
+    }
+
+    var hello bson.M
+    err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+    if err != nil {
+        return false, fmt.Errorf("cannot determine MongoDB topology: %w", err)
+    }
+    _, isReplicaSet := hello["setName"]
+    this.supportsSessions = isReplicaSet || hello["msg"] == "isdbgrid"
+    this.supportChecked = true
+    switch {
+    case this.supportsSessions:
+    case this.allowStandalone:
+        log.Printf("MongoDB is a standalone server, units of work run WITHOUT transactions and are not atomic")
+    default:
+        log.Printf("MongoDB is a standalone server, units of work fail: %v", ErrTransactionsUnsupported)
+    }
+    return this.supportsSessions, nil
+}
@@ -0,0 +1,112 @@
+package db_service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Operations of the change events
+const (
+    ChangeInsert  = "insert"
+    ChangeUpdate  = "update"
+    ChangeReplace = "replace"
+    ChangeDelete  = "delete"
+)
+
+// ErrWatchNotSupported is returned by Watch on standalone servers, change
+// streams require replica set or sharded cluster. Filtered watches return it
+// also when the collection does not record pre-images, deletions could not be
+// matched by the filter without them.
+var ErrWatchNotSupported = fmt.Errorf("change streams are not supported by the server")
+
+// ChangeEvent is a change of the document observed by Watch
+type ChangeEvent[DocType interface{}] struct {
+    Operation string
+    // Document after the change, nil for deletions
+    Document *DocType
+    // Previous is the document before the change, it is available only when
+    // pre-images are enabled on the collection, see internal/migrations
+    Previous *DocType
+}
+
+// changeStreamUnsupportedCode is returned by $changeStream on standalone servers
+const changeStreamUnsupportedCode = 40573
+
+func (this *mongoSvc[DocType]) Watch(ctx context.Context, filter Filter, handler func(change ChangeEvent[DocType]) error) error {
+    client, err := this.connect(ctx)
+    if err != nil {
+        return err
+    }
+    db := client.Database(this.DbName)
+    collection := db.Collection(this.Collection)
+
+    match := bson.D{{Key: "operationType", Value: bson.D{{Key: "$in", Value: bson.A{ChangeInsert, ChangeUpdate, ChangeReplace, ChangeDelete}}}}}
+    if len(filter.document) > 0 {
+        enabled, err := preImagesEnabled(ctx, db, this.Collection)
+        if err != nil {
+            return err
+        }
+        if !enabled {
+            return ErrWatchNotSupported
+        }
+        match = bson.D{{Key: "$and", Value: bson.A{
+            match,
+            Or(filter.withPrefix("fullDocument."), filter.withPrefix("fullDocumentBeforeChange.")).toBson(),
+        }}}
+    }
+    stream, err := collection.Watch(
+        ctx,
+        mongo.Pipeline{{{Key: "$match", Value: match}}},
+        options.ChangeStream().SetFullDocument(options.UpdateLookup).SetFullDocumentBeforeChange(options.WhenAvailable),
+    )
+    var commandErr mongo.CommandError
+    if errors.As(err, &commandErr) && commandErr.Code == changeStreamUnsupportedCode {
+        return ErrWatchNotSupported
+    }
+    if err != nil {
+        return err
+    }
+    defer stream.Close(context.Background())
+
+    for stream.Next(ctx) {
+        var event struct {
+            OperationType            string   `bson:"operationType"`
+            FullDocument             *DocType `bson:"fullDocument"`
+            FullDocumentBeforeChange *DocType `bson:"fullDocumentBeforeChange"`
+        }
+        if err := stream.Decode(&event); err != nil {
+            return err
+        }
+        change := ChangeEvent[DocType]{
+            Operation: event.OperationType,
+            Document:  event.FullDocument,
+            Previous:  event.FullDocumentBeforeChange,
+        }
+        if err := handler(change); err != nil {
+            return err
+        }
+    }
+    if ctx.Err() != nil {
+        return nil
+    }
+    return stream.Err()
+}
+
+// preImagesEnabled checks whether the collection records pre-images for
+// change streams, see the changeStreamPreAndPostImages option of MongoDB 6.0
+func preImagesEnabled(ctx context.Context, db *mongo.Database, collection string) (bool, error) {
+    specifications, err := db.ListCollectionSpecifications(ctx, bson.D{{Key: "name", Value: collection}})
+    if err != nil {
+        return false, err
+    }
+    if len(specifications) == 0 || specifications[0].Options == nil {
+        return false, nil
+    }
+    enabled, ok := specifications[0].Options.Lookup("changeStreamPreAndPostImages", "enabled").BooleanOK()
+    return ok && enabled, nil
+}
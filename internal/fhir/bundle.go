@@ -0,0 +1,96 @@
+package fhir
+
+import (
+	"strings"
+	"time"
+)
+
+type BundleLink struct {
+	// Relation is self, next, previous, first or last
+	Relation string `json:"relation"`
+	Url      string `json:"url"`
+}
+
+type BundleSearch struct {
+	// Mode is match, include or outcome
+	Mode string `json:"mode,omitempty"`
+}
+
+type BundleEntry struct {
+	FullUrl  string        `json:"fullUrl,omitempty"`
+	Resource interface{}   `json:"resource"`
+	Search   *BundleSearch `json:"search,omitempty"`
+}
+
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Timestamp    time.Time     `json:"timestamp"`
+	Total        *int64        `json:"total,omitempty"`
+	Link         []BundleLink  `json:"link,omitempty"`
+	Entry        []BundleEntry `json:"entry"`
+}
+
+// NewSearchSet creates bundle of search results, total is the number of all
+// matches, not only of the entries on the page
+func NewSearchSet(total int64) *Bundle {
+	return &Bundle{
+		ResourceType: "Bundle",
+		Type:         "searchset",
+		Timestamp:    time.Now().UTC(),
+		Total:        &total,
+		Entry:        []BundleEntry{},
+	}
+}
+
+// AddMatch appends the resource matching the search, the full URL is the
+// base URL followed by resource type and id
+func (this *Bundle) AddMatch(baseUrl string, resourceType string, id string, resource interface{}) {
+	this.Entry = append(this.Entry, BundleEntry{
+		FullUrl:  baseUrl + "/" + resourceType + "/" + id,
+		Resource: resource,
+		Search:   &BundleSearch{Mode: "match"},
+	})
+}
+
+// AddLink appends link to the bundle
+func (this *Bundle) AddLink(relation string, url string) {
+	this.Link = append(this.Link, BundleLink{Relation: relation, Url: url})
+}
+
+type OperationOutcomeIssue struct {
+	// Severity is fatal, error, warning or information
+	Severity string `json:"severity"`
+	// Code is from http://hl7.org/fhir/issue-type, e.g. invalid, not-found, conflict, exception
+	Code        string `json:"code"`
+	Diagnostics string `json:"diagnostics,omitempty"`
+}
+
+type OperationOutcome struct {
+	ResourceType string                  `json:"resourceType"`
+	Issue        []OperationOutcomeIssue `json:"issue"`
+}
+
+// NewOperationOutcome creates outcome with single error issue
+func NewOperationOutcome(code string, diagnostics string) *OperationOutcome {
+	return &OperationOutcome{
+		ResourceType: "OperationOutcome",
+		Issue: []OperationOutcomeIssue{
+			{Severity: "error", Code: code, Diagnostics: diagnostics},
+		},
+	}
+}
+
+// NewReference returns relative reference of the resource, e.g. Patient/123
+func NewReference(resourceType string, id string, display string) Reference {
+	return Reference{Reference: resourceType + "/" + id, Display: display}
+}
+
+// ParseReference returns id of the relative or absolute reference of the resource type
+func ParseReference(reference string, resourceType string) (string, bool) {
+	parts := strings.Split(strings.TrimSuffix(reference, "/"), "/")
+	if len(parts) < 2 || parts[len(parts)-2] != resourceType || parts[len(parts)-1] == "" {
+		return "", false
+	}
+	return parts[len(parts)-1], true
+}
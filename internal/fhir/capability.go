@@ -0,0 +1,57 @@
+package fhir
+
+import (
+	"time"
+)
+
+type CapabilityStatementSearchParam struct {
+	Name string `json:"name"`
+	// Type is number, date, string, token, reference, composite, quantity, uri or special
+	Type string `json:"type"`
+}
+
+type CapabilityStatementInteraction struct {
+	// Code is read, vread, update, patch, delete, history-instance,
+	// history-type, create or search-type
+	Code string `json:"code"`
+}
+
+type CapabilityStatementOperation struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+type CapabilityStatementResource struct {
+	Type        string                           `json:"type"`
+	Interaction []CapabilityStatementInteraction `json:"interaction,omitempty"`
+	SearchParam []CapabilityStatementSearchParam `json:"searchParam,omitempty"`
+	Operation   []CapabilityStatementOperation   `json:"operation,omitempty"`
+}
+
+type CapabilityStatementRest struct {
+	Mode     string                        `json:"mode"`
+	Resource []CapabilityStatementResource `json:"resource"`
+}
+
+type CapabilityStatement struct {
+	ResourceType string                    `json:"resourceType"`
+	Status       string                    `json:"status"`
+	Date         time.Time                 `json:"date"`
+	Kind         string                    `json:"kind"`
+	FhirVersion  string                    `json:"fhirVersion"`
+	Format       []string                  `json:"format"`
+	Rest         []CapabilityStatementRest `json:"rest"`
+}
+
+// NewCapabilityStatement describes server supporting the resources in JSON format
+func NewCapabilityStatement(resources ...CapabilityStatementResource) *CapabilityStatement {
+	return &CapabilityStatement{
+		ResourceType: "CapabilityStatement",
+		Status:       "active",
+		Date:         time.Now().UTC(),
+		Kind:         "instance",
+		FhirVersion:  Version,
+		Format:       []string{"json"},
+		Rest:         []CapabilityStatementRest{{Mode: "server", Resource: resources}},
+	}
+}
@@ -0,0 +1,191 @@
+// Package fhir contains the subset of HL7 FHIR R4 resources exposed by the
+// reservation service, see https://hl7.org/fhir/R4/
+package fhir
+
+import (
+	"time"
+)
+
+// ContentType of FHIR JSON documents
+const ContentType = "application/fhir+json; charset=utf-8"
+
+// Version of FHIR implemented by the resources
+const Version = "4.0.1"
+
+// Code systems used by the resources
+const (
+	SystemBCP47                = "urn:ietf:bcp:47"
+	SystemExaminationType      = "urn:reservation:examination-type"
+	SystemParticipationType    = "http://terminology.hl7.org/CodeSystem/v3-ParticipationType"
+	SystemLocationPhysicalType = "http://terminology.hl7.org/CodeSystem/location-physical-type"
+)
+
+type Meta struct {
+	VersionId   string     `json:"versionId,omitempty"`
+	LastUpdated *time.Time `json:"lastUpdated,omitempty"`
+}
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+// Code returns the first code of the system, or empty string when there is none
+func (this *CodeableConcept) Code(system string) string {
+	for _, coding := range this.Coding {
+		if coding.System == system || system == "" {
+			return coding.Code
+		}
+	}
+	return ""
+}
+
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+type HumanName struct {
+	Text   string   `json:"text,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+}
+
+type ContactPoint struct {
+	// System is phone, fax, email, pager, url, sms or other
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Use    string `json:"use,omitempty"`
+}
+
+type Address struct {
+	Text       string   `json:"text,omitempty"`
+	Line       []string `json:"line,omitempty"`
+	City       string   `json:"city,omitempty"`
+	PostalCode string   `json:"postalCode,omitempty"`
+	Country    string   `json:"country,omitempty"`
+}
+
+type PatientCommunication struct {
+	Language  CodeableConcept `json:"language"`
+	Preferred bool            `json:"preferred,omitempty"`
+}
+
+type PatientContact struct {
+	Relationship []CodeableConcept `json:"relationship,omitempty"`
+	Name         *HumanName        `json:"name,omitempty"`
+	Telecom      []ContactPoint    `json:"telecom,omitempty"`
+}
+
+type Patient struct {
+	ResourceType  string                 `json:"resourceType"`
+	Id            string                 `json:"id,omitempty"`
+	Meta          *Meta                  `json:"meta,omitempty"`
+	Name          []HumanName            `json:"name,omitempty"`
+	Telecom       []ContactPoint         `json:"telecom,omitempty"`
+	Gender        string                 `json:"gender,omitempty"`
+	BirthDate     string                 `json:"birthDate,omitempty"`
+	Address       []Address              `json:"address,omitempty"`
+	Contact       []PatientContact       `json:"contact,omitempty"`
+	Communication []PatientCommunication `json:"communication,omitempty"`
+}
+
+type AvailableTime struct {
+	// DaysOfWeek are mon, tue, wed, thu, fri, sat or sun
+	DaysOfWeek         []string `json:"daysOfWeek,omitempty"`
+	AllDay             bool     `json:"allDay,omitempty"`
+	AvailableStartTime string   `json:"availableStartTime,omitempty"`
+	AvailableEndTime   string   `json:"availableEndTime,omitempty"`
+}
+
+type LocationHoursOfOperation struct {
+	DaysOfWeek  []string `json:"daysOfWeek,omitempty"`
+	AllDay      bool     `json:"allDay,omitempty"`
+	OpeningTime string   `json:"openingTime,omitempty"`
+	ClosingTime string   `json:"closingTime,omitempty"`
+}
+
+type Location struct {
+	ResourceType     string                     `json:"resourceType"`
+	Id               string                     `json:"id,omitempty"`
+	Status           string                     `json:"status,omitempty"`
+	Name             string                     `json:"name,omitempty"`
+	Mode             string                     `json:"mode,omitempty"`
+	Address          *Address                   `json:"address,omitempty"`
+	PhysicalType     *CodeableConcept           `json:"physicalType,omitempty"`
+	HoursOfOperation []LocationHoursOfOperation `json:"hoursOfOperation,omitempty"`
+}
+
+type HealthcareService struct {
+	ResourceType  string            `json:"resourceType"`
+	Id            string            `json:"id,omitempty"`
+	Active        bool              `json:"active"`
+	Name          string            `json:"name,omitempty"`
+	Location      []Reference       `json:"location,omitempty"`
+	Type          []CodeableConcept `json:"type,omitempty"`
+	AvailableTime []AvailableTime   `json:"availableTime,omitempty"`
+}
+
+type Schedule struct {
+	ResourceType string            `json:"resourceType"`
+	Id           string            `json:"id,omitempty"`
+	Active       bool              `json:"active"`
+	ServiceType  []CodeableConcept `json:"serviceType,omitempty"`
+	Actor        []Reference       `json:"actor"`
+}
+
+type Slot struct {
+	ResourceType string            `json:"resourceType"`
+	Id           string            `json:"id,omitempty"`
+	ServiceType  []CodeableConcept `json:"serviceType,omitempty"`
+	Schedule     Reference         `json:"schedule"`
+	// Status is busy, free, busy-unavailable, busy-tentative or entered-in-error
+	Status string    `json:"status"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+type AppointmentParticipant struct {
+	Type  []CodeableConcept `json:"type,omitempty"`
+	Actor *Reference        `json:"actor,omitempty"`
+	// Required is required, optional or information-only
+	Required string `json:"required,omitempty"`
+	// Status is accepted, declined, tentative or needs-action
+	Status string `json:"status"`
+}
+
+type Appointment struct {
+	ResourceType string `json:"resourceType"`
+	Id           string `json:"id,omitempty"`
+	Meta         *Meta  `json:"meta,omitempty"`
+	// Status is proposed, pending, booked, arrived, fulfilled, cancelled, noshow,
+	// entered-in-error, checked-in or waitlist
+	Status      string                   `json:"status"`
+	ServiceType []CodeableConcept        `json:"serviceType,omitempty"`
+	Description string                   `json:"description,omitempty"`
+	Start       *time.Time               `json:"start,omitempty"`
+	End         *time.Time               `json:"end,omitempty"`
+	Slot        []Reference              `json:"slot,omitempty"`
+	Created     *time.Time               `json:"created,omitempty"`
+	Comment     string                   `json:"comment,omitempty"`
+	Participant []AppointmentParticipant `json:"participant"`
+}
+
+// Actor returns the reference of the first participant of the resource type
+func (this *Appointment) Actor(resourceType string) (string, bool) {
+	for _, participant := range this.Participant {
+		if participant.Actor == nil {
+			continue
+		}
+		if id, ok := ParseReference(participant.Actor.Reference, resourceType); ok {
+			return id, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,67 @@
+package fhir
+
+import (
+	"fmt"
+	"time"
+)
+
+// DateParam is value of the date search parameter, see
+// https://hl7.org/fhir/R4/search.html#date
+type DateParam struct {
+	// Prefix is eq, ne, gt, lt, ge, le, sa, eb or ap, supported are eq, gt, lt, ge and le
+	Prefix string
+	// Lower and Upper bound the range implied by precision of the value,
+	// e.g. 2024-05-01 is [2024-05-01T00:00, 2024-05-02T00:00)
+	Lower time.Time
+	Upper time.Time
+}
+
+var dateParamLayouts = []struct {
+	layout    string
+	precision func(time.Time) time.Time
+}{
+	{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{"2006-01-02T15:04Z07:00", func(t time.Time) time.Time { return t.Add(time.Minute) }},
+	{time.RFC3339, func(t time.Time) time.Time { return t.Add(time.Second) }},
+}
+
+// ParseDateParam parses the date search parameter, dates without time zone are in UTC
+func ParseDateParam(value string) (DateParam, error) {
+	param := DateParam{Prefix: "eq"}
+	if len(value) > 2 && value[0] >= 'a' && value[0] <= 'z' {
+		param.Prefix = value[:2]
+		value = value[2:]
+	}
+	switch param.Prefix {
+	case "eq", "gt", "lt", "ge", "le":
+	default:
+		return param, fmt.Errorf("unsupported date prefix %v", param.Prefix)
+	}
+
+	for _, candidate := range dateParamLayouts {
+		if lower, err := time.Parse(candidate.layout, value); err == nil {
+			param.Lower = lower.UTC()
+			param.Upper = candidate.precision(lower).UTC()
+			return param, nil
+		}
+	}
+	return param, fmt.Errorf("invalid date %v", value)
+}
+
+// Contains checks if the instant matches the parameter
+func (this DateParam) Contains(t time.Time) bool {
+	switch this.Prefix {
+	case "gt":
+		return !t.Before(this.Upper)
+	case "ge":
+		return !t.Before(this.Lower)
+	case "lt":
+		return t.Before(this.Lower)
+	case "le":
+		return t.Before(this.Upper)
+	default:
+		return !t.Before(this.Lower) && t.Before(this.Upper)
+	}
+}
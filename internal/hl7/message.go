@@ -0,0 +1,163 @@
+// Package hl7 builds and transports HL7 v2 messages in the ER7 (pipe
+// delimited) encoding, see https://www.hl7.org/implement/standards/product_brief.cfm?product_id=185
+package hl7
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ContentType of HL7 v2 messages in ER7 encoding
+const ContentType = "x-application/hl7-v2+er7; charset=utf-8"
+
+// Version of HL7 v2 written to MSH-12
+const Version = "2.5.1"
+
+const (
+	fieldSeparator     = "|"
+	encodingCharacters = `^~\&`
+	segmentSeparator   = "\r"
+)
+
+// Segment is a segment name followed by its encoded fields, Fields[0] is
+// field 1. For MSH the fields start at MSH-3, MSH-1 and MSH-2 are the
+// separators written by Encode.
+type Segment struct {
+	Name   string
+	Fields []string
+}
+
+// Message is a sequence of segments starting with MSH
+type Message struct {
+	Segments []Segment
+}
+
+// Add appends segment with the encoded fields
+func (this *Message) Add(name string, fields ...string) {
+	this.Segments = append(this.Segments, Segment{Name: name, Fields: fields})
+}
+
+// Encode writes the message in ER7 encoding, trailing empty fields are omitted
+func (this *Message) Encode() string {
+	segments := make([]string, 0, len(this.Segments))
+	for _, segment := range this.Segments {
+		fields := segment.Fields
+		for len(fields) > 0 && fields[len(fields)-1] == "" {
+			fields = fields[:len(fields)-1]
+		}
+		prefix := segment.Name
+		if segment.Name == "MSH" {
+			prefix += fieldSeparator + encodingCharacters
+		}
+		segments = append(segments, strings.Join(append([]string{prefix}, fields...), fieldSeparator))
+	}
+	return strings.Join(segments, segmentSeparator) + segmentSeparator
+}
+
+// Field returns the encoded field of the first segment with the name, MSH
+// fields are numbered as in the standard, so MSH-10 is Field("MSH", 10)
+func (this *Message) Field(name string, field int) string {
+	for _, segment := range this.Segments {
+		if segment.Name != name {
+			continue
+		}
+		index := field - 1
+		if name == "MSH" {
+			index = field - 3
+		}
+		if index < 0 || index >= len(segment.Fields) {
+			return ""
+		}
+		return segment.Fields[index]
+	}
+	return ""
+}
+
+// Parse splits the ER7 message into segments and fields, the encoding
+// characters must be the default ones
+func Parse(message string) (*Message, error) {
+	message = strings.ReplaceAll(message, "\n", segmentSeparator)
+	if !strings.HasPrefix(message, "MSH"+fieldSeparator+encodingCharacters) {
+		return nil, fmt.Errorf("message must start with MSH segment using default encoding characters")
+	}
+
+	parsed := &Message{}
+	for _, line := range strings.Split(message, segmentSeparator) {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, fieldSeparator)
+		if fields[0] == "MSH" {
+			// skip MSH-2, MSH-1 is the separator itself
+			fields = append([]string{fields[0]}, fields[2:]...)
+		}
+		parsed.Add(fields[0], fields[1:]...)
+	}
+	return parsed, nil
+}
+
+var escaper = strings.NewReplacer(
+	`\`, `\E\`,
+	`|`, `\F\`,
+	`^`, `\S\`,
+	`&`, `\T\`,
+	`~`, `\R\`,
+	"\r", `\X0D\`,
+	"\n", `\X0A\`,
+)
+
+// Escape encodes the delimiters in the text value
+func Escape(value string) string {
+	return escaper.Replace(value)
+}
+
+var unescaper = strings.NewReplacer(
+	`\E\`, `\`,
+	`\F\`, `|`,
+	`\S\`, `^`,
+	`\T\`, `&`,
+	`\R\`, `~`,
+	`\X0D\`, "\r",
+	`\X0A\`, "\n",
+)
+
+// Unescape decodes the delimiters in the encoded text value
+func Unescape(value string) string {
+	return unescaper.Replace(value)
+}
+
+// Components escapes the components and joins them into field, trailing
+// empty components are omitted
+func Components(components ...string) string {
+	for len(components) > 0 && components[len(components)-1] == "" {
+		components = components[:len(components)-1]
+	}
+	escaped := make([]string, len(components))
+	for i, component := range components {
+		escaped[i] = Escape(component)
+	}
+	return strings.Join(escaped, "^")
+}
+
+// Component returns the unescaped component of the encoded field, numbered from 1
+func Component(field string, component int) string {
+	components := strings.Split(field, "^")
+	if component < 1 || component > len(components) {
+		return ""
+	}
+	return Unescape(components[component-1])
+}
+
+// Timestamp formats the time as DTM with seconds and time zone offset
+func Timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("20060102150405-0700")
+}
+
+// Date formats the ISO date (YYYY-MM-DD) as DT
+func Date(isoDate string) string {
+	return strings.ReplaceAll(isoDate, "-", "")
+}
@@ -0,0 +1,157 @@
+package hl7
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+// MLLP frame delimiters, see HL7 v2 Minimal Lower Layer Protocol
+const (
+	startBlock     = 0x0b
+	endBlock       = 0x1c
+	carriageReturn = 0x0d
+)
+
+// Sender delivers HL7 messages to the receiving system
+type Sender interface {
+	// Send delivers the message and returns error unless the receiver accepted it
+	Send(ctx context.Context, message string) error
+}
+
+// MLLPSender sends messages over TCP using MLLP and waits for the ACK
+type MLLPSender struct {
+	// Address is host:port of the MLLP listener
+	Address string
+	// Timeout of connecting and waiting for the ACK
+	Timeout time.Duration
+}
+
+// NewMLLPSender creates sender to the MLLP listener at the address
+func NewMLLPSender(address string, timeout time.Duration) Sender {
+	return &MLLPSender{Address: address, Timeout: timeout}
+}
+
+// Send opens connection, sends the framed message and checks MSA-1 of the ACK
+func (this *MLLPSender) Send(ctx context.Context, message string) error {
+	ctx, cancel := context.WithTimeout(ctx, this.Timeout)
+	defer cancel()
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", this.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if err := WriteFrame(conn, message); err != nil {
+		return err
+	}
+	response, err := ReadFrame(bufio.NewReader(conn))
+	if err != nil {
+		return fmt.Errorf("failed to read ACK: %w", err)
+	}
+
+	ack, err := Parse(response)
+	if err != nil {
+		return fmt.Errorf("invalid ACK: %w", err)
+	}
+	switch code := ack.Field("MSA", 1); code {
+	case "AA", "CA":
+		return nil
+	default:
+		return fmt.Errorf("message rejected with %v: %v", code, Unescape(ack.Field("MSA", 3)))
+	}
+}
+
+// WriteFrame writes the message enclosed in MLLP frame
+func WriteFrame(w io.Writer, message string) error {
+	frame := make([]byte, 0, len(message)+3)
+	frame = append(frame, startBlock)
+	frame = append(frame, message...)
+	frame = append(frame, endBlock, carriageReturn)
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadFrame reads the next MLLP frame and returns the enclosed message
+func ReadFrame(r *bufio.Reader) (string, error) {
+	// skip bytes before the start of the frame
+	if _, err := r.ReadBytes(startBlock); err != nil {
+		return "", err
+	}
+	content, err := r.ReadBytes(endBlock)
+	if err != nil {
+		return "", err
+	}
+	if next, err := r.ReadByte(); err != nil || next != carriageReturn {
+		return "", fmt.Errorf("frame is not terminated by carriage return")
+	}
+	return string(bytes.TrimSuffix(content, []byte{endBlock})), nil
+}
+
+// NewAck creates the acknowledgement of the message with the code, e.g. AA or AE
+func NewAck(message *Message, code string, text string, now time.Time) string {
+	ack := &Message{}
+	ack.Add("MSH",
+		message.Field("MSH", 5), message.Field("MSH", 6),
+		message.Field("MSH", 3), message.Field("MSH", 4),
+		Timestamp(now), "",
+		Components("ACK", Component(message.Field("MSH", 9), 2), "ACK"),
+		"ACK"+message.Field("MSH", 10),
+		message.Field("MSH", 11),
+		Version,
+	)
+	ack.Add("MSA", code, message.Field("MSH", 10), Escape(text))
+	return ack.Encode()
+}
+
+// ServeMLLP accepts connections on the listener and passes received messages
+// to the handler. The message is acknowledged with AA, or with AE carrying
+// the error returned by the handler.
+func ServeMLLP(listener net.Listener, handler func(message *Message) error) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go serveMLLPConn(conn, handler)
+	}
+}
+
+func serveMLLPConn(conn net.Conn, handler func(message *Message) error) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		content, err := ReadFrame(reader)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Failed to read MLLP frame from %v: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		message, err := Parse(content)
+		if err != nil {
+			log.Printf("Failed to parse HL7 message from %v: %v", conn.RemoteAddr(), err)
+			return
+		}
+
+		code, text := "AA", ""
+		if err := handler(message); err != nil {
+			code, text = "AE", err.Error()
+		}
+		if err := WriteFrame(conn, NewAck(message, code, text, time.Now())); err != nil {
+			log.Printf("Failed to acknowledge HL7 message to %v: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package hl7
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pipeListener hands out the server ends of in-memory pipes to ServeMLLP
+type pipeListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+func (this *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-this.conns:
+		return conn, nil
+	case <-this.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (this *pipeListener) Close() error {
+	this.once.Do(func() { close(this.closed) })
+	return nil
+}
+
+func (this *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// dial connects a new client to the server, the connection fails the test
+// instead of blocking forever
+func (this *pipeListener) dial(t *testing.T) net.Conn {
+	client, server := net.Pipe()
+	this.conns <- server
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func startMLLPServer(t *testing.T, handler func(message *Message) error) *pipeListener {
+	listener := &pipeListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+	served := make(chan error, 1)
+	go func() { served <- ServeMLLP(listener, handler) }()
+	t.Cleanup(func() {
+		listener.Close()
+		if err := <-served; !errors.Is(err, net.ErrClosed) {
+			t.Errorf("ServeMLLP() error = %v, want %v", err, net.ErrClosed)
+		}
+	})
+	return listener
+}
+
+func newTestMessage(controlId string) string {
+	message := NewMessage(Header{
+		SendingApplication:   "RESERVATION",
+		SendingFacility:      "WAC",
+		ReceivingApplication: "RIS",
+		ReceivingFacility:    "HOSPITAL",
+	}, "SIU", TriggerNewAppointment, "SIU_S12", controlId, time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC))
+	message.Add("SCH", Components("reservation-1", "WAC"))
+	return message.Encode()
+}
+
+// readAck reads the next frame from the server and parses the ACK
+func readAck(t *testing.T, reader *bufio.Reader) *Message {
+	t.Helper()
+	response, err := ReadFrame(reader)
+	if err != nil {
+		t.Fatalf("ReadFrame() error = %v", err)
+	}
+	ack, err := Parse(response)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	return ack
+}
+
+func TestServeMLLPAcknowledges(t *testing.T) {
+	received := make(chan string, 2)
+	listener := startMLLPServer(t, func(message *Message) error {
+		received <- message.Field("MSH", 10)
+		return nil
+	})
+	conn := listener.dial(t)
+	reader := bufio.NewReader(conn)
+
+	// two messages on one connection, the first one preceded by noise
+	for i, controlId := range []string{"MSG00001", "MSG00002"} {
+		noise := ""
+		if i == 0 {
+			noise = "\r\n"
+		}
+		go func(frame string) {
+			conn.Write([]byte(noise))
+			WriteFrame(conn, frame)
+		}(newTestMessage(controlId))
+
+		ack := readAck(t, reader)
+		if got := <-received; got != controlId {
+			t.Errorf("handler received %q, want %q", got, controlId)
+		}
+		if got := ack.Field("MSA", 1); got != "AA" {
+			t.Errorf("MSA-1 = %q, want AA", got)
+		}
+		if got := ack.Field("MSA", 2); got != controlId {
+			t.Errorf("MSA-2 = %q, want %q", got, controlId)
+		}
+		if got := ack.Field("MSH", 9); got != "ACK^S12^ACK" {
+			t.Errorf("MSH-9 = %q, want ACK^S12^ACK", got)
+		}
+		if got, want := ack.Field("MSH", 5)+"|"+ack.Field("MSH", 6), "RESERVATION|WAC"; got != want {
+			t.Errorf("ACK receiver = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestServeMLLPRejects(t *testing.T) {
+	listener := startMLLPServer(t, func(message *Message) error {
+		return errors.New("unknown patient | 42")
+	})
+	conn := listener.dial(t)
+	reader := bufio.NewReader(conn)
+
+	go WriteFrame(conn, newTestMessage("MSG00003"))
+	ack := readAck(t, reader)
+	if got := ack.Field("MSA", 1); got != "AE" {
+		t.Errorf("MSA-1 = %q, want AE", got)
+	}
+	if got := Unescape(ack.Field("MSA", 3)); got != "unknown patient | 42" {
+		t.Errorf("MSA-3 = %q, want the handler error", got)
+	}
+}
+
+func TestServeMLLPClosesInvalidFrame(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+	}{
+		{name: "not terminated by carriage return", frame: "\x0b" + newTestMessage("MSG00004") + "\x1cX"},
+		{name: "not an HL7 message", frame: "\x0bhello\x1c\r"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			listener := startMLLPServer(t, func(message *Message) error {
+				t.Error("handler called with invalid frame")
+				return nil
+			})
+			conn := listener.dial(t)
+
+			go conn.Write([]byte(test.frame))
+			if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+				t.Errorf("Read() error = %v, want the connection closed", err)
+			}
+		})
+	}
+}
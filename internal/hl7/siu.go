@@ -0,0 +1,46 @@
+package hl7
+
+import (
+	"time"
+)
+
+// SIU trigger events of scheduling messages
+const (
+	// TriggerNewAppointment notifies about booked appointment
+	TriggerNewAppointment = "S12"
+	// TriggerRescheduled notifies about moved appointment
+	TriggerRescheduled = "S13"
+	// TriggerCancelled notifies about cancelled appointment
+	TriggerCancelled = "S15"
+)
+
+// Header identifies the sending and receiving systems in MSH
+type Header struct {
+	SendingApplication   string
+	SendingFacility      string
+	ReceivingApplication string
+	ReceivingFacility    string
+	// ProcessingId is P for production, D for debugging or T for training
+	ProcessingId string
+}
+
+// NewMessage starts message with the MSH segment, messageType is e.g.
+// "SIU", trigger "S12" and structure "SIU_S12"
+func NewMessage(header Header, messageType string, trigger string, structure string, controlId string, now time.Time) *Message {
+	processingId := header.ProcessingId
+	if processingId == "" {
+		processingId = "P"
+	}
+
+	message := &Message{}
+	message.Add("MSH",
+		Escape(header.SendingApplication), Escape(header.SendingFacility),
+		Escape(header.ReceivingApplication), Escape(header.ReceivingFacility),
+		Timestamp(now), "",
+		Components(messageType, trigger, structure),
+		Escape(controlId),
+		processingId,
+		Version,
+	)
+	return message
+}
@@ -0,0 +1,142 @@
+// Package ical writes iCalendar (RFC 5545) documents with events
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const productId = "-//wac24-xbublavy-xskriba//Reservation API//EN"
+
+// maxLineOctets is the maximal length of content line without line break, longer lines are folded
+const maxLineOctets = 75
+
+// Methods of the calendar, see RFC 5546
+const (
+	MethodPublish = "PUBLISH"
+	MethodCancel  = "CANCEL"
+)
+
+// Event is VEVENT component of the calendar
+type Event struct {
+	// UID must be stable across updates of the same event
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	// Stamp is the time the event was last modified
+	Stamp time.Time
+	// Sequence must increase with every change of the event
+	Sequence  int
+	Cancelled bool
+}
+
+// Calendar is VCALENDAR object
+type Calendar struct {
+	Method string
+	// Name is shown by calendar clients for subscribed calendars
+	Name   string
+	Events []Event
+}
+
+// ContentType is the MIME type of iCalendar documents
+const ContentType = "text/calendar; charset=utf-8"
+
+// Encode writes the calendar to the writer
+func (this *Calendar) Encode(writer io.Writer) error {
+	out := &contentWriter{writer: bufio.NewWriter(writer)}
+	out.line("BEGIN", "VCALENDAR")
+	out.line("VERSION", "2.0")
+	out.line("PRODID", productId)
+	out.line("CALSCALE", "GREGORIAN")
+	if this.Method != "" {
+		out.line("METHOD", this.Method)
+	}
+	if this.Name != "" {
+		out.line("X-WR-CALNAME", escapeText(this.Name))
+	}
+	for _, event := range this.Events {
+		out.line("BEGIN", "VEVENT")
+		out.line("UID", escapeText(event.UID))
+		out.line("DTSTAMP", formatTime(event.Stamp))
+		out.line("DTSTART", formatTime(event.Start))
+		out.line("DTEND", formatTime(event.End))
+		out.line("SEQUENCE", fmt.Sprint(event.Sequence))
+		out.line("SUMMARY", escapeText(event.Summary))
+		if event.Location != "" {
+			out.line("LOCATION", escapeText(event.Location))
+		}
+		if event.Description != "" {
+			out.line("DESCRIPTION", escapeText(event.Description))
+		}
+		if event.Cancelled {
+			out.line("STATUS", "CANCELLED")
+		} else {
+			out.line("STATUS", "CONFIRMED")
+		}
+		out.line("END", "VEVENT")
+	}
+	out.line("END", "VCALENDAR")
+	if out.err != nil {
+		return out.err
+	}
+	return out.writer.Flush()
+}
+
+// String returns the calendar as text
+func (this *Calendar) String() string {
+	var text strings.Builder
+	this.Encode(&text)
+	return text.String()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	"\r", "",
+)
+
+func escapeText(text string) string {
+	return textEscaper.Replace(text)
+}
+
+type contentWriter struct {
+	writer *bufio.Writer
+	err    error
+}
+
+// line writes the content line folded to lines of at most 75 octets,
+// continuation lines start with a space
+func (this *contentWriter) line(name string, value string) {
+	if this.err != nil {
+		return
+	}
+	text := name + ":" + value
+	limit := maxLineOctets
+	for len(text) > limit {
+		cut := limit
+		// do not split multi-byte characters
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		if _, this.err = this.writer.WriteString(text[:cut] + "\r\n "); this.err != nil {
+			return
+		}
+		text = text[cut:]
+		limit = maxLineOctets - 1
+	}
+	_, this.err = this.writer.WriteString(text + "\r\n")
+}
@@ -0,0 +1,202 @@
+package ical
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// foldLine writes one content line and returns the folded output
+func foldLine(t *testing.T, name string, value string) string {
+	t.Helper()
+	var text strings.Builder
+	out := &contentWriter{writer: bufio.NewWriter(&text)}
+	out.line(name, value)
+	if out.err != nil {
+		t.Fatalf("line() error = %v", out.err)
+	}
+	out.writer.Flush()
+	return text.String()
+}
+
+func TestContentLineFolding(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		// lines are the expected physical lines without CRLF
+		lines []string
+	}{
+		{
+			name:  "short line",
+			value: "Röntgen",
+			lines: []string{"SUMMARY:Röntgen"},
+		},
+		{
+			name:  "exactly 75 octets",
+			value: strings.Repeat("a", 67),
+			lines: []string{"SUMMARY:" + strings.Repeat("a", 67)},
+		},
+		{
+			name:  "ascii",
+			value: strings.Repeat("a", 67+74+10),
+			lines: []string{
+				"SUMMARY:" + strings.Repeat("a", 67),
+				" " + strings.Repeat("a", 74),
+				" " + strings.Repeat("a", 10),
+			},
+		},
+		{
+			// the two-octet č would end at octet 76
+			name:  "two-octet character at the boundary",
+			value: strings.Repeat("a", 66) + "čb",
+			lines: []string{
+				"SUMMARY:" + strings.Repeat("a", 66),
+				" čb",
+			},
+		},
+		{
+			// the four-octet emoji starts at octet 74
+			name:  "four-octet character at the boundary",
+			value: strings.Repeat("a", 65) + "🩺" + "b",
+			lines: []string{
+				"SUMMARY:" + strings.Repeat("a", 65),
+				" 🩺b",
+			},
+		},
+		{
+			name:  "continuation lines",
+			value: strings.Repeat("ž", 80),
+			lines: []string{
+				"SUMMARY:" + strings.Repeat("ž", 33),
+				" " + strings.Repeat("ž", 37),
+				" " + strings.Repeat("ž", 10),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := foldLine(t, "SUMMARY", test.value)
+			want := strings.Join(test.lines, "\r\n") + "\r\n"
+			if got != want {
+				t.Fatalf("line() = %q, want %q", got, want)
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n") {
+				if len(line) > maxLineOctets {
+					t.Errorf("line %q has %v octets, want at most %v", line, len(line), maxLineOctets)
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line %q splits a character", line)
+				}
+			}
+		})
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "plain", text: "MRI", want: "MRI"},
+		{name: "backslash", text: `C:\scans`, want: `C:\\scans`},
+		{name: "semicolon", text: "fasting; no water", want: `fasting\; no water`},
+		{name: "comma", text: "Bratislava, Slovakia", want: `Bratislava\, Slovakia`},
+		{name: "newline", text: "first\nsecond", want: `first\nsecond`},
+		{name: "crlf", text: "first\r\nsecond\r", want: `first\nsecond`},
+		{name: "escaped sequence", text: `\n;`, want: `\\n\;`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := escapeText(test.text); got != test.want {
+				t.Errorf("escapeText(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCalendarEncode(t *testing.T) {
+	start := time.Date(2024, 5, 6, 10, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	event := Event{
+		UID:         "reservation-1",
+		Summary:     "X-ray, chest",
+		Description: "Bring the referral;\nno jewellery",
+		Location:    "Ambulance 1",
+		Start:       start,
+		End:         start.Add(time.Hour),
+		Stamp:       start.Add(-24 * time.Hour),
+		Sequence:    2,
+	}
+	cancelled := event
+	cancelled.Cancelled = true
+
+	tests := []struct {
+		name     string
+		calendar Calendar
+		want     []string
+		absent   []string
+	}{
+		{
+			name:     "published",
+			calendar: Calendar{Method: MethodPublish, Name: "Patient, Jane", Events: []Event{event}},
+			want: []string{
+				"METHOD:PUBLISH",
+				`X-WR-CALNAME:Patient\, Jane`,
+				"UID:reservation-1",
+				"DTSTAMP:20240505T080000Z",
+				"DTSTART:20240506T080000Z",
+				"DTEND:20240506T090000Z",
+				"SEQUENCE:2",
+				`SUMMARY:X-ray\, chest`,
+				`DESCRIPTION:Bring the referral\;\nno jewellery`,
+				"STATUS:CONFIRMED",
+			},
+			absent: []string{"STATUS:CANCELLED"},
+		},
+		{
+			name:     "cancelled",
+			calendar: Calendar{Method: MethodCancel, Events: []Event{cancelled}},
+			want: []string{
+				"METHOD:CANCEL",
+				"UID:reservation-1",
+				"SEQUENCE:2",
+				"STATUS:CANCELLED",
+			},
+			absent: []string{"STATUS:CONFIRMED", "X-WR-CALNAME"},
+		},
+		{
+			name:     "without method",
+			calendar: Calendar{},
+			want:     []string{"BEGIN:VCALENDAR", "VERSION:2.0", "END:VCALENDAR"},
+			absent:   []string{"METHOD", "BEGIN:VEVENT"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			text := test.calendar.String()
+			if !strings.HasPrefix(text, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(text, "END:VCALENDAR\r\n") {
+				t.Errorf("calendar is not enclosed in VCALENDAR:\n%v", text)
+			}
+			lines := strings.Split(text, "\r\n")
+			for _, want := range test.want {
+				found := false
+				for _, line := range lines {
+					found = found || line == want
+				}
+				if !found {
+					t.Errorf("calendar has no line %q:\n%v", want, text)
+				}
+			}
+			for _, absent := range test.absent {
+				if strings.Contains(text, absent) {
+					t.Errorf("calendar contains %q:\n%v", absent, text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+// Package idempotency makes POST requests safe to retry. The first response
+// to the request with the Idempotency-Key header is stored and replayed
+// for the retries, so retried requests do not create duplicates.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/ratelimit"
+)
+
+// Header carries the key chosen by the client, e.g. a random UUID
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set on the replayed responses
+const ReplayedHeader = "Idempotent-Replayed"
+
+// maxKeyLength limits the length of the key
+const maxKeyLength = 255
+
+// defaultMaxBodyBytes limits the request body read for the fingerprint,
+// it is large enough for the patient import
+const defaultMaxBodyBytes = 8 << 20
+
+// Status of the stored request
+const (
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+)
+
+// replayedHeaders are the response headers stored with the response
+var replayedHeaders = []string{"Content-Type", "Location", "X-Total-Count"}
+
+// Record is the stored response of the request with the key
+type Record struct {
+	// Id is the hash of the client, the request path and the key
+	Id string
+	// Fingerprint is the hash of the request, retries must match it
+	Fingerprint string
+	Status      string
+	StatusCode  int
+	Headers     map[string]string
+	Body        []byte
+	CreatedAt   time.Time
+	// ExpiresAt is when the key may be used again, see internal/migrations
+	ExpiresAt time.Time
+}
+
+// Middleware stores the responses of the POST requests with the key
+type Middleware struct {
+	RecordDB db_service.DbService[Record]
+	// TTL is how long the responses are replayed
+	TTL time.Duration
+	// LockTimeout is how long the first request may be processed before a
+	// retry takes over, e.g. when the replica crashed
+	LockTimeout time.Duration
+	// Identity scopes the keys by the client, so clients cannot replay
+	// responses of each other. Keys are shared by all clients when nil.
+	Identity *ratelimit.Identity
+	// MaxBodyBytes limits the request body, defaultMaxBodyBytes when zero
+	MaxBodyBytes int64
+}
+
+// Handler replays the stored response of the key. The key is rejected with
+// 422 Unprocessable Entity when reused with a different request, and with
+// 409 Conflict while the first request is processed. Responses with
+// 5xx status are not stored, so the request can be retried.
+func (this *Middleware) Handler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(Header)
+		if ctx.Request.Method != http.MethodPost || key == "" {
+			ctx.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			ctx.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				gin.H{
+					"status":  "Bad Request",
+					"message": "Invalid Idempotency-Key",
+					"error":   "Idempotency-Key exceeds maximum length of 255 characters",
+				})
+			return
+		}
+
+		maxBodyBytes := this.MaxBodyBytes
+		if maxBodyBytes <= 0 {
+			maxBodyBytes = defaultMaxBodyBytes
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxBodyBytes))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			ctx.AbortWithStatusJSON(
+				http.StatusRequestEntityTooLarge,
+				gin.H{
+					"status":  "Request Entity Too Large",
+					"message": "Request body is too large",
+					"error":   fmt.Sprintf("request body exceeds maximum of %v bytes", maxBytesErr.Limit),
+				})
+			return
+		}
+		if err != nil {
+			ctx.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				gin.H{
+					"status":  "Bad Request",
+					"message": "Failed to read request body",
+					"error":   err.Error(),
+				})
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// keys are scoped by the client and the path, e.g. the patient of
+		// the reservation
+		client := ""
+		if this.Identity != nil {
+			client = this.Identity.Key(ctx)
+		}
+		id := hash([]byte(client), []byte(ctx.Request.URL.Path), []byte(key))
+		fingerprint := hash([]byte(ctx.Request.URL.RawQuery), []byte(ctx.ContentType()), body)
+
+		record, claimed, err := this.claim(ctx, id, fingerprint)
+		if err != nil {
+			ctx.AbortWithStatusJSON(
+				http.StatusBadGateway,
+				gin.H{
+					"status":  "Bad Gateway",
+					"message": "Failed to load Idempotency-Key from database",
+					"error":   err.Error(),
+				})
+			return
+		}
+
+		switch {
+		case claimed:
+			this.record(ctx, record)
+		case record.Fingerprint != fingerprint:
+			ctx.AbortWithStatusJSON(
+				http.StatusUnprocessableEntity,
+				gin.H{
+					"status":  "Unprocessable Entity",
+					"message": "Idempotency-Key was used with a different request",
+					"error":   "reuse of Idempotency-Key with a different payload",
+				})
+		case record.Status == StatusProcessing:
+			ctx.Header("Retry-After", "1")
+			ctx.AbortWithStatusJSON(
+				http.StatusConflict,
+				gin.H{
+					"status":  "Conflict",
+					"message": "Request with the Idempotency-Key is being processed",
+					"error":   "request in progress",
+				})
+		default:
+			for name, value := range record.Headers {
+				ctx.Header(name, value)
+			}
+			ctx.Header(ReplayedHeader, "true")
+			ctx.Status(record.StatusCode)
+			ctx.Writer.Write(record.Body)
+			ctx.Abort()
+		}
+	}
+}
+
+// claim creates the record of the key, or takes over the record whose
+// processing timed out. It returns the stored record when the key is taken.
+func (this *Middleware) claim(ctx *gin.Context, id string, fingerprint string) (*Record, bool, error) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	record := &Record{
+		Id:          id,
+		Fingerprint: fingerprint,
+		Status:      StatusProcessing,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(this.TTL),
+	}
+	err := this.RecordDB.CreateDocument(ctx, id, record)
+	if err == nil {
+		return record, true, nil
+	}
+	if err != db_service.ErrConflict {
+		return nil, false, err
+	}
+
+	stored, err := this.RecordDB.FindDocument(ctx, id)
+	if err == db_service.ErrNotFound {
+		// released or expired meanwhile
+		if err = this.RecordDB.CreateDocument(ctx, id, record); err == nil {
+			return record, true, nil
+		}
+		if err == db_service.ErrConflict {
+			stored, err = this.RecordDB.FindDocument(ctx, id)
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if stored.Status == StatusProcessing && stored.Fingerprint == fingerprint && now.Sub(stored.CreatedAt) > this.LockTimeout {
+		switch err := this.RecordDB.UpdateDocumentIf(ctx, id, db_service.And(
+			db_service.Eq("status", StatusProcessing),
+			db_service.Eq("createdat", stored.CreatedAt),
+		), record); err {
+		case nil:
+			return record, true, nil
+		case db_service.ErrNotFound:
+			// taken over by another retry
+		default:
+			return nil, false, err
+		}
+	}
+	return stored, false, nil
+}
+
+// record processes the request and stores its response
+func (this *Middleware) record(ctx *gin.Context, record *Record) {
+	writer := &recordingWriter{ResponseWriter: ctx.Writer}
+	ctx.Writer = writer
+	ctx.Next()
+
+	// the response is sent already, failures only prevent its replay
+	statusCode := writer.Status()
+	if statusCode >= http.StatusInternalServerError {
+		if err := this.RecordDB.DeleteDocument(ctx, record.Id); err != nil && err != db_service.ErrNotFound {
+			log.Printf("Failed to release Idempotency-Key %v: %v", record.Id, err)
+		}
+		return
+	}
+
+	record.Status = StatusCompleted
+	record.StatusCode = statusCode
+	record.Body = writer.body.Bytes()
+	record.Headers = map[string]string{}
+	for _, name := range replayedHeaders {
+		if value := writer.Header().Get(name); value != "" {
+			record.Headers[name] = value
+		}
+	}
+	if err := this.RecordDB.UpdateDocument(ctx, record.Id, record); err != nil {
+		log.Printf("Failed to store response of Idempotency-Key %v: %v", record.Id, err)
+	}
+}
+
+func hash(parts ...[]byte) string {
+	digest := sha256.New()
+	for _, part := range parts {
+		// length prefix keeps the parts apart
+		digest.Write([]byte{byte(len(part) >> 24), byte(len(part) >> 16), byte(len(part) >> 8), byte(len(part))})
+		digest.Write(part)
+	}
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+// recordingWriter keeps a copy of the response body
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (this *recordingWriter) Write(data []byte) (int, error) {
+	this.body.Write(data)
+	return this.ResponseWriter.Write(data)
+}
+
+func (this *recordingWriter) WriteString(data string) (int, error) {
+	this.body.WriteString(data)
+	return this.ResponseWriter.WriteString(data)
+}
@@ -0,0 +1,254 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/ratelimit"
+)
+
+// fakeRecordDB keeps the records in memory. UpdateDocumentIf succeeds only
+// for records still processed, as the takeover filter of the middleware
+// does in the database.
+type fakeRecordDB struct {
+	db_service.DbService[Record]
+	mutex   sync.Mutex
+	records map[string]Record
+}
+
+func newFakeRecordDB() *fakeRecordDB {
+	return &fakeRecordDB{records: map[string]Record{}}
+}
+
+func (this *fakeRecordDB) CreateDocument(ctx context.Context, id string, record *Record) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if _, exists := this.records[id]; exists {
+		return db_service.ErrConflict
+	}
+	this.records[id] = *record
+	return nil
+}
+
+func (this *fakeRecordDB) FindDocument(ctx context.Context, id string) (*Record, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	record, exists := this.records[id]
+	if !exists {
+		return nil, db_service.ErrNotFound
+	}
+	return &record, nil
+}
+
+func (this *fakeRecordDB) UpdateDocument(ctx context.Context, id string, record *Record) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if _, exists := this.records[id]; !exists {
+		return db_service.ErrNotFound
+	}
+	this.records[id] = *record
+	return nil
+}
+
+func (this *fakeRecordDB) UpdateDocumentIf(ctx context.Context, id string, filter db_service.Filter, record *Record) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if stored, exists := this.records[id]; !exists || stored.Status != StatusProcessing {
+		return db_service.ErrNotFound
+	}
+	this.records[id] = *record
+	return nil
+}
+
+func (this *fakeRecordDB) DeleteDocument(ctx context.Context, id string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if _, exists := this.records[id]; !exists {
+		return db_service.ErrNotFound
+	}
+	delete(this.records, id)
+	return nil
+}
+
+// age moves the creation of all records back, so their locks time out
+func (this *fakeRecordDB) age(duration time.Duration) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for id, record := range this.records {
+		record.CreatedAt = record.CreatedAt.Add(-duration)
+		this.records[id] = record
+	}
+}
+
+func newTestRequest(body string, client string) *http.Request {
+	request := httptest.NewRequest(http.MethodPost, "/api/patients/p1/reservations", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(Header, "key-1")
+	request.RemoteAddr = client + ":40000"
+	return request
+}
+
+func TestMiddlewareRetries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const body = `{"ambulanceId":"a1"}`
+	const client = "192.0.2.1"
+
+	tests := []struct {
+		name string
+		// statuses are the responses of the handler to consecutive calls
+		statuses []int
+		// retry is sent after the first request completed, or while it is
+		// processed when concurrent
+		retryBody   string
+		retryClient string
+		concurrent  bool
+		// stale lets the lock of the first request time out before the retry
+		stale        bool
+		wantStatus   int
+		wantCalls    int
+		wantReplayed bool
+	}{
+		{
+			name:         "replay",
+			statuses:     []int{http.StatusCreated},
+			retryBody:    body,
+			retryClient:  client,
+			wantStatus:   http.StatusCreated,
+			wantCalls:    1,
+			wantReplayed: true,
+		},
+		{
+			name:        "payload mismatch",
+			statuses:    []int{http.StatusCreated},
+			retryBody:   `{"ambulanceId":"a2"}`,
+			retryClient: client,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCalls:   1,
+		},
+		{
+			name:        "in progress",
+			statuses:    []int{http.StatusCreated},
+			retryBody:   body,
+			retryClient: client,
+			concurrent:  true,
+			wantStatus:  http.StatusConflict,
+			wantCalls:   1,
+		},
+		{
+			name:        "stale lock taken over",
+			statuses:    []int{http.StatusCreated, http.StatusCreated},
+			retryBody:   body,
+			retryClient: client,
+			concurrent:  true,
+			stale:       true,
+			wantStatus:  http.StatusCreated,
+			wantCalls:   2,
+		},
+		{
+			name:        "server error not stored",
+			statuses:    []int{http.StatusInternalServerError, http.StatusCreated},
+			retryBody:   body,
+			retryClient: client,
+			wantStatus:  http.StatusCreated,
+			wantCalls:   2,
+		},
+		{
+			name:         "client error stored",
+			statuses:     []int{http.StatusConflict, http.StatusCreated},
+			retryBody:    body,
+			retryClient:  client,
+			wantStatus:   http.StatusConflict,
+			wantCalls:    1,
+			wantReplayed: true,
+		},
+		{
+			name:        "keys scoped by client",
+			statuses:    []int{http.StatusCreated, http.StatusCreated},
+			retryBody:   body,
+			retryClient: "192.0.2.2",
+			wantStatus:  http.StatusCreated,
+			wantCalls:   2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := newFakeRecordDB()
+			middleware := &Middleware{RecordDB: db, TTL: time.Hour, LockTimeout: time.Minute, Identity: &ratelimit.Identity{}}
+			engine := gin.New()
+			engine.Use(middleware.Handler())
+
+			calls := 0
+			var retry *httptest.ResponseRecorder
+			engine.POST("/api/patients/:patientId/reservations", func(ctx *gin.Context) {
+				calls++
+				status := test.statuses[calls-1]
+				if calls == 1 && test.concurrent {
+					if test.stale {
+						db.age(time.Hour)
+					}
+					retry = httptest.NewRecorder()
+					engine.ServeHTTP(retry, newTestRequest(test.retryBody, test.retryClient))
+				}
+				ctx.Header("Location", fmt.Sprintf("/api/reservations/r%v", calls))
+				ctx.JSON(status, gin.H{"call": calls})
+			})
+
+			first := httptest.NewRecorder()
+			engine.ServeHTTP(first, newTestRequest(body, client))
+			if first.Code != test.statuses[0] {
+				t.Fatalf("first request status = %v, want %v", first.Code, test.statuses[0])
+			}
+			if !test.concurrent {
+				retry = httptest.NewRecorder()
+				engine.ServeHTTP(retry, newTestRequest(test.retryBody, test.retryClient))
+			}
+
+			if retry.Code != test.wantStatus {
+				t.Errorf("retry status = %v, want %v: %v", retry.Code, test.wantStatus, retry.Body.String())
+			}
+			if calls != test.wantCalls {
+				t.Errorf("handler called %v times, want %v", calls, test.wantCalls)
+			}
+			replayed := retry.Header().Get(ReplayedHeader) == "true"
+			if replayed != test.wantReplayed {
+				t.Errorf("retry replayed = %v, want %v", replayed, test.wantReplayed)
+			}
+			if replayed {
+				if retry.Body.String() != first.Body.String() {
+					t.Errorf("replayed body = %q, want %q", retry.Body.String(), first.Body.String())
+				}
+				if got, want := retry.Header().Get("Location"), first.Header().Get("Location"); got != want {
+					t.Errorf("replayed Location = %q, want %q", got, want)
+				}
+			}
+			if test.wantStatus == http.StatusConflict && !replayed && retry.Header().Get("Retry-After") == "" {
+				t.Errorf("request in progress has no Retry-After")
+			}
+		})
+	}
+}
+
+func TestMiddlewareLimitsBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	middleware := &Middleware{RecordDB: newFakeRecordDB(), TTL: time.Hour, LockTimeout: time.Minute, MaxBodyBytes: 16}
+	engine := gin.New()
+	engine.Use(middleware.Handler())
+	engine.POST("/api/patients/:patientId/reservations", func(ctx *gin.Context) {
+		t.Error("handler called with too large body")
+	})
+
+	response := httptest.NewRecorder()
+	engine.ServeHTTP(response, newTestRequest(strings.Repeat("x", 17), "192.0.2.1"))
+	if response.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %v, want %v", response.Code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,425 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// All lists the migrations of the reservation database. New migrations are
+// appended with increasing version, applied migrations must not be changed.
+var All = []db_service.Migration{
+	{
+		Version:     1,
+		Description: "unique id indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			for _, collection := range []string{"ambulance", "patient", "reservation"} {
+				// init-db.js used to create non-unique {id: 1} index which would conflict
+				if err := dropIndexIfExists(ctx, db, collection, "id_1"); err != nil {
+					return err
+				}
+				if err := ensureIndexes(ctx, db, collection, mongo.IndexModel{
+					Keys:    bson.D{{Key: "id", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("id_unique"),
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     2,
+		Description: "secondary indexes for reservation and ambulance lookups",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := ensureIndexes(ctx, db, "reservation",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "ambulanceid", Value: 1}, {Key: "start", Value: 1}},
+					Options: options.Index().SetName("ambulanceid_start"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "patientid", Value: 1}, {Key: "start", Value: 1}},
+					Options: options.Index().SetName("patientid_start"),
+				},
+			); err != nil {
+				return err
+			}
+			return ensureIndexes(ctx, db, "ambulance", mongo.IndexModel{
+				Keys:    bson.D{{Key: "medicalexaminations", Value: 1}},
+				Options: options.Index().SetName("medicalexaminations"),
+			})
+		},
+	},
+	{
+		Version:     3,
+		Description: "patient search indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// collation must match the one used by patient search queries
+			nameCollation := &options.Collation{Locale: "sk", Strength: 1}
+			return ensureIndexes(ctx, db, "patient",
+				mongo.IndexModel{
+					// language "none" disables stemming and stop words, text index
+					// matching is case and diacritics insensitive on its own
+					Keys: bson.D{{Key: "firstname", Value: "text"}, {Key: "lastname", Value: "text"}},
+					Options: options.Index().
+						SetName("name_text").
+						SetDefaultLanguage("none").
+						SetWeights(bson.D{{Key: "lastname", Value: 2}, {Key: "firstname", Value: 1}}),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "lastname", Value: 1}, {Key: "firstname", Value: 1}},
+					Options: options.Index().SetName("lastname_firstname_sk").SetCollation(nameCollation),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "firstname", Value: 1}},
+					Options: options.Index().SetName("firstname_sk").SetCollation(nameCollation),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "birthday", Value: 1}},
+					Options: options.Index().SetName("birthday"),
+				},
+			)
+		},
+	},
+	{
+		Version:     4,
+		Description: "ambulance address text index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return ensureIndexes(ctx, db, "ambulance", mongo.IndexModel{
+				Keys:    bson.D{{Key: "address", Value: "text"}},
+				Options: options.Index().SetName("address_text").SetDefaultLanguage("none"),
+			})
+		},
+	},
+	{
+		Version:     5,
+		Description: "reservation listing indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return ensureIndexes(ctx, db, "reservation",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "start", Value: 1}},
+					Options: options.Index().SetName("start"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "examinationtype", Value: 1}, {Key: "start", Value: 1}},
+					Options: options.Index().SetName("examinationtype_start"),
+				},
+			)
+		},
+	},
+	{
+		Version:     6,
+		Description: "patient administrative gender and preferred language",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			patients := db.Collection("patient")
+			// sex values were case sensitive, normalize known values and mark the rest unknown
+			for _, sex := range []string{"male", "female"} {
+				_, err := patients.UpdateMany(ctx,
+					bson.D{{Key: "sex", Value: bson.D{{Key: "$regex", Value: "^" + sex + "$"}, {Key: "$options", Value: "i"}}}},
+					bson.D{{Key: "$set", Value: bson.D{{Key: "sex", Value: sex}}}},
+				)
+				if err != nil {
+					return err
+				}
+			}
+			_, err := patients.UpdateMany(ctx,
+				bson.D{{Key: "sex", Value: bson.D{{Key: "$nin", Value: bson.A{"male", "female", "other", "unknown"}}}}},
+				bson.D{{Key: "$set", Value: bson.D{{Key: "sex", Value: "unknown"}}}},
+			)
+			if err != nil {
+				return err
+			}
+			// all existing patients were registered in Slovak clinics
+			_, err = patients.UpdateMany(ctx,
+				bson.D{{Key: "preferredlanguage", Value: bson.D{{Key: "$in", Value: bson.A{nil, ""}}}}},
+				bson.D{{Key: "$set", Value: bson.D{{Key: "preferredlanguage", Value: "sk"}}}},
+			)
+			return err
+		},
+	},
+	{
+		Version:     7,
+		Description: "reminder records",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return ensureIndexes(ctx, db, "reminder",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "id", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("id_unique"),
+				},
+				mongo.IndexModel{
+					// records are needed only until the reservation passes
+					Keys:    bson.D{{Key: "sentat", Value: 1}},
+					Options: options.Index().SetName("sentat_ttl").SetExpireAfterSeconds(30 * 24 * 60 * 60),
+				},
+			)
+		},
+	},
+	{
+		Version:     8,
+		Description: "waitlist and reservation status",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := ensureIndexes(ctx, db, "waitlist",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "id", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("id_unique"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "status", Value: 1}, {Key: "examinationtype", Value: 1}, {Key: "createdat", Value: 1}},
+					Options: options.Index().SetName("status_examinationtype_createdat"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "patientid", Value: 1}},
+					Options: options.Index().SetName("patientid"),
+				},
+			); err != nil {
+				return err
+			}
+			// reservations created before cancellation was introduced are scheduled
+			_, err := db.Collection("reservation").UpdateMany(ctx,
+				bson.D{{Key: "status", Value: bson.D{{Key: "$exists", Value: false}}}},
+				bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "scheduled"}}}},
+			)
+			return err
+		},
+	},
+	{
+		Version:     9,
+		Description: "reservation sequence and modification time",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// calendar exports need stable DTSTAMP, legacy reservations get the migration time
+			_, err := db.Collection("reservation").UpdateMany(ctx,
+				bson.D{{Key: "updatedat", Value: bson.D{{Key: "$exists", Value: false}}}},
+				bson.D{{Key: "$set", Value: bson.D{
+					{Key: "updatedat", Value: time.Now().UTC()},
+					{Key: "sequence", Value: 0},
+				}}},
+			)
+			return err
+		},
+	},
+	{
+		Version:     10,
+		Description: "calendar feeds",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return ensureIndexes(ctx, db, "calendar_feed",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "id", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("id_unique"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "tokenhash", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("tokenhash_unique"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "ownerid", Value: 1}},
+					Options: options.Index().SetName("ownerid"),
+				},
+			)
+		},
+	},
+	{
+		Version:     11,
+		Description: "hl7 outbox",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return ensureIndexes(ctx, db, "hl7_outbox",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "id", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("id_unique"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "status", Value: 1}, {Key: "createdat", Value: 1}},
+					Options: options.Index().SetName("status_createdat"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "createdat", Value: 1}},
+					Options: options.Index().SetName("createdat"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "reservationid", Value: 1}},
+					Options: options.Index().SetName("reservationid"),
+				},
+			)
+		},
+	},
+	{
+		Version:     12,
+		Description: "webhooks and their deliveries",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := ensureIndexes(ctx, db, "webhook",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "id", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("id_unique"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "events", Value: 1}},
+					Options: options.Index().SetName("events"),
+				},
+			); err != nil {
+				return err
+			}
+			return ensureIndexes(ctx, db, "webhook_delivery",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "id", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("id_unique"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "status", Value: 1}, {Key: "nextattemptat", Value: 1}},
+					Options: options.Index().SetName("status_nextattemptat"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "webhookid", Value: 1}, {Key: "createdat", Value: -1}},
+					Options: options.Index().SetName("webhookid_createdat"),
+				},
+			)
+		},
+	},
+	{
+		Version:     13,
+		Description: "pre-images of reservation changes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// live updates match deleted reservations by their pre-image
+			err := db.RunCommand(ctx, bson.D{
+				{Key: "collMod", Value: "reservation"},
+				{Key: "changeStreamPreAndPostImages", Value: bson.D{{Key: "enabled", Value: true}}},
+			}).Err()
+			var commandErr mongo.CommandError
+			if errors.As(err, &commandErr) {
+				// servers before 6.0 do not record pre-images, live updates
+				// fall back to polling without them
+				log.Printf("Pre-images of reservation changes are not available: %v", err)
+				return nil
+			}
+			return err
+		},
+	},
+	{
+		Version:     14,
+		Description: "rate limit buckets",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return ensureIndexes(ctx, db, "rate_limit",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "id", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("id_unique"),
+				},
+				mongo.IndexModel{
+					// full buckets are not needed anymore
+					Keys:    bson.D{{Key: "expiresat", Value: 1}},
+					Options: options.Index().SetName("expiresat_ttl").SetExpireAfterSeconds(0),
+				},
+			)
+		},
+	},
+	{
+		Version:     15,
+		Description: "idempotency keys",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return ensureIndexes(ctx, db, "idempotency_key",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "id", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("id_unique"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "expiresat", Value: 1}},
+					Options: options.Index().SetName("expiresat_ttl").SetExpireAfterSeconds(0),
+				},
+			)
+		},
+	},
+	{
+		Version:     16,
+		Description: "reservation series",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := ensureIndexes(ctx, db, "reservation_series",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "id", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("id_unique"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "patientid", Value: 1}},
+					Options: options.Index().SetName("patientid"),
+				},
+			); err != nil {
+				return err
+			}
+			return ensureIndexes(ctx, db, "reservation",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "seriesid", Value: 1}, {Key: "recurrenceid", Value: 1}},
+					Options: options.Index().SetName("seriesid_recurrenceid"),
+				},
+			)
+		},
+	},
+	{
+		Version:     17,
+		Description: "staff",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := ensureIndexes(ctx, db, "staff",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "id", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("id_unique"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "ambulanceids", Value: 1}},
+					Options: options.Index().SetName("ambulanceids"),
+				},
+			); err != nil {
+				return err
+			}
+			return ensureIndexes(ctx, db, "reservation",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "staffid", Value: 1}, {Key: "start", Value: 1}},
+					Options: options.Index().SetName("staffid_start"),
+				},
+			)
+		},
+	},
+	{
+		Version:     18,
+		Description: "ambulance time zones",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// ambulances without own time zone used the TZ of the service,
+			// all existing ambulances are Slovak clinics
+			_, err := db.Collection("ambulance").UpdateMany(ctx,
+				bson.D{{Key: "timezone", Value: bson.D{{Key: "$in", Value: bson.A{nil, ""}}}}},
+				bson.D{{Key: "$set", Value: bson.D{{Key: "timezone", Value: "Europe/Bratislava"}}}},
+			)
+			return err
+		},
+	},
+}
+
+// ensureIndexes creates the indexes unless they already exist. Index creation
+// with the same name and specification is a no-op in MongoDB.
+func ensureIndexes(ctx context.Context, db *mongo.Database, collection string, indexes ...mongo.IndexModel) error {
+	_, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+const namespaceNotFoundCode = 26
+
+func dropIndexIfExists(ctx context.Context, db *mongo.Database, collection string, name string) error {
+	cursor, err := db.Collection(collection).Indexes().List(ctx)
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && commandErr.Code == namespaceNotFoundCode {
+		return nil // collection does not exist yet
+	} else if err != nil {
+		return err
+	}
+	var indexes []bson.M
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if index["name"] == name {
+			_, err := db.Collection(collection).Indexes().DropOne(ctx, name)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type fileNotifier struct {
+	dir  string
+	from string
+}
+
+// NewFileNotifier creates notifier which drops the messages as .eml files into
+// the directory, they can be opened by any mail client during development
+func NewFileNotifier(dir string, from string) Notifier {
+	return &fileNotifier{dir: dir, from: from}
+}
+
+func (this *fileNotifier) Notify(ctx context.Context, message Message) error {
+	if err := os.MkdirAll(this.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%v-%v-%v.eml", time.Now().UTC().Format("20060102T150405"), message.Event, uuid.New().String())
+	return os.WriteFile(filepath.Join(this.dir, name), formatEmail(this.from, message), 0o644)
+}
@@ -0,0 +1,26 @@
+package notification
+
+import (
+	"context"
+	"log"
+)
+
+type logNotifier struct{}
+
+// NewLogNotifier creates notifier which only logs the messages, for development
+func NewLogNotifier() Notifier {
+	return &logNotifier{}
+}
+
+func (this *logNotifier) Notify(ctx context.Context, message Message) error {
+	log.Printf(
+		"Notification %v to %v <%v> %v: %v\n%v",
+		message.Event,
+		message.Recipient.Name,
+		message.Recipient.Email,
+		message.Recipient.Phone,
+		message.Subject,
+		message.Body,
+	)
+	return nil
+}
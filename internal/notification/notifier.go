@@ -0,0 +1,124 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Recipient of the notification, channels skip recipients without their address
+type Recipient struct {
+	Name  string
+	Email string
+	Phone string
+}
+
+// Message is a rendered notification about an event
+type Message struct {
+	// Event is the type of the event, e.g. reservation.created
+	Event     string
+	Recipient Recipient
+	Subject   string
+	// Body is the full text used by email
+	Body string
+	// ShortText is the text used by SMS
+	ShortText string
+}
+
+// Notifier delivers messages through one channel
+type Notifier interface {
+	Notify(ctx context.Context, message Message) error
+}
+
+// Channel is a notifier named by its kind, e.g. smtp or sms
+type Channel struct {
+	Name string
+	Notifier
+}
+
+type multiNotifier []Channel
+
+// Notify delivers the message through all channels, errors are joined
+func (this multiNotifier) Notify(ctx context.Context, message Message) error {
+	var errs []error
+	for _, channel := range this {
+		if err := channel.Notify(ctx, message); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Channels returns the channels the notifier delivers through, so callers can
+// retry only the failed ones. Notifiers not created by NewNotifierFromEnv are
+// a single channel named default.
+func Channels(notifier Notifier) []Channel {
+	if channels, ok := notifier.(multiNotifier); ok {
+		return channels
+	}
+	return []Channel{{Name: "default", Notifier: notifier}}
+}
+
+// NewNotifierFromEnv creates notifiers listed in RESERVATION_API_NOTIFIERS
+// (comma separated list of log, file, smtp, sms; defaults to log)
+func NewNotifierFromEnv() (Notifier, error) {
+	enviro := func(name string, defaultValue string) string {
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+		return defaultValue
+	}
+
+	notifiers := multiNotifier{}
+	configured := map[string]bool{}
+	for _, name := range strings.Split(enviro("RESERVATION_API_NOTIFIERS", "log"), ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		// channels are told apart by their names
+		if configured[name] {
+			return nil, fmt.Errorf("notifier %q is listed twice", name)
+		}
+		configured[name] = name != ""
+		switch name {
+		case "":
+			// nothing configured
+		case "log":
+			notifiers = append(notifiers, Channel{name, NewLogNotifier()})
+		case "file":
+			notifiers = append(notifiers, Channel{name, NewFileNotifier(
+				enviro("RESERVATION_API_NOTIFICATION_DIR", "notifications"),
+				enviro("RESERVATION_API_SMTP_FROM", "reservation@localhost"),
+			)})
+		case "smtp":
+			port, err := strconv.Atoi(enviro("RESERVATION_API_SMTP_PORT", "25"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid RESERVATION_API_SMTP_PORT: %w", err)
+			}
+			notifiers = append(notifiers, Channel{name, NewSMTPNotifier(SMTPConfig{
+				Host:     enviro("RESERVATION_API_SMTP_HOST", "localhost"),
+				Port:     port,
+				UserName: enviro("RESERVATION_API_SMTP_USERNAME", ""),
+				Password: enviro("RESERVATION_API_SMTP_PASSWORD", ""),
+				From:     enviro("RESERVATION_API_SMTP_FROM", "reservation@localhost"),
+			})})
+		case "sms":
+			url := enviro("RESERVATION_API_SMS_GATEWAY_URL", "")
+			if url == "" {
+				return nil, fmt.Errorf("RESERVATION_API_SMS_GATEWAY_URL is required by sms notifier")
+			}
+			notifiers = append(notifiers, Channel{name, NewSMSGatewayNotifier(SMSGatewayConfig{
+				URL:    url,
+				Token:  enviro("RESERVATION_API_SMS_GATEWAY_TOKEN", ""),
+				Sender: enviro("RESERVATION_API_SMS_SENDER", ""),
+			})})
+		default:
+			return nil, fmt.Errorf("unknown notifier %q", name)
+		}
+	}
+
+	log.Printf("Notifiers: %v", len(notifiers))
+	return notifiers, nil
+}
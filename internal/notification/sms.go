@@ -0,0 +1,63 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type SMSGatewayConfig struct {
+	// URL of the gateway endpoint accepting JSON {"to", "from", "text"} POST requests
+	URL string
+	// Token is sent as bearer token when set
+	Token  string
+	Sender string
+}
+
+type smsGatewayNotifier struct {
+	SMSGatewayConfig
+	client *http.Client
+}
+
+// NewSMSGatewayNotifier creates notifier sending the short text through generic HTTP SMS gateway
+func NewSMSGatewayNotifier(config SMSGatewayConfig) Notifier {
+	return &smsGatewayNotifier{config, &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (this *smsGatewayNotifier) Notify(ctx context.Context, message Message) error {
+	if message.Recipient.Phone == "" || message.ShortText == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"to":   message.Recipient.Phone,
+		"from": this.Sender,
+		"text": message.ShortText,
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, this.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if this.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+this.Token)
+	}
+
+	response, err := this.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to send SMS to %v: %w", message.Recipient.Phone, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("failed to send SMS to %v: gateway responded %v", message.Recipient.Phone, response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	UserName string
+	Password string
+	From     string
+	// Timeout limits sending of one email, including the dial, defaults to
+	// 30 seconds
+	Timeout time.Duration
+}
+
+type smtpNotifier struct {
+	SMTPConfig
+}
+
+// NewSMTPNotifier creates notifier sending emails through the SMTP server.
+// Authentication is used only when the user name is set.
+func NewSMTPNotifier(config SMTPConfig) Notifier {
+	return &smtpNotifier{config}
+}
+
+func (this *smtpNotifier) Notify(ctx context.Context, message Message) error {
+	if message.Recipient.Email == "" {
+		return nil
+	}
+
+	var auth smtp.Auth
+	if this.UserName != "" {
+		auth = smtp.PlainAuth("", this.UserName, this.Password, this.Host)
+	}
+
+	err := this.sendMail(ctx, auth, message.Recipient.Email, formatEmail(this.From, message))
+	if err != nil {
+		return fmt.Errorf("failed to send email to %v: %w", message.Recipient.Email, err)
+	}
+	return nil
+}
+
+// sendMail sends the email as smtp.SendMail does, but the connection is
+// bounded by the timeout and closed when the context is cancelled, so a
+// stalled server cannot block the caller
+func (this *smtpNotifier) sendMail(ctx context.Context, auth smtp.Auth, to string, email []byte) error {
+	timeout := this.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(this.Host, strconv.Itoa(this.Port)))
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, this.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: this.Host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("smtp server does not support authentication")
+		}
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(this.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(email); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// formatEmail renders the message as RFC 5322 email with quoted-printable UTF-8 body
+func formatEmail(from string, message Message) []byte {
+	to := (&mail.Address{Name: message.Recipient.Name, Address: message.Recipient.Email}).String()
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+
+	var email bytes.Buffer
+	fmt.Fprintf(&email, "From: %v\r\n", from)
+	fmt.Fprintf(&email, "To: %v\r\n", to)
+	fmt.Fprintf(&email, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&email, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&email, "Message-ID: <%v@%v>\r\n", uuid.New().String(), domain)
+	fmt.Fprintf(&email, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&email, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&email, "Content-Transfer-Encoding: quoted-printable\r\n")
+	fmt.Fprintf(&email, "\r\n")
+
+	body := quotedprintable.NewWriter(&email)
+	body.Write([]byte(strings.ReplaceAll(message.Body, "\n", "\r\n")))
+	body.Close()
+	return email.Bytes()
+}
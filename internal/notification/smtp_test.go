@@ -0,0 +1,177 @@
+package notification
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer accepts one connection and records the envelope and data of
+// the email, stalled servers accept the connection and never respond
+type fakeSMTPServer struct {
+	listener net.Listener
+	stalled  bool
+	from     string
+	to       []string
+	data     string
+	done     chan struct{}
+}
+
+func startFakeSMTPServer(t *testing.T, stalled bool) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeSMTPServer{listener: listener, stalled: stalled, done: make(chan struct{})}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (this *fakeSMTPServer) config() SMTPConfig {
+	address := this.listener.Addr().(*net.TCPAddr)
+	return SMTPConfig{Host: "127.0.0.1", Port: address.Port, From: "reservation@example.com"}
+}
+
+func (this *fakeSMTPServer) serve() {
+	defer close(this.done)
+	conn, err := this.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if this.stalled {
+		// wait for the client to give up
+		conn.Read(make([]byte, 1))
+		return
+	}
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 fake ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimRight(line, "\r\n")
+		switch verb := strings.ToUpper(strings.SplitN(command, " ", 2)[0]); {
+		case verb == "EHLO" || verb == "HELO":
+			reply("250 fake")
+		case strings.HasPrefix(strings.ToUpper(command), "MAIL FROM:"):
+			this.from = strings.Trim(command[len("MAIL FROM:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(strings.ToUpper(command), "RCPT TO:"):
+			this.to = append(this.to, strings.Trim(command[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case verb == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			this.data = data.String()
+			reply("250 OK")
+		case verb == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTPNotifierSendsEmail(t *testing.T) {
+	server := startFakeSMTPServer(t, false)
+	notifier := NewSMTPNotifier(server.config())
+
+	err := notifier.Notify(context.Background(), Message{
+		Recipient: Recipient{Name: "Jana Nováková", Email: "jana@example.com"},
+		Subject:   "Reservation confirmed",
+		Body:      "Your reservation is confirmed.\nSee you soon.",
+	})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	<-server.done
+
+	if server.from != "reservation@example.com" {
+		t.Errorf("MAIL FROM = %q, want reservation@example.com", server.from)
+	}
+	if len(server.to) != 1 || server.to[0] != "jana@example.com" {
+		t.Errorf("RCPT TO = %v, want [jana@example.com]", server.to)
+	}
+	for _, want := range []string{"Subject: Reservation confirmed\r\n", "Your reservation is confirmed.\r\nSee you soon."} {
+		if !strings.Contains(server.data, want) {
+			t.Errorf("email does not contain %q:\n%v", want, server.data)
+		}
+	}
+}
+
+func TestSMTPNotifierStalledServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		ctx     func() (context.Context, context.CancelFunc)
+	}{
+		{
+			name:    "timeout",
+			timeout: 100 * time.Millisecond,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+		},
+		{
+			name: "context deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 100*time.Millisecond)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := startFakeSMTPServer(t, true)
+			config := server.config()
+			config.Timeout = test.timeout
+			notifier := NewSMTPNotifier(config)
+
+			ctx, cancel := test.ctx()
+			defer cancel()
+			started := time.Now()
+			err := notifier.Notify(ctx, Message{Recipient: Recipient{Email: "jana@example.com"}, Subject: "Reminder"})
+			if err == nil {
+				t.Fatal("Notify() succeeded on a stalled server")
+			}
+			if elapsed := time.Since(started); elapsed > 5*time.Second {
+				t.Errorf("Notify() returned after %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestSMTPNotifierUnreachableServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	notifier := NewSMTPNotifier(SMTPConfig{Host: "127.0.0.1", Port: port, From: "reservation@example.com", Timeout: time.Second})
+	err = notifier.Notify(context.Background(), Message{Recipient: Recipient{Email: "jana@example.com"}, Subject: "Reminder"})
+	if err == nil || !strings.Contains(err.Error(), strconv.Itoa(port)) {
+		t.Errorf("Notify() error = %v, want dial error", err)
+	}
+}
@@ -0,0 +1,82 @@
+package notification
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+// DefaultLanguage is used when the recipient's language has no templates
+const DefaultLanguage = "sk"
+
+var dateTimeLayouts = map[string]string{
+	"sk": "2.1.2006 15:04",
+	"en": "Jan 2, 2006 3:04 PM",
+}
+
+var templates = loadTemplates()
+
+func loadTemplates() map[string]*template.Template {
+	languages, err := templateFiles.ReadDir("templates")
+	if err != nil {
+		panic(err)
+	}
+
+	result := make(map[string]*template.Template, len(languages))
+	for _, language := range languages {
+		layout := dateTimeLayouts[language.Name()]
+		functions := template.FuncMap{
+			// times are formatted in their location, e.g. the time zone of the ambulance
+			"datetime": func(t time.Time) string { return t.Format(layout) },
+		}
+		result[language.Name()] = template.Must(
+			template.New(language.Name()).Funcs(functions).ParseFS(templateFiles, "templates/"+language.Name()+"/*.tmpl"),
+		)
+	}
+	return result
+}
+
+// Render renders the message for the event in the language (BCP 47 tag, only
+// the primary subtag is used). Templates of the event define "subject", "body"
+// and optionally "sms" blocks prefixed with the event name, e.g.
+// "reservation.created.subject".
+func Render(event string, language string, data interface{}) (Message, error) {
+	language = strings.ToLower(strings.SplitN(language, "-", 2)[0])
+	languageTemplates, ok := templates[language]
+	if !ok {
+		languageTemplates = templates[DefaultLanguage]
+	}
+
+	message := Message{Event: event}
+	parts := []struct {
+		name     string
+		target   *string
+		optional bool
+	}{
+		{"subject", &message.Subject, false},
+		{"body", &message.Body, false},
+		{"sms", &message.ShortText, true},
+	}
+	for _, part := range parts {
+		name := event + "." + part.name
+		if languageTemplates.Lookup(name) == nil {
+			if part.optional {
+				continue
+			}
+			return message, fmt.Errorf("template %v not found for language %v", name, languageTemplates.Name())
+		}
+
+		var text bytes.Buffer
+		if err := languageTemplates.ExecuteTemplate(&text, name, data); err != nil {
+			return message, err
+		}
+		*part.target = strings.TrimSpace(text.String())
+	}
+	return message, nil
+}
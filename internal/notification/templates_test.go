@@ -0,0 +1,47 @@
+package notification
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderFormatsTimesInTheirLocation(t *testing.T) {
+	// the clinic is far from the time zone of the service
+	start := time.Date(2024, 5, 6, 10, 0, 0, 0, time.FixedZone("UTC+9", 9*60*60))
+	data := struct {
+		Patient         struct{ FirstName, LastName string }
+		Ambulance       struct{ Name, Address string }
+		ExaminationType string
+		Start, End      time.Time
+		Message         string
+	}{
+		ExaminationType: "x_ray",
+		Start:           start,
+		End:             start.Add(time.Hour),
+	}
+
+	tests := []struct {
+		language string
+		subject  string
+		time     string
+	}{
+		{language: "en", subject: "Reservation confirmed – X-ray examination May 6, 2024 10:00 AM", time: "May 6, 2024 10:00 AM – May 6, 2024 11:00 AM"},
+		{language: "sk", subject: "6.5.2024 10:00", time: "6.5.2024 10:00 – 6.5.2024 11:00"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.language, func(t *testing.T) {
+			message, err := Render("reservation.created", test.language, data)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if !strings.Contains(message.Subject, test.subject) {
+				t.Errorf("subject = %q, want it to contain %q", message.Subject, test.subject)
+			}
+			if !strings.Contains(message.Body, test.time) {
+				t.Errorf("body does not contain %q:\n%v", test.time, message.Body)
+			}
+		})
+	}
+}
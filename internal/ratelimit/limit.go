@@ -0,0 +1,104 @@
+// Package ratelimit limits the requests of the clients with token buckets.
+// Every client has a bucket per group of routes, the bucket holds up to
+// Limit.Requests tokens and is refilled continuously over Limit.Per. A
+// request takes one token and is rejected when the bucket is empty.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per the period, all of them may be spent at once
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+func (this Limit) String() string {
+	return fmt.Sprintf("%v/%v", this.Requests, this.Per)
+}
+
+// ParseLimit parses "<requests>/<duration>", e.g. "10/1m" or "1000/24h"
+func ParseLimit(value string) (Limit, error) {
+	requests, period, found := strings.Cut(strings.TrimSpace(value), "/")
+	if !found {
+		return Limit{}, fmt.Errorf("invalid limit %q, use <requests>/<duration>, e.g. 10/1m", value)
+	}
+	count, err := strconv.Atoi(requests)
+	if err != nil || count <= 0 {
+		return Limit{}, fmt.Errorf("invalid number of requests in limit %q", value)
+	}
+	per, err := time.ParseDuration(period)
+	if err != nil || per <= 0 {
+		return Limit{}, fmt.Errorf("invalid period in limit %q", value)
+	}
+	return Limit{Requests: count, Per: per}, nil
+}
+
+// ParseLimits parses comma separated "<group>=<limit>" pairs, e.g.
+// "default=600/1m,examination=10/1m"
+func ParseLimits(value string) (map[string]Limit, error) {
+	limits := map[string]Limit{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		group, limitValue, found := strings.Cut(pair, "=")
+		group = strings.TrimSpace(group)
+		if !found || group == "" {
+			return nil, fmt.Errorf("invalid limit %q, use <group>=<requests>/<duration>", pair)
+		}
+		limit, err := ParseLimit(limitValue)
+		if err != nil {
+			return nil, err
+		}
+		limits[group] = limit
+	}
+	return limits, nil
+}
+
+// Bucket is the state of the token bucket of one client and group
+type Bucket struct {
+	Id        string
+	Tokens    float64
+	UpdatedAt time.Time
+	// ExpiresAt is when the bucket is full again, it may be forgotten then
+	ExpiresAt time.Time
+	// Version is incremented by every update of the stored bucket
+	Version int64
+}
+
+// take refills the bucket up to now and takes one token, it returns the
+// delay until a token is available when the bucket is empty
+func (this *Bucket) take(limit Limit, now time.Time) (bool, time.Duration) {
+	capacity := float64(limit.Requests)
+	perSecond := capacity / limit.Per.Seconds()
+
+	switch {
+	case this.UpdatedAt.IsZero():
+		this.Tokens = capacity
+		this.UpdatedAt = now
+	case now.After(this.UpdatedAt):
+		// clocks of the replicas may differ, the bucket never goes back in time
+		this.Tokens = math.Min(capacity, this.Tokens+now.Sub(this.UpdatedAt).Seconds()*perSecond)
+		this.UpdatedAt = now
+	}
+
+	allowed := this.Tokens >= 1
+	if allowed {
+		this.Tokens--
+	}
+	this.ExpiresAt = this.UpdatedAt.Add(seconds((capacity - this.Tokens) / perSecond))
+	if allowed {
+		return true, 0
+	}
+	return false, seconds((1 - this.Tokens) / perSecond)
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(math.Ceil(value * float64(time.Second)))
+}
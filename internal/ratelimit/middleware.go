@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultGroup holds the routes not assigned to any other group
+const DefaultGroup = "default"
+
+// Route assigns requests to the group of limits, Path is the route as
+// registered in gin, e.g. /api/patients/:patientId/request-examination
+type Route struct {
+	Method string
+	Path   string
+	Group  string
+}
+
+// Identity derives the key of the client from the request. Clients are
+// identified by the user authenticated by the proxy in front of the
+// service, then by a known API key, and by the IP address otherwise.
+type Identity struct {
+	// UserHeader is set by the authenticating proxy, e.g. X-Forwarded-User.
+	// Leave empty unless the proxy strips the header from client requests.
+	UserHeader string
+	// APIKeyHeader carries the API key, e.g. X-API-Key
+	APIKeyHeader string
+	// APIKeys are the known keys, unknown keys are ignored so clients do not
+	// get a fresh bucket by sending a random key
+	APIKeys map[string]bool
+}
+
+// Key returns the key of the client of the request
+func (this *Identity) Key(ctx *gin.Context) string {
+	if this.UserHeader != "" {
+		if user := ctx.GetHeader(this.UserHeader); user != "" {
+			return "user:" + user
+		}
+	}
+	if this.APIKeyHeader != "" {
+		if apiKey := ctx.GetHeader(this.APIKeyHeader); apiKey != "" && this.APIKeys[apiKey] {
+			// keys are secrets, the stored buckets hold their hash only
+			hash := sha256.Sum256([]byte(apiKey))
+			return "key:" + hex.EncodeToString(hash[:8])
+		}
+	}
+	return "ip:" + ctx.ClientIP()
+}
+
+// Limiter rejects requests of the clients over the limit of the route group
+type Limiter struct {
+	Store Store
+	// Limits of the groups, requests of groups without limit are not limited
+	Limits   map[string]Limit
+	Routes   []Route
+	Identity *Identity
+}
+
+// Middleware answers 429 Too Many Requests with Retry-After when the client
+// exceeded the limit. Requests are allowed when the store is unavailable,
+// the service stays available without limiting.
+func (this *Limiter) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		group := this.group(ctx.Request.Method, ctx.FullPath())
+		limit, limited := this.Limits[group]
+		if !limited {
+			ctx.Next()
+			return
+		}
+
+		key := group + ":" + this.Identity.Key(ctx)
+		allowed, retryAfter, err := this.Store.Take(ctx, key, limit)
+		if err != nil {
+			log.Printf("Failed to check rate limit of %v: %v", key, err)
+			ctx.Next()
+			return
+		}
+		if !allowed {
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			ctx.AbortWithStatusJSON(
+				http.StatusTooManyRequests,
+				gin.H{
+					"status":  "Too Many Requests",
+					"message": "Rate limit exceeded",
+					"error":   fmt.Sprintf("limit of %v requests is %v", group, limit),
+				})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func (this *Limiter) group(method string, path string) string {
+	for _, route := range this.Routes {
+		if route.Path == path && (route.Method == "" || route.Method == method) {
+			return route.Group
+		}
+	}
+	return DefaultGroup
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+)
+
+// Store keeps the buckets of the clients
+type Store interface {
+	// Take takes a token from the bucket of the key, it returns false and
+	// the delay until a token is available when the bucket is empty
+	Take(ctx context.Context, key string, limit Limit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// memorySweepInterval is the period of forgetting full buckets
+const memorySweepInterval = time.Minute
+
+// MemoryStore keeps the buckets in memory of the process, every replica
+// of the service limits the clients separately
+type MemoryStore struct {
+	mutex     sync.Mutex
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*Bucket{}}
+}
+
+func (this *MemoryStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(this.lastSweep) > memorySweepInterval {
+		for bucketKey, bucket := range this.buckets {
+			if now.After(bucket.ExpiresAt) {
+				delete(this.buckets, bucketKey)
+			}
+		}
+		this.lastSweep = now
+	}
+
+	bucket, exists := this.buckets[key]
+	if !exists {
+		bucket = &Bucket{Id: key}
+		this.buckets[key] = bucket
+	}
+	allowed, retryAfter := bucket.take(limit, now)
+	return allowed, retryAfter, nil
+}
+
+// maxMongoAttempts limits the retries of the bucket update under contention
+const maxMongoAttempts = 5
+
+// MongoStore keeps the buckets in the database, so the limits are shared by
+// all replicas of the service. Expired buckets are removed by the TTL index,
+// see internal/migrations.
+type MongoStore struct {
+	BucketDB db_service.DbService[Bucket]
+}
+
+// Take updates the bucket with compare-and-swap on its version. Requests
+// losing the race more than maxMongoAttempts times are denied, a burst of one
+// client must not get past the limit, only failures of the database are
+// returned as errors.
+func (this *MongoStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	for attempt := 0; attempt < maxMongoAttempts; attempt++ {
+		now := time.Now().UTC()
+		bucket, err := this.BucketDB.FindDocument(ctx, key)
+		switch err {
+		case nil:
+			previous := bucket.Version
+			allowed, retryAfter := bucket.take(limit, now)
+			bucket.Version++
+			// the bucket is replaced only if no other request took a token meanwhile
+			filter := db_service.Eq("version", previous)
+			if previous == 0 {
+				// buckets stored before they were versioned have no version
+				filter = db_service.Or(filter, db_service.Exists("version", false))
+			}
+			err = this.BucketDB.UpdateDocumentIf(ctx, key, filter, bucket)
+			if err == nil {
+				return allowed, retryAfter, nil
+			}
+			if err != db_service.ErrNotFound {
+				return false, 0, err
+			}
+		case db_service.ErrNotFound:
+			bucket = &Bucket{Id: key}
+			allowed, retryAfter := bucket.take(limit, now)
+			err = this.BucketDB.CreateDocument(ctx, key, bucket)
+			if err == nil {
+				return allowed, retryAfter, nil
+			}
+			if err != db_service.ErrConflict {
+				return false, 0, err
+			}
+		default:
+			return false, 0, err
+		}
+	}
+	// the client sends requests faster than they can be counted, retry after
+	// the time of refilling one token
+	return false, limit.Per / time.Duration(limit.Requests), nil
+}
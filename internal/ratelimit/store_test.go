@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+)
+
+// fakeBucketDB keeps the buckets in memory. UpdateDocumentIf succeeds only
+// if the stored version precedes the version of the new bucket, as the
+// version filter of MongoStore does in the database.
+type fakeBucketDB struct {
+	db_service.DbService[Bucket]
+	mutex   sync.Mutex
+	buckets map[string]Bucket
+	err     error
+}
+
+func newFakeBucketDB() *fakeBucketDB {
+	return &fakeBucketDB{buckets: map[string]Bucket{}}
+}
+
+func (this *fakeBucketDB) FindDocument(ctx context.Context, id string) (*Bucket, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.err != nil {
+		return nil, this.err
+	}
+	bucket, exists := this.buckets[id]
+	if !exists {
+		return nil, db_service.ErrNotFound
+	}
+	// let the other requests interleave between the read and the update
+	defer runtime.Gosched()
+	return &bucket, nil
+}
+
+func (this *fakeBucketDB) CreateDocument(ctx context.Context, id string, bucket *Bucket) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if _, exists := this.buckets[id]; exists {
+		return db_service.ErrConflict
+	}
+	this.buckets[id] = *bucket
+	return nil
+}
+
+func (this *fakeBucketDB) UpdateDocumentIf(ctx context.Context, id string, filter db_service.Filter, bucket *Bucket) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	stored, exists := this.buckets[id]
+	if !exists || stored.Version != bucket.Version-1 {
+		return db_service.ErrNotFound
+	}
+	this.buckets[id] = *bucket
+	return nil
+}
+
+func TestStoreTakeConcurrently(t *testing.T) {
+	const requests = 200
+	limit := Limit{Requests: 10, Per: time.Hour}
+
+	tests := []struct {
+		name  string
+		store Store
+		// exact stores allow the whole limit, the others may deny requests
+		// losing the race
+		exact bool
+	}{
+		{name: "memory", store: NewMemoryStore(), exact: true},
+		{name: "mongo", store: &MongoStore{BucketDB: newFakeBucketDB()}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var wait sync.WaitGroup
+			results := make(chan bool, requests)
+			errs := make(chan error, requests)
+			for i := 0; i < requests; i++ {
+				wait.Add(1)
+				go func() {
+					defer wait.Done()
+					allowed, retryAfter, err := test.store.Take(context.Background(), "examination:ip:10.0.0.1", limit)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if !allowed && retryAfter <= 0 {
+						t.Errorf("denied request has Retry-After %v", retryAfter)
+					}
+					results <- allowed
+				}()
+			}
+			wait.Wait()
+			close(results)
+			close(errs)
+
+			for err := range errs {
+				t.Errorf("Take() error = %v", err)
+			}
+			allowed := 0
+			for result := range results {
+				if result {
+					allowed++
+				}
+			}
+			if allowed > limit.Requests || allowed == 0 || (test.exact && allowed != limit.Requests) {
+				t.Errorf("%v of %v requests allowed, limit is %v", allowed, requests, limit.Requests)
+			}
+		})
+	}
+}
+
+func TestMongoStoreTakeRefills(t *testing.T) {
+	db := newFakeBucketDB()
+	store := &MongoStore{BucketDB: db}
+	limit := Limit{Requests: 2, Per: time.Minute}
+	key := "default:ip:10.0.0.1"
+
+	for i, want := range []bool{true, true, false} {
+		allowed, retryAfter, err := store.Take(context.Background(), key, limit)
+		if err != nil || allowed != want {
+			t.Fatalf("Take() #%v = %v, %v, want %v", i+1, allowed, err, want)
+		}
+		if !allowed && (retryAfter <= 0 || retryAfter > 30*time.Second) {
+			t.Errorf("Retry-After = %v, want at most the time of one token", retryAfter)
+		}
+	}
+
+	// half a minute later one token is back
+	bucket := db.buckets[key]
+	bucket.UpdatedAt = bucket.UpdatedAt.Add(-30 * time.Second)
+	db.buckets[key] = bucket
+	if allowed, _, err := store.Take(context.Background(), key, limit); err != nil || !allowed {
+		t.Errorf("Take() after refill = %v, %v, want allowed", allowed, err)
+	}
+}
+
+func TestMongoStoreTakeFailure(t *testing.T) {
+	db := newFakeBucketDB()
+	db.err = errors.New("server selection timeout")
+	store := &MongoStore{BucketDB: db}
+
+	if _, _, err := store.Take(context.Background(), "default:ip:10.0.0.1", Limit{Requests: 1, Per: time.Minute}); err != db.err {
+		t.Errorf("Take() error = %v, want %v", err, db.err)
+	}
+}
@@ -30,9 +30,15 @@ type AmbulanceAPI interface {
     // GetAmbulanceById - Get an ambulance by ID
    GetAmbulanceById(ctx *gin.Context)
 
+    // GetAmbulanceEvents - Stream changes of the ambulance reservations
+   GetAmbulanceEvents(ctx *gin.Context)
+
     // GetAmbulanceReservationsById - Get reservations for a specific ambulance
    GetAmbulanceReservationsById(ctx *gin.Context)
 
+    // GetAmbulanceReservationsCalendar - Export reservations of the ambulance as iCalendar
+   GetAmbulanceReservationsCalendar(ctx *gin.Context)
+
     // GetAmbulances - Get a list of all ambulances
    GetAmbulances(ctx *gin.Context)
 
@@ -54,7 +60,9 @@ func (this *implAmbulanceAPI) addRoutes(routerGroup *gin.RouterGroup) {
   routerGroup.Handle( http.MethodPost, "/ambulances", this.CreateAmbulance)
   routerGroup.Handle( http.MethodDelete, "/ambulances/:ambulanceId", this.DeleteAmbulance)
   routerGroup.Handle( http.MethodGet, "/ambulances/:ambulanceId", this.GetAmbulanceById)
+  routerGroup.Handle( http.MethodGet, "/ambulances/:ambulanceId/events", this.GetAmbulanceEvents)
   routerGroup.Handle( http.MethodGet, "/ambulances/:ambulanceId/reservations", this.GetAmbulanceReservationsById)
+  routerGroup.Handle( http.MethodGet, "/ambulances/:ambulanceId/reservations/calendar", this.GetAmbulanceReservationsCalendar)
   routerGroup.Handle( http.MethodGet, "/ambulances", this.GetAmbulances)
   routerGroup.Handle( http.MethodPut, "/ambulances/:ambulanceId", this.UpdateAmbulance)
 }
@@ -75,11 +83,21 @@ func (this *implAmbulanceAPI) addRoutes(routerGroup *gin.RouterGroup) {
 //  	ctx.AbortWithStatus(http.StatusNotImplemented)
 // }
 //
+// // GetAmbulanceEvents - Stream changes of the ambulance reservations
+// func (this *implAmbulanceAPI) GetAmbulanceEvents(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
 // // GetAmbulanceReservationsById - Get reservations for a specific ambulance
 // func (this *implAmbulanceAPI) GetAmbulanceReservationsById(ctx *gin.Context) {
 //  	ctx.AbortWithStatus(http.StatusNotImplemented)
 // }
 //
+// // GetAmbulanceReservationsCalendar - Export reservations of the ambulance as iCalendar
+// func (this *implAmbulanceAPI) GetAmbulanceReservationsCalendar(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
 // // GetAmbulances - Get a list of all ambulances
 // func (this *implAmbulanceAPI) GetAmbulances(ctx *gin.Context) {
 //  	ctx.AbortWithStatus(http.StatusNotImplemented)
@@ -0,0 +1,102 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+ package reservation
+
+import (
+   "net/http"
+
+   "github.com/gin-gonic/gin"
+)
+
+type CalendarFeedAPI interface {
+
+   // internal registration of api routes
+   addRoutes(routerGroup *gin.RouterGroup)
+
+    // CreateAmbulanceCalendarFeed - Create calendar feed of the ambulance
+   CreateAmbulanceCalendarFeed(ctx *gin.Context)
+
+    // CreatePatientCalendarFeed - Create calendar feed of the patient
+   CreatePatientCalendarFeed(ctx *gin.Context)
+
+    // DeleteCalendarFeed - Revokes the calendar feed
+   DeleteCalendarFeed(ctx *gin.Context)
+
+    // GetAmbulanceCalendarFeeds - Get calendar feeds of the ambulance
+   GetAmbulanceCalendarFeeds(ctx *gin.Context)
+
+    // GetCalendarFeed - Calendar subscription feed
+   GetCalendarFeed(ctx *gin.Context)
+
+    // GetPatientCalendarFeeds - Get calendar feeds of the patient
+   GetPatientCalendarFeeds(ctx *gin.Context)
+
+    // RotateCalendarFeed - Replaces the secret token of the calendar feed
+   RotateCalendarFeed(ctx *gin.Context)
+
+ }
+
+ // partial implementation of CalendarFeedAPI - all functions must be implemented in add on files
+type implCalendarFeedAPI struct {
+
+}
+
+func newCalendarFeedAPI() CalendarFeedAPI {
+  return &implCalendarFeedAPI{}
+}
+
+func (this *implCalendarFeedAPI) addRoutes(routerGroup *gin.RouterGroup) {
+  routerGroup.Handle( http.MethodPost, "/ambulances/:ambulanceId/calendar-feeds", this.CreateAmbulanceCalendarFeed)
+  routerGroup.Handle( http.MethodPost, "/patients/:patientId/calendar-feeds", this.CreatePatientCalendarFeed)
+  routerGroup.Handle( http.MethodDelete, "/calendar-feeds/:feedId", this.DeleteCalendarFeed)
+  routerGroup.Handle( http.MethodGet, "/ambulances/:ambulanceId/calendar-feeds", this.GetAmbulanceCalendarFeeds)
+  routerGroup.Handle( http.MethodGet, "/feeds/:token", this.GetCalendarFeed)
+  routerGroup.Handle( http.MethodGet, "/patients/:patientId/calendar-feeds", this.GetPatientCalendarFeeds)
+  routerGroup.Handle( http.MethodPost, "/calendar-feeds/:feedId/rotate", this.RotateCalendarFeed)
+}
+
+// Copy following section to separate file, uncomment, and implement accordingly
+// // CreateAmbulanceCalendarFeed - Create calendar feed of the ambulance
+// func (this *implCalendarFeedAPI) CreateAmbulanceCalendarFeed(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // CreatePatientCalendarFeed - Create calendar feed of the patient
+// func (this *implCalendarFeedAPI) CreatePatientCalendarFeed(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // DeleteCalendarFeed - Revokes the calendar feed
+// func (this *implCalendarFeedAPI) DeleteCalendarFeed(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // GetAmbulanceCalendarFeeds - Get calendar feeds of the ambulance
+// func (this *implCalendarFeedAPI) GetAmbulanceCalendarFeeds(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // GetCalendarFeed - Calendar subscription feed
+// func (this *implCalendarFeedAPI) GetCalendarFeed(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // GetPatientCalendarFeeds - Get calendar feeds of the patient
+// func (this *implCalendarFeedAPI) GetPatientCalendarFeeds(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // RotateCalendarFeed - Replaces the secret token of the calendar feed
+// func (this *implCalendarFeedAPI) RotateCalendarFeed(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+
@@ -0,0 +1,66 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+ package reservation
+
+import (
+   "net/http"
+
+   "github.com/gin-gonic/gin"
+)
+
+type Hl7API interface {
+
+   // internal registration of api routes
+   addRoutes(routerGroup *gin.RouterGroup)
+
+    // GetHl7Message - Get the HL7 message in ER7 encoding
+   GetHl7Message(ctx *gin.Context)
+
+    // GetHl7Messages - Get HL7 SIU messages of reservation events
+   GetHl7Messages(ctx *gin.Context)
+
+    // ResendHl7Message - Schedules the message to be pushed again
+   ResendHl7Message(ctx *gin.Context)
+
+ }
+
+ // partial implementation of Hl7API - all functions must be implemented in add on files
+type implHl7API struct {
+
+}
+
+func newHl7API() Hl7API {
+  return &implHl7API{}
+}
+
+func (this *implHl7API) addRoutes(routerGroup *gin.RouterGroup) {
+  routerGroup.Handle( http.MethodGet, "/hl7/messages/:messageId", this.GetHl7Message)
+  routerGroup.Handle( http.MethodGet, "/hl7/messages", this.GetHl7Messages)
+  routerGroup.Handle( http.MethodPost, "/hl7/messages/:messageId/resend", this.ResendHl7Message)
+}
+
+// Copy following section to separate file, uncomment, and implement accordingly
+// // GetHl7Message - Get the HL7 message in ER7 encoding
+// func (this *implHl7API) GetHl7Message(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // GetHl7Messages - Get HL7 SIU messages of reservation events
+// func (this *implHl7API) GetHl7Messages(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // ResendHl7Message - Schedules the message to be pushed again
+// func (this *implHl7API) ResendHl7Message(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+
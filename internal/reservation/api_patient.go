@@ -36,12 +36,21 @@ type PatientAPI interface {
     // GetPatientReservations - Get reservations for a specific patient
    GetPatientReservations(ctx *gin.Context)
 
+    // GetPatientReservationsCalendar - Export reservations of the patient as iCalendar
+   GetPatientReservationsCalendar(ctx *gin.Context)
+
     // GetPatients - Get a list of all patients
    GetPatients(ctx *gin.Context)
 
+    // ImportPatients - Import patients from CSV or JSON Lines
+   ImportPatients(ctx *gin.Context)
+
     // RequestExamination - Request an examination for a specific patient
    RequestExamination(ctx *gin.Context)
 
+    // SearchPatients - Search patients by name and birthday
+   SearchPatients(ctx *gin.Context)
+
     // UpdatePatient - Update an existing patient
    UpdatePatient(ctx *gin.Context)
 
@@ -62,8 +71,11 @@ func (this *implPatientAPI) addRoutes(routerGroup *gin.RouterGroup) {
   routerGroup.Handle( http.MethodDelete, "/patients/:patientId", this.DeletePatient)
   routerGroup.Handle( http.MethodGet, "/patients/:patientId", this.GetPatientById)
   routerGroup.Handle( http.MethodGet, "/patients/:patientId/reservations", this.GetPatientReservations)
+  routerGroup.Handle( http.MethodGet, "/patients/:patientId/reservations/calendar", this.GetPatientReservationsCalendar)
   routerGroup.Handle( http.MethodGet, "/patients", this.GetPatients)
+  routerGroup.Handle( http.MethodPost, "/patients/import", this.ImportPatients)
   routerGroup.Handle( http.MethodPost, "/patients/:patientId/request-examination", this.RequestExamination)
+  routerGroup.Handle( http.MethodGet, "/patients/search", this.SearchPatients)
   routerGroup.Handle( http.MethodPut, "/patients/:patientId", this.UpdatePatient)
 }
 
@@ -93,16 +105,31 @@ func (this *implPatientAPI) addRoutes(routerGroup *gin.RouterGroup) {
 //  	ctx.AbortWithStatus(http.StatusNotImplemented)
 // }
 //
+// // GetPatientReservationsCalendar - Export reservations of the patient as iCalendar
+// func (this *implPatientAPI) GetPatientReservationsCalendar(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
 // // GetPatients - Get a list of all patients
 // func (this *implPatientAPI) GetPatients(ctx *gin.Context) {
 //  	ctx.AbortWithStatus(http.StatusNotImplemented)
 // }
 //
+// // ImportPatients - Import patients from CSV or JSON Lines
+// func (this *implPatientAPI) ImportPatients(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
 // // RequestExamination - Request an examination for a specific patient
 // func (this *implPatientAPI) RequestExamination(ctx *gin.Context) {
 //  	ctx.AbortWithStatus(http.StatusNotImplemented)
 // }
 //
+// // SearchPatients - Search patients by name and birthday
+// func (this *implPatientAPI) SearchPatients(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
 // // UpdatePatient - Update an existing patient
 // func (this *implPatientAPI) UpdatePatient(ctx *gin.Context) {
 //  	ctx.AbortWithStatus(http.StatusNotImplemented)
@@ -21,12 +21,21 @@ type ReservationAPI interface {
    // internal registration of api routes
    addRoutes(routerGroup *gin.RouterGroup)
 
+    // CancelReservation - Cancels a reservation
+   CancelReservation(ctx *gin.Context)
+
     // DeleteReservation - Deletes a reservation
    DeleteReservation(ctx *gin.Context)
 
     // GetReservationById - Get a reservation by ID
    GetReservationById(ctx *gin.Context)
 
+    // GetReservationCalendar - Export the reservation as iCalendar
+   GetReservationCalendar(ctx *gin.Context)
+
+    // GetReservations - Get a list of reservations
+   GetReservations(ctx *gin.Context)
+
     // UpdateReservation - Update an existing reservation
    UpdateReservation(ctx *gin.Context)
 
@@ -42,12 +51,20 @@ func newReservationAPI() ReservationAPI {
 }
 
 func (this *implReservationAPI) addRoutes(routerGroup *gin.RouterGroup) {
+  routerGroup.Handle( http.MethodPost, "/reservations/:reservationId/cancel", this.CancelReservation)
   routerGroup.Handle( http.MethodDelete, "/reservations/:reservationId", this.DeleteReservation)
   routerGroup.Handle( http.MethodGet, "/reservations/:reservationId", this.GetReservationById)
+  routerGroup.Handle( http.MethodGet, "/reservations/:reservationId/calendar", this.GetReservationCalendar)
+  routerGroup.Handle( http.MethodGet, "/reservations", this.GetReservations)
   routerGroup.Handle( http.MethodPut, "/reservations/:reservationId", this.UpdateReservation)
 }
 
 // Copy following section to separate file, uncomment, and implement accordingly
+// // CancelReservation - Cancels a reservation
+// func (this *implReservationAPI) CancelReservation(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
 // // DeleteReservation - Deletes a reservation
 // func (this *implReservationAPI) DeleteReservation(ctx *gin.Context) {
 //  	ctx.AbortWithStatus(http.StatusNotImplemented)
@@ -58,6 +75,16 @@ func (this *implReservationAPI) addRoutes(routerGroup *gin.RouterGroup) {
 //  	ctx.AbortWithStatus(http.StatusNotImplemented)
 // }
 //
+// // GetReservationCalendar - Export the reservation as iCalendar
+// func (this *implReservationAPI) GetReservationCalendar(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // GetReservations - Get a list of reservations
+// func (this *implReservationAPI) GetReservations(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
 // // UpdateReservation - Update an existing reservation
 // func (this *implReservationAPI) UpdateReservation(ctx *gin.Context) {
 //  	ctx.AbortWithStatus(http.StatusNotImplemented)
@@ -0,0 +1,92 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+ package reservation
+
+import (
+   "net/http"
+
+   "github.com/gin-gonic/gin"
+)
+
+type ReservationSeriesAPI interface {
+
+   // internal registration of api routes
+   addRoutes(routerGroup *gin.RouterGroup)
+
+    // CancelReservationSeries - Cancel the reservation series as a whole
+   CancelReservationSeries(ctx *gin.Context)
+
+    // CreateReservationSeries - Book recurring reservations for the patient
+   CreateReservationSeries(ctx *gin.Context)
+
+    // GetPatientReservationSeries - Get reservation series of the patient
+   GetPatientReservationSeries(ctx *gin.Context)
+
+    // GetReservationSeries - Get a reservation series by ID
+   GetReservationSeries(ctx *gin.Context)
+
+    // GetReservationSeriesReservations - Get occurrences of the reservation series
+   GetReservationSeriesReservations(ctx *gin.Context)
+
+    // UpdateReservationSeries - Update the reservation series as a whole
+   UpdateReservationSeries(ctx *gin.Context)
+
+ }
+
+ // partial implementation of ReservationSeriesAPI - all functions must be implemented in add on files
+type implReservationSeriesAPI struct {
+
+}
+
+func newReservationSeriesAPI() ReservationSeriesAPI {
+  return &implReservationSeriesAPI{}
+}
+
+func (this *implReservationSeriesAPI) addRoutes(routerGroup *gin.RouterGroup) {
+  routerGroup.Handle( http.MethodPost, "/reservation-series/:seriesId/cancel", this.CancelReservationSeries)
+  routerGroup.Handle( http.MethodPost, "/patients/:patientId/reservation-series", this.CreateReservationSeries)
+  routerGroup.Handle( http.MethodGet, "/patients/:patientId/reservation-series", this.GetPatientReservationSeries)
+  routerGroup.Handle( http.MethodGet, "/reservation-series/:seriesId", this.GetReservationSeries)
+  routerGroup.Handle( http.MethodGet, "/reservation-series/:seriesId/reservations", this.GetReservationSeriesReservations)
+  routerGroup.Handle( http.MethodPut, "/reservation-series/:seriesId", this.UpdateReservationSeries)
+}
+
+// Copy following section to separate file, uncomment, and implement accordingly
+// // CancelReservationSeries - Cancel the reservation series as a whole
+// func (this *implReservationSeriesAPI) CancelReservationSeries(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // CreateReservationSeries - Book recurring reservations for the patient
+// func (this *implReservationSeriesAPI) CreateReservationSeries(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // GetPatientReservationSeries - Get reservation series of the patient
+// func (this *implReservationSeriesAPI) GetPatientReservationSeries(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // GetReservationSeries - Get a reservation series by ID
+// func (this *implReservationSeriesAPI) GetReservationSeries(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // GetReservationSeriesReservations - Get occurrences of the reservation series
+// func (this *implReservationSeriesAPI) GetReservationSeriesReservations(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // UpdateReservationSeries - Update the reservation series as a whole
+// func (this *implReservationSeriesAPI) UpdateReservationSeries(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
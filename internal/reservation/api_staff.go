@@ -0,0 +1,83 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+ package reservation
+
+import (
+   "net/http"
+
+   "github.com/gin-gonic/gin"
+)
+
+type StaffAPI interface {
+
+   // internal registration of api routes
+   addRoutes(routerGroup *gin.RouterGroup)
+
+    // CreateStaffMember - Create a new staff member
+   CreateStaffMember(ctx *gin.Context)
+
+    // DeleteStaffMember - Deletes a staff member
+   DeleteStaffMember(ctx *gin.Context)
+
+    // GetStaff - Get all staff members
+   GetStaff(ctx *gin.Context)
+
+    // GetStaffMember - Get a staff member by ID
+   GetStaffMember(ctx *gin.Context)
+
+    // UpdateStaffMember - Update an existing staff member
+   UpdateStaffMember(ctx *gin.Context)
+
+ }
+
+ // partial implementation of StaffAPI - all functions must be implemented in add on files
+type implStaffAPI struct {
+
+}
+
+func newStaffAPI() StaffAPI {
+  return &implStaffAPI{}
+}
+
+func (this *implStaffAPI) addRoutes(routerGroup *gin.RouterGroup) {
+  routerGroup.Handle( http.MethodPost, "/staff", this.CreateStaffMember)
+  routerGroup.Handle( http.MethodDelete, "/staff/:staffId", this.DeleteStaffMember)
+  routerGroup.Handle( http.MethodGet, "/staff", this.GetStaff)
+  routerGroup.Handle( http.MethodGet, "/staff/:staffId", this.GetStaffMember)
+  routerGroup.Handle( http.MethodPut, "/staff/:staffId", this.UpdateStaffMember)
+}
+
+// Copy following section to separate file, uncomment, and implement accordingly
+// // CreateStaffMember - Create a new staff member
+// func (this *implStaffAPI) CreateStaffMember(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // DeleteStaffMember - Deletes a staff member
+// func (this *implStaffAPI) DeleteStaffMember(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // GetStaff - Get all staff members
+// func (this *implStaffAPI) GetStaff(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // GetStaffMember - Get a staff member by ID
+// func (this *implStaffAPI) GetStaffMember(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // UpdateStaffMember - Update an existing staff member
+// func (this *implStaffAPI) UpdateStaffMember(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
@@ -0,0 +1,83 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+ package reservation
+
+import (
+   "net/http"
+
+   "github.com/gin-gonic/gin"
+)
+
+type WaitlistAPI interface {
+
+   // internal registration of api routes
+   addRoutes(routerGroup *gin.RouterGroup)
+
+    // ClaimWaitlistOffer - Books the slot offered to the waitlist entry
+   ClaimWaitlistOffer(ctx *gin.Context)
+
+    // CreateWaitlistEntry - Register the patient on the waitlist
+   CreateWaitlistEntry(ctx *gin.Context)
+
+    // DeleteWaitlistEntry - Removes the patient from the waitlist
+   DeleteWaitlistEntry(ctx *gin.Context)
+
+    // GetPatientWaitlist - Get waitlist entries of the patient
+   GetPatientWaitlist(ctx *gin.Context)
+
+    // GetWaitlistEntry - Get a waitlist entry by ID
+   GetWaitlistEntry(ctx *gin.Context)
+
+ }
+
+ // partial implementation of WaitlistAPI - all functions must be implemented in add on files
+type implWaitlistAPI struct {
+
+}
+
+func newWaitlistAPI() WaitlistAPI {
+  return &implWaitlistAPI{}
+}
+
+func (this *implWaitlistAPI) addRoutes(routerGroup *gin.RouterGroup) {
+  routerGroup.Handle( http.MethodPost, "/waitlist/:entryId/claim", this.ClaimWaitlistOffer)
+  routerGroup.Handle( http.MethodPost, "/patients/:patientId/waitlist", this.CreateWaitlistEntry)
+  routerGroup.Handle( http.MethodDelete, "/waitlist/:entryId", this.DeleteWaitlistEntry)
+  routerGroup.Handle( http.MethodGet, "/patients/:patientId/waitlist", this.GetPatientWaitlist)
+  routerGroup.Handle( http.MethodGet, "/waitlist/:entryId", this.GetWaitlistEntry)
+}
+
+// Copy following section to separate file, uncomment, and implement accordingly
+// // ClaimWaitlistOffer - Books the slot offered to the waitlist entry
+// func (this *implWaitlistAPI) ClaimWaitlistOffer(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // CreateWaitlistEntry - Register the patient on the waitlist
+// func (this *implWaitlistAPI) CreateWaitlistEntry(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // DeleteWaitlistEntry - Removes the patient from the waitlist
+// func (this *implWaitlistAPI) DeleteWaitlistEntry(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // GetPatientWaitlist - Get waitlist entries of the patient
+// func (this *implWaitlistAPI) GetPatientWaitlist(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // GetWaitlistEntry - Get a waitlist entry by ID
+// func (this *implWaitlistAPI) GetWaitlistEntry(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
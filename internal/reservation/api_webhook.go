@@ -0,0 +1,93 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+ package reservation
+
+import (
+   "net/http"
+
+   "github.com/gin-gonic/gin"
+)
+
+type WebhookAPI interface {
+
+   // internal registration of api routes
+   addRoutes(routerGroup *gin.RouterGroup)
+
+    // CreateWebhook - Subscribe URL to events
+   CreateWebhook(ctx *gin.Context)
+
+    // DeleteWebhook - Unsubscribe the webhook, its deliveries are deleted as well
+   DeleteWebhook(ctx *gin.Context)
+
+    // GetWebhook - Get the webhook subscription
+   GetWebhook(ctx *gin.Context)
+
+    // GetWebhookDeliveries - Get delivery log of the webhook
+   GetWebhookDeliveries(ctx *gin.Context)
+
+    // GetWebhooks - Get a list of all webhook subscriptions
+   GetWebhooks(ctx *gin.Context)
+
+    // RedeliverWebhookDelivery - Schedules the delivery to be attempted again
+   RedeliverWebhookDelivery(ctx *gin.Context)
+
+ }
+
+ // partial implementation of WebhookAPI - all functions must be implemented in add on files
+type implWebhookAPI struct {
+
+}
+
+func newWebhookAPI() WebhookAPI {
+  return &implWebhookAPI{}
+}
+
+func (this *implWebhookAPI) addRoutes(routerGroup *gin.RouterGroup) {
+  routerGroup.Handle( http.MethodPost, "/webhooks", this.CreateWebhook)
+  routerGroup.Handle( http.MethodDelete, "/webhooks/:webhookId", this.DeleteWebhook)
+  routerGroup.Handle( http.MethodGet, "/webhooks/:webhookId", this.GetWebhook)
+  routerGroup.Handle( http.MethodGet, "/webhooks/:webhookId/deliveries", this.GetWebhookDeliveries)
+  routerGroup.Handle( http.MethodGet, "/webhooks", this.GetWebhooks)
+  routerGroup.Handle( http.MethodPost, "/webhooks/:webhookId/deliveries/:deliveryId/redeliver", this.RedeliverWebhookDelivery)
+}
+
+// Copy following section to separate file, uncomment, and implement accordingly
+// // CreateWebhook - Subscribe URL to events
+// func (this *implWebhookAPI) CreateWebhook(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // DeleteWebhook - Unsubscribe the webhook, its deliveries are deleted as well
+// func (this *implWebhookAPI) DeleteWebhook(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // GetWebhook - Get the webhook subscription
+// func (this *implWebhookAPI) GetWebhook(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // GetWebhookDeliveries - Get delivery log of the webhook
+// func (this *implWebhookAPI) GetWebhookDeliveries(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // GetWebhooks - Get a list of all webhook subscriptions
+// func (this *implWebhookAPI) GetWebhooks(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+// // RedeliverWebhookDelivery - Schedules the delivery to be attempted again
+// func (this *implWebhookAPI) RedeliverWebhookDelivery(ctx *gin.Context) {
+//  	ctx.AbortWithStatus(http.StatusNotImplemented)
+// }
+//
+
@@ -1,7 +1,14 @@
 package reservation
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -63,6 +70,7 @@ func (this *implAmbulanceAPI) CreateAmbulance(ctx *gin.Context) {
   if ambulance.Id == "" {
       ambulance.Id = uuid.New().String()
   }
+  assignResourceIds(ambulance.Resources)
 
   err = db.CreateDocument(ctx, ambulance.Id, &ambulance)
 
@@ -97,8 +105,12 @@ func (this *implAmbulanceAPI) CreateAmbulance(ctx *gin.Context) {
 func (this *implAmbulanceAPI) DeleteAmbulance(ctx *gin.Context) {
   value, exists := ctx.Get("db_service_ambulance")
   reservationValue, reservationExists := ctx.Get("db_service_reservation")
+  feedValue, feedExists := ctx.Get("db_service_calendar_feed")
+  staffValue, staffExists := ctx.Get("db_service_staff")
+  patientValue, patientExists := ctx.Get("db_service_patient")
+  transactorValue, transactorExists := ctx.Get("db_transactor")
 
-  if !exists || !reservationExists {
+  if !exists || !reservationExists || !feedExists || !staffExists || !patientExists || !transactorExists {
       ctx.JSON(
           http.StatusInternalServerError,
           gin.H{
@@ -111,7 +123,11 @@ func (this *implAmbulanceAPI) DeleteAmbulance(ctx *gin.Context) {
 
   db, ok := value.(db_service.DbService[Ambulance])
   reservationDB, reservationOK := reservationValue.(db_service.DbService[ReservationInput])
-  if !ok || !reservationOK {
+  feedDB, feedOK := feedValue.(db_service.DbService[CalendarFeedRecord])
+  staffDB, staffOK := staffValue.(db_service.DbService[Staff])
+  patientDB, patientOK := patientValue.(db_service.DbService[Patient])
+  transactor, transactorOK := transactorValue.(db_service.Transactor)
+  if !ok || !reservationOK || !feedOK || !staffOK || !patientOK || !transactorOK {
       ctx.JSON(
           http.StatusInternalServerError,
           gin.H{
@@ -123,42 +139,56 @@ func (this *implAmbulanceAPI) DeleteAmbulance(ctx *gin.Context) {
   }
 
   ambulanceId := ctx.Param("ambulanceId")
-  err := db.DeleteDocument(ctx, ambulanceId)
 
-  switch err {
-  case nil:
-  case db_service.ErrNotFound:
-      ctx.JSON(
-          http.StatusNotFound,
-          gin.H{
-              "status":  "Not Found",
-              "message": "Ambulance not found",
-              "error":   err.Error(),
-          },
-      )
-      return
-  default:
-      ctx.JSON(
-          http.StatusBadGateway,
-          gin.H{
-              "status":  "Bad Gateway",
-              "message": "Failed to delete ambulance from database",
-              "error":   err.Error(),
-          })
-        return
-  }
-
-  err = reservationDB.DeleteDocumentsByField(ctx, "ambulanceid", ambulanceId)
+  // delete the ambulance together with its reservations and calendar feeds,
+  // and unassign its staff, so no orphans are left behind
+  outbox := hl7Outbox(ctx)
+  var reservationInputs []ReservationInput
+  var reservations []Reservation
+  err := transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+      // the ambulance is loaded first so the deleted reservations can be exported
+      ambulance, err := db.FindDocument(txCtx, ambulanceId)
+      if err != nil {
+          return err
+      }
+      if err := db.DeleteDocument(txCtx, ambulanceId); err != nil {
+          return err
+      }
+      reservationInputs, err = reservationDB.FindDocuments(txCtx, db_service.NewQuery(db_service.Eq("ambulanceid", ambulanceId)))
+      if err != nil {
+          return err
+      }
+      reservations, err = deletedReservations(txCtx, patientDB, nil, reservationInputs, nil, []Ambulance{*ambulance})
+      if err != nil {
+          return err
+      }
+      if err := outbox.ExportDeleted(txCtx, reservations); err != nil {
+          return err
+      }
+      if err := reservationDB.DeleteDocumentsByField(txCtx, "ambulanceid", ambulanceId); err != nil {
+          return err
+      }
+      if err := unassignAmbulanceStaff(txCtx, staffDB, ambulanceId); err != nil {
+          return err
+      }
+      return feedDB.DeleteDocumentsByField(txCtx, "ownerid", ambulanceId)
+  })
 
   switch err {
   case nil:
+    patientIds := make([]string, 0, len(reservationInputs))
+    for _, reservationInput := range reservationInputs {
+      patientIds = append(patientIds, reservationInput.PatientId)
+    }
+    publishDeletedReservations(ctx, reservations)
+    touchCalendarFeeds(ctx, patientIds...)
     ctx.AbortWithStatus(http.StatusNoContent)
   case db_service.ErrNotFound:
       ctx.JSON(
           http.StatusNotFound,
           gin.H{
               "status":  "Not Found",
-              "message": "Reservations not found",
+              "message": "Ambulance not found",
               "error":   err.Error(),
           },
       )
@@ -167,7 +197,7 @@ func (this *implAmbulanceAPI) DeleteAmbulance(ctx *gin.Context) {
           http.StatusBadGateway,
           gin.H{
               "status":  "Bad Gateway",
-              "message": "Failed to delete ambulance reservations from database",
+              "message": "Failed to delete ambulance from database",
               "error":   err.Error(),
           })
   }
@@ -229,6 +259,88 @@ func (this *implAmbulanceAPI) GetAmbulanceById(ctx *gin.Context) {
   }
 }
 
+// GetAmbulanceEvents - Stream changes of the ambulance reservations
+func (this *implAmbulanceAPI) GetAmbulanceEvents(ctx *gin.Context) {
+  reservationDB, patientDB, ambulanceDB, ok := reservationServices(ctx)
+  if !ok {
+    return
+  }
+
+  ambulanceId := ctx.Param("ambulanceId")
+  _, err := ambulanceDB.FindDocument(ctx, ambulanceId)
+
+  switch err {
+  case nil:
+  case db_service.ErrNotFound:
+    ctx.JSON(
+      http.StatusNotFound,
+      gin.H{
+        "status":  "Not Found",
+        "message": "Ambulance not found",
+        "error":   err.Error(),
+      },
+    )
+    return
+  default:
+    ctx.JSON(
+      http.StatusBadGateway,
+      gin.H{
+        "status":  "Bad Gateway",
+        "message": "Failed to load ambulance from database",
+        "error":   err.Error(),
+      })
+    return
+  }
+
+  watchCtx, cancel := context.WithCancel(ctx.Request.Context())
+  defer cancel()
+
+  changes := make(chan db_service.ChangeEvent[ReservationInput])
+  watchErr := make(chan error, 1)
+  go func() {
+    watchErr <- watchAmbulanceReservations(watchCtx, reservationDB, ambulanceId, func(change db_service.ChangeEvent[ReservationInput]) error {
+      select {
+      case changes <- change:
+        return nil
+      case <-watchCtx.Done():
+        return watchCtx.Err()
+      }
+    })
+  }()
+
+  ctx.Header("Content-Type", "text/event-stream")
+  ctx.Header("Cache-Control", "no-cache")
+  ctx.Header("Connection", "keep-alive")
+  // disables response buffering of nginx ingress
+  ctx.Header("X-Accel-Buffering", "no")
+  ctx.Status(http.StatusOK)
+  io.WriteString(ctx.Writer, ": connected\n\n")
+  ctx.Writer.Flush()
+
+  heartbeat := time.NewTicker(reservationEventsHeartbeat)
+  defer heartbeat.Stop()
+
+  ctx.Stream(func(w io.Writer) bool {
+    select {
+    case change := <-changes:
+      if name, data, ok := reservationLiveEvent(watchCtx, patientDB, ambulanceDB, ambulanceId, change); ok {
+        ctx.SSEvent(name, data)
+      }
+      return true
+    case <-heartbeat.C:
+      io.WriteString(w, ": keep-alive\n\n")
+      return true
+    case err := <-watchErr:
+      if err != nil {
+        log.Printf("Stopped streaming reservations of ambulance %v: %v", ambulanceId, err)
+      }
+      return false
+    case <-watchCtx.Done():
+      return false
+    }
+  })
+}
+
 // GetAmbulanceReservationsById - Get reservations for a specific ambulance
 func (this *implAmbulanceAPI) GetAmbulanceReservationsById(ctx *gin.Context) {
     value, exists := ctx.Get("db_service_reservation")
@@ -302,49 +414,65 @@ func (this *implAmbulanceAPI) GetAmbulanceReservationsById(ctx *gin.Context) {
 		return
 	}
 
-    reservations := make([]Reservation, len(reservationInputs))
-    for i, input := range reservationInputs {
-        patient, err := patientDB.FindDocument(ctx, input.PatientId)
-        if err != nil {
-            ctx.JSON(
-                http.StatusInternalServerError,
-                gin.H{
-                    "status":  "Internal Server Error",
-                    "message": "Failed to retrieve patient from database",
-                    "error":   err.Error(),
-                })
-            return
-        }
-
-        ambulance, err := ambulanceDB.FindDocument(ctx, input.AmbulanceId)
-        if err != nil {
-            ctx.JSON(
-                http.StatusInternalServerError,
-                gin.H{
-                    "status":  "Internal Server Error",
-                    "message": "Failed to retrieve ambulance from database",
-                    "error":   err.Error(),
-                })
-            return
-        }
-
-        reservations[i] = Reservation{
-            Id:           input.Id,
-            Patient:      *patient,
-            Ambulance:    *ambulance,
-            Start:       input.Start,
-            End:         input.End,
-            ExaminationType: input.ExaminationType,
-            Message:     input.Message,
-        }
+    reservations, err := expandReservations(ctx, patientDB, ambulanceDB, reservationInputs)
+    if err != nil {
+        ctx.JSON(
+            http.StatusInternalServerError,
+            gin.H{
+                "status":  "Internal Server Error",
+                "message": "Failed to retrieve reservation details from database",
+                "error":   err.Error(),
+            })
+        return
     }
-    
+
     ctx.JSON(
         http.StatusOK,
         reservations,
     )
 }
 
+// GetAmbulanceReservationsCalendar - Export reservations of the ambulance as iCalendar
+func (this *implAmbulanceAPI) GetAmbulanceReservationsCalendar(ctx *gin.Context) {
+  reservationDB, patientDB, ambulanceDB, ok := reservationServices(ctx)
+  if !ok {
+    return
+  }
+
+  ambulanceId := ctx.Param("ambulanceId")
+  ambulance, err := ambulanceDB.FindDocument(ctx, ambulanceId)
+
+  switch err {
+  case nil:
+  case db_service.ErrNotFound:
+    ctx.JSON(
+      http.StatusNotFound,
+      gin.H{
+        "status":  "Not Found",
+        "message": "Ambulance not found",
+        "error":   err.Error(),
+      },
+    )
+    return
+  default:
+    ctx.JSON(
+      http.StatusBadGateway,
+      gin.H{
+        "status":  "Bad Gateway",
+        "message": "Failed to load ambulance from database",
+        "error":   err.Error(),
+      })
+    return
+  }
+
+  reservations, ok := loadReservations(ctx, reservationDB, patientDB, ambulanceDB, "ambulanceid", ambulanceId)
+  if !ok {
+    return
+  }
+
+  writeCalendar(ctx, "ambulance-"+ambulanceId+".ics", reservationsCalendar(ambulance.Name, reservations, ambulanceCounterpart))
+}
+
 // GetAmbulances - Get a list of all ambulances
 func (this *implAmbulanceAPI) GetAmbulances(ctx *gin.Context) {
   value, exists := ctx.Get("db_service_ambulance")
@@ -371,7 +499,56 @@ func (this *implAmbulanceAPI) GetAmbulances(ctx *gin.Context) {
       return
   }
 
-  ambulances, err := db.GetDocuments(ctx)
+  filters := []db_service.Filter{}
+
+  if examinationTypes := ctx.QueryArray("examinationType"); len(examinationTypes) > 0 {
+      examinations := make([]MedicalExaminations, len(examinationTypes))
+      for i, examinationType := range examinationTypes {
+          examinations[i] = MedicalExaminations(examinationType)
+      }
+      if validExams, incorrectExams := ValidateMedicalExaminations(examinations); !validExams {
+          ctx.JSON(
+              http.StatusBadRequest,
+              gin.H{
+                  "status":  "Bad Request",
+                  "message": "Invalid filter parameters",
+                  "error":   fmt.Sprintf("Invalid medical examinations: %v", incorrectExams),
+              })
+          return
+      }
+      filters = append(filters, db_service.In("medicalexaminations", examinationTypes))
+  }
+
+  query := db_service.NewQuery(db_service.Filter{})
+  if address := strings.TrimSpace(ctx.Query("address")); address != "" {
+      filters = append(filters, db_service.Text(address))
+      query = query.SortByRelevance()
+  }
+  query.Filter = db_service.And(filters...)
+
+  // office hours are wall-clock strings in the time zone of the ambulance,
+  // so openness is checked after loading
+  var openAt *time.Time
+  if openNow, _ := strconv.ParseBool(ctx.Query("openNow")); openNow {
+      now := time.Now()
+      openAt = &now
+  }
+  if value := ctx.Query("openAt"); value != "" {
+      at, err := time.Parse(time.RFC3339, value)
+      if err != nil {
+          ctx.JSON(
+              http.StatusBadRequest,
+              gin.H{
+                  "status":  "Bad Request",
+                  "message": "Invalid filter parameters",
+                  "error":   fmt.Sprintf("Failed to parse openAt: %v", err),
+              })
+          return
+      }
+      openAt = &at
+  }
+
+  ambulances, err := db.FindDocuments(ctx, query)
 
   if err != nil {
       ctx.JSON(
@@ -384,6 +561,16 @@ func (this *implAmbulanceAPI) GetAmbulances(ctx *gin.Context) {
       return
   }
 
+  if openAt != nil {
+      openAmbulances := make([]Ambulance, 0, len(ambulances))
+      for _, ambulance := range ambulances {
+          if ambulance.OfficeHours.IsOpenAt(openAt.In(ambulance.location())) {
+              openAmbulances = append(openAmbulances, ambulance)
+          }
+      }
+      ambulances = openAmbulances
+  }
+
   if len(ambulances) == 0 {
     ambulances = []Ambulance{}
   }
@@ -446,6 +633,28 @@ func (this *implAmbulanceAPI) UpdateAmbulance(ctx *gin.Context) {
       ambulance.MedicalExaminations = entry.MedicalExaminations
     }
 
+    if entry.TimeZone != "" {
+      ambulance.TimeZone = entry.TimeZone
+    }
+
+    if entry.SlotMinutes != 0 {
+      ambulance.SlotMinutes = entry.SlotMinutes
+    }
+
+    if entry.Resources != nil {
+      ambulance.Resources = entry.Resources
+      assignResourceIds(ambulance.Resources)
+    }
+
+    // kept resources must still run the medical examinations
+    if err := validateAmbulanceResources(ambulance.Resources, ambulance.MedicalExaminations); err != nil {
+        return nil, gin.H{
+                "status":  "Bad Request",
+                "message": "Invalid ambulance data",
+                "error":   err.Error(),
+        }, http.StatusBadRequest
+    }
+
     return ambulance, ambulance, http.StatusOK
   })
 }
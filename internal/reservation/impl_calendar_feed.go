@@ -0,0 +1,355 @@
+package reservation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/ical"
+)
+
+// CreateAmbulanceCalendarFeed - Create calendar feed of the ambulance
+func (this *implCalendarFeedAPI) CreateAmbulanceCalendarFeed(ctx *gin.Context) {
+	createCalendarFeed(ctx, calendarFeedOwnerAmbulance, ctx.Param("ambulanceId"))
+}
+
+// CreatePatientCalendarFeed - Create calendar feed of the patient
+func (this *implCalendarFeedAPI) CreatePatientCalendarFeed(ctx *gin.Context) {
+	createCalendarFeed(ctx, calendarFeedOwnerPatient, ctx.Param("patientId"))
+}
+
+// DeleteCalendarFeed - Revokes the calendar feed
+func (this *implCalendarFeedAPI) DeleteCalendarFeed(ctx *gin.Context) {
+	db, ok := calendarFeedService(ctx)
+	if !ok {
+		return
+	}
+
+	err := db.DeleteDocument(ctx, ctx.Param("feedId"))
+
+	switch err {
+	case nil:
+		ctx.AbortWithStatus(http.StatusNoContent)
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Calendar feed not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to delete calendar feed from database",
+				"error":   err.Error(),
+			})
+	}
+}
+
+// GetAmbulanceCalendarFeeds - Get calendar feeds of the ambulance
+func (this *implCalendarFeedAPI) GetAmbulanceCalendarFeeds(ctx *gin.Context) {
+	getCalendarFeeds(ctx, calendarFeedOwnerAmbulance, ctx.Param("ambulanceId"))
+}
+
+// GetCalendarFeed - Calendar subscription feed
+func (this *implCalendarFeedAPI) GetCalendarFeed(ctx *gin.Context) {
+	db, ok := calendarFeedService(ctx)
+	if !ok {
+		return
+	}
+	reservationDB, patientDB, ambulanceDB, ok := reservationServices(ctx)
+	if !ok {
+		return
+	}
+
+	token := strings.TrimSuffix(ctx.Param("token"), ".ics")
+	records, err := db.FindDocuments(ctx, db_service.NewQuery(db_service.Eq("tokenhash", hashCalendarFeedToken(token))).Page(0, 1))
+	if err != nil {
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to load calendar feed from database",
+				"error":   err.Error(),
+			})
+		return
+	}
+	if len(records) == 0 {
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Calendar feed not found",
+				"error":   "unknown or revoked token",
+			},
+		)
+		return
+	}
+	record := records[0]
+
+	name, ok := findCalendarFeedOwner(ctx, record.OwnerType, record.OwnerId)
+	if !ok {
+		return
+	}
+
+	counterpart := patientCounterpart
+	field := "patientid"
+	if record.OwnerType == calendarFeedOwnerAmbulance {
+		counterpart = ambulanceCounterpart
+		field = "ambulanceid"
+	}
+	reservations, ok := loadReservations(ctx, reservationDB, patientDB, ambulanceDB, field, record.OwnerId)
+	if !ok {
+		return
+	}
+
+	body := reservationsCalendar(name, reservations, counterpart).String()
+	hash := sha256.Sum256([]byte(body))
+	etag := `"` + hex.EncodeToString(hash[:16]) + `"`
+	lastModified := calendarFeedLastModified(&record, reservations)
+
+	ctx.Header("ETag", etag)
+	ctx.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+	ctx.Header("Cache-Control", "private, no-cache")
+
+	// If-None-Match takes precedence over If-Modified-Since, see RFC 9110
+	if ifNoneMatch := ctx.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				ctx.AbortWithStatus(http.StatusNotModified)
+				return
+			}
+		}
+	} else if since, err := http.ParseTime(ctx.GetHeader("If-Modified-Since")); err == nil && !lastModified.After(since) {
+		ctx.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+
+	ctx.Data(http.StatusOK, ical.ContentType, []byte(body))
+}
+
+// GetPatientCalendarFeeds - Get calendar feeds of the patient
+func (this *implCalendarFeedAPI) GetPatientCalendarFeeds(ctx *gin.Context) {
+	getCalendarFeeds(ctx, calendarFeedOwnerPatient, ctx.Param("patientId"))
+}
+
+// RotateCalendarFeed - Replaces the secret token of the calendar feed
+func (this *implCalendarFeedAPI) RotateCalendarFeed(ctx *gin.Context) {
+	db, ok := calendarFeedService(ctx)
+	if !ok {
+		return
+	}
+
+	token, tokenHash, err := newCalendarFeedToken()
+	if err != nil {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "Failed to generate token",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	feedId := ctx.Param("feedId")
+	record, err := db.FindDocument(ctx, feedId)
+	if err == nil {
+		record.TokenHash = tokenHash
+		record.RotatedAt = time.Now().UTC()
+		err = db.UpdateDocument(ctx, feedId, record)
+	}
+
+	switch err {
+	case nil:
+		ctx.JSON(
+			http.StatusOK,
+			CalendarFeedToken{Feed: record.CalendarFeed, Token: token, Url: calendarFeedUrl(ctx, token)},
+		)
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Calendar feed not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to update calendar feed in database",
+				"error":   err.Error(),
+			})
+	}
+}
+
+func createCalendarFeed(ctx *gin.Context, ownerType string, ownerId string) {
+	db, ok := calendarFeedService(ctx)
+	if !ok {
+		return
+	}
+	if _, ok := findCalendarFeedOwner(ctx, ownerType, ownerId); !ok {
+		return
+	}
+
+	token, tokenHash, err := newCalendarFeedToken()
+	if err != nil {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "Failed to generate token",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	record := CalendarFeedRecord{
+		CalendarFeed: CalendarFeed{
+			Id:        uuid.New().String(),
+			OwnerType: ownerType,
+			OwnerId:   ownerId,
+			CreatedAt: time.Now().UTC(),
+		},
+		TokenHash: tokenHash,
+	}
+	err = db.CreateDocument(ctx, record.Id, &record)
+
+	switch err {
+	case nil:
+		ctx.JSON(
+			http.StatusCreated,
+			CalendarFeedToken{Feed: record.CalendarFeed, Token: token, Url: calendarFeedUrl(ctx, token)},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to create calendar feed in database",
+				"error":   err.Error(),
+			})
+	}
+}
+
+func getCalendarFeeds(ctx *gin.Context, ownerType string, ownerId string) {
+	db, ok := calendarFeedService(ctx)
+	if !ok {
+		return
+	}
+	if _, ok := findCalendarFeedOwner(ctx, ownerType, ownerId); !ok {
+		return
+	}
+
+	records, err := db.FindDocuments(ctx, db_service.NewQuery(db_service.Eq("ownerid", ownerId)).SortBy("createdat", false))
+	if err != nil {
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to load calendar feeds from database",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	feeds := make([]CalendarFeed, 0, len(records))
+	for _, record := range records {
+		feeds = append(feeds, record.CalendarFeed)
+	}
+	ctx.JSON(
+		http.StatusOK,
+		feeds,
+	)
+}
+
+func calendarFeedService(ctx *gin.Context) (db_service.DbService[CalendarFeedRecord], bool) {
+	value, exists := ctx.Get("db_service_calendar_feed")
+	if !exists {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service not found",
+				"error":   "db_service not found",
+			})
+		return nil, false
+	}
+
+	db, ok := value.(db_service.DbService[CalendarFeedRecord])
+	if !ok {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service context is not of type db_service.DbService",
+				"error":   "cannot cast db_service context to db_service.DbService",
+			})
+		return nil, false
+	}
+	return db, true
+}
+
+var calendarFeedOwnerNames = map[string]string{
+	calendarFeedOwnerPatient:   "Patient",
+	calendarFeedOwnerAmbulance: "Ambulance",
+}
+
+// findCalendarFeedOwner returns the calendar name of the feed owner, it
+// responds with error when the owner does not exist
+func findCalendarFeedOwner(ctx *gin.Context, ownerType string, ownerId string) (string, bool) {
+	_, patientDB, ambulanceDB, ok := reservationServices(ctx)
+	if !ok {
+		return "", false
+	}
+
+	var name string
+	var err error
+	if ownerType == calendarFeedOwnerAmbulance {
+		var ambulance *Ambulance
+		if ambulance, err = ambulanceDB.FindDocument(ctx, ownerId); err == nil {
+			name = ambulance.Name
+		}
+	} else {
+		var patient *Patient
+		if patient, err = patientDB.FindDocument(ctx, ownerId); err == nil {
+			name = patient.FirstName + " " + patient.LastName
+		}
+	}
+
+	switch err {
+	case nil:
+		return name, true
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": calendarFeedOwnerNames[ownerType] + " not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to load calendar feed owner from database",
+				"error":   err.Error(),
+			})
+	}
+	return "", false
+}
@@ -0,0 +1,781 @@
+package reservation
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/fhir"
+)
+
+// AddFhirRoutes registers HL7 FHIR R4 facade over patients, ambulances and
+// reservations. Ambulances are published as Location, HealthcareService and
+// Schedule sharing the ambulance id, reservations as Appointment and free
+// time slots as Slot.
+func AddFhirRoutes(engine *gin.Engine) {
+	group := engine.Group(fhirBasePath)
+	api := &implFhirAPI{}
+
+	group.Handle(http.MethodGet, "/metadata", api.GetCapabilityStatement)
+	group.Handle(http.MethodGet, "/Appointment", api.SearchAppointments)
+	group.Handle(http.MethodPost, "/Appointment", api.CreateAppointment)
+	group.Handle(http.MethodGet, "/Appointment/$find", api.FindAppointments)
+	group.Handle(http.MethodGet, "/Appointment/:id", api.ReadAppointment)
+	group.Handle(http.MethodGet, "/HealthcareService", api.searchAmbulances(fhirHealthcareServiceResource))
+	group.Handle(http.MethodGet, "/HealthcareService/:id", api.readAmbulance(fhirHealthcareServiceResource))
+	group.Handle(http.MethodGet, "/Location", api.searchAmbulances(fhirLocationResource))
+	group.Handle(http.MethodGet, "/Location/:id", api.readAmbulance(fhirLocationResource))
+	group.Handle(http.MethodGet, "/Patient", api.SearchPatients)
+	group.Handle(http.MethodPost, "/Patient", api.CreatePatient)
+	group.Handle(http.MethodGet, "/Patient/:id", api.ReadPatient)
+	group.Handle(http.MethodGet, "/Schedule", api.searchAmbulances(fhirScheduleResource))
+	group.Handle(http.MethodGet, "/Schedule/:id", api.readAmbulance(fhirScheduleResource))
+	group.Handle(http.MethodGet, "/Slot", api.SearchSlots)
+	group.Handle(http.MethodGet, "/Slot/:id", api.ReadSlot)
+}
+
+type implFhirAPI struct {
+}
+
+// fhirAmbulanceResource maps the ambulance to one of the resources it is published as
+type fhirAmbulanceResource struct {
+	resourceType string
+	mapper       func(Ambulance) interface{}
+}
+
+var (
+	fhirLocationResource = fhirAmbulanceResource{"Location", func(ambulance Ambulance) interface{} {
+		return fhirLocation(ambulance)
+	}}
+	fhirHealthcareServiceResource = fhirAmbulanceResource{"HealthcareService", func(ambulance Ambulance) interface{} {
+		return fhirHealthcareService(ambulance)
+	}}
+	fhirScheduleResource = fhirAmbulanceResource{"Schedule", func(ambulance Ambulance) interface{} {
+		return fhirSchedule(ambulance)
+	}}
+)
+
+// GetCapabilityStatement - Describes the supported resources and search parameters
+func (this *implFhirAPI) GetCapabilityStatement(ctx *gin.Context) {
+	read := fhir.CapabilityStatementInteraction{Code: "read"}
+	search := fhir.CapabilityStatementInteraction{Code: "search-type"}
+	create := fhir.CapabilityStatementInteraction{Code: "create"}
+	param := func(name string, paramType string) fhir.CapabilityStatementSearchParam {
+		return fhir.CapabilityStatementSearchParam{Name: name, Type: paramType}
+	}
+	ambulanceParams := []fhir.CapabilityStatementSearchParam{param("_id", "token"), param("name", "string"), param("service-type", "token")}
+
+	writeFhir(ctx, http.StatusOK, fhir.NewCapabilityStatement(
+		fhir.CapabilityStatementResource{
+			Type:        "Appointment",
+			Interaction: []fhir.CapabilityStatementInteraction{read, search, create},
+			SearchParam: []fhir.CapabilityStatementSearchParam{
+				param("_id", "token"), param("patient", "reference"), param("location", "reference"),
+				param("date", "date"), param("status", "token"), param("service-type", "token"),
+			},
+			Operation: []fhir.CapabilityStatementOperation{
+				{Name: "find", Definition: fhirBaseUrl(ctx) + "/Appointment/$find"},
+			},
+		},
+		fhir.CapabilityStatementResource{
+			Type:        "HealthcareService",
+			Interaction: []fhir.CapabilityStatementInteraction{read, search},
+			SearchParam: ambulanceParams,
+		},
+		fhir.CapabilityStatementResource{
+			Type:        "Location",
+			Interaction: []fhir.CapabilityStatementInteraction{read, search},
+			SearchParam: ambulanceParams,
+		},
+		fhir.CapabilityStatementResource{
+			Type:        "Patient",
+			Interaction: []fhir.CapabilityStatementInteraction{read, search, create},
+			SearchParam: []fhir.CapabilityStatementSearchParam{
+				param("_id", "token"), param("name", "string"), param("family", "string"),
+				param("given", "string"), param("birthdate", "date"), param("gender", "token"),
+			},
+		},
+		fhir.CapabilityStatementResource{
+			Type:        "Schedule",
+			Interaction: []fhir.CapabilityStatementInteraction{read, search},
+			SearchParam: ambulanceParams,
+		},
+		fhir.CapabilityStatementResource{
+			Type:        "Slot",
+			Interaction: []fhir.CapabilityStatementInteraction{read, search},
+			SearchParam: []fhir.CapabilityStatementSearchParam{
+				param("service-type", "token"), param("start", "date"), param("schedule", "reference"), param("status", "token"),
+			},
+		},
+	))
+}
+
+// CreateAppointment - Books the appointment, either by the slot reference
+// or by start, end, service type and location
+func (this *implFhirAPI) CreateAppointment(ctx *gin.Context) {
+	reservationDB, patientDB, ambulanceDB, ok := fhirServices(ctx)
+	if !ok {
+		return
+	}
+	staffDB, ok := fhirStaffService(ctx)
+	if !ok {
+		return
+	}
+	waitlistDB, ok := fhirWaitlistService(ctx)
+	if !ok {
+		return
+	}
+	transactorValue, exists := ctx.Get("db_transactor")
+	if !exists {
+		fhirError(ctx, http.StatusInternalServerError, "exception", "db_transactor not found")
+		return
+	}
+	transactor, ok := transactorValue.(db_service.Transactor)
+	if !ok {
+		fhirError(ctx, http.StatusInternalServerError, "exception", "cannot cast db_transactor context to db_service.Transactor")
+		return
+	}
+
+	resource := fhir.Appointment{}
+	if err := ctx.BindJSON(&resource); err != nil {
+		fhirError(ctx, http.StatusBadRequest, "structure", err.Error())
+		return
+	}
+	if resource.ResourceType != "Appointment" {
+		fhirError(ctx, http.StatusBadRequest, "invalid", "resourceType must be Appointment")
+		return
+	}
+	switch resource.Status {
+	case "", "proposed", "pending", "booked":
+	default:
+		fhirError(ctx, http.StatusBadRequest, "invalid", "only proposed, pending or booked appointments can be created")
+		return
+	}
+
+	request := ReservationInput{Message: resource.Comment}
+	if len(resource.Slot) > 0 {
+		slotId, ok := fhir.ParseReference(resource.Slot[0].Reference, "Slot")
+		if !ok {
+			fhirError(ctx, http.StatusBadRequest, "invalid", "slot must reference Slot")
+			return
+		}
+		ambulanceId, examinationType, start, err := parseFhirSlotId(slotId)
+		if err != nil {
+			fhirError(ctx, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+		request.AmbulanceId = ambulanceId
+		request.ExaminationType = examinationType
+		request.Start = start
+		request.End = start.Add(examinationTimes[examinationType])
+	} else {
+		ambulanceId, ok := resource.Actor("Location")
+		if !ok {
+			ambulanceId, ok = resource.Actor("HealthcareService")
+		}
+		examinationType, examinationOK := examinationFromConcepts(resource.ServiceType)
+		if !ok || !examinationOK || resource.Start == nil || resource.End == nil {
+			fhirError(ctx, http.StatusBadRequest, "required", "slot, or start, end, serviceType and Location participant are required")
+			return
+		}
+		request.AmbulanceId = ambulanceId
+		request.ExaminationType = examinationType
+		request.Start = *resource.Start
+		request.End = *resource.End
+	}
+
+	patientId, ok := resource.Actor("Patient")
+	if !ok {
+		fhirError(ctx, http.StatusBadRequest, "required", "Patient participant is required")
+		return
+	}
+
+	patient, err := patientDB.FindDocument(ctx, patientId)
+	switch err {
+	case nil:
+	case db_service.ErrNotFound:
+		fhirError(ctx, http.StatusNotFound, "not-found", "Patient not found")
+		return
+	default:
+		fhirError(ctx, http.StatusBadGateway, "exception", err.Error())
+		return
+	}
+
+	ambulance, err := ambulanceDB.FindDocument(ctx, request.AmbulanceId)
+	switch err {
+	case nil:
+	case db_service.ErrNotFound:
+		fhirError(ctx, http.StatusNotFound, "not-found", "Location not found")
+		return
+	default:
+		fhirError(ctx, http.StatusBadGateway, "exception", err.Error())
+		return
+	}
+
+	reservation := Reservation{
+		Id:              uuid.New().String(),
+		Patient:         *patient,
+		Ambulance:       *ambulance,
+		Start:           request.Start,
+		End:             request.End,
+		ExaminationType: request.ExaminationType,
+		Message:         request.Message,
+	}
+	if err := reservation.Validate(); err != nil {
+		fhirError(ctx, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	request.Id = reservation.Id
+	request.PatientId = patient.Id
+
+	created, err := createReservation(ctx, transactor, reservationDB, patientDB, ambulanceDB, staffDB, waitlistDB, &request)
+
+	switch err {
+	case nil:
+		ctx.Header("Location", fhirBaseUrl(ctx)+"/Appointment/"+created.Id)
+		writeFhir(ctx, http.StatusCreated, fhirAppointment(*created))
+	case errReservationOverlap:
+		fhirError(ctx, http.StatusConflict, "conflict", "The time slot is already reserved")
+	case errNoStaffAvailable:
+		fhirError(ctx, http.StatusConflict, "conflict", "No staff member is available in the time slot")
+	case db_service.ErrNotFound:
+		fhirError(ctx, http.StatusNotFound, "not-found", "Location was deleted while processing the request")
+	default:
+		fhirError(ctx, http.StatusBadGateway, "exception", err.Error())
+	}
+}
+
+// CreatePatient - Creates the patient
+func (this *implFhirAPI) CreatePatient(ctx *gin.Context) {
+	_, db, _, ok := fhirServices(ctx)
+	if !ok {
+		return
+	}
+
+	resource := fhir.Patient{}
+	if err := ctx.BindJSON(&resource); err != nil {
+		fhirError(ctx, http.StatusBadRequest, "structure", err.Error())
+		return
+	}
+
+	patient, err := patientFromFhir(resource)
+	if err == nil {
+		err = patient.Validate()
+	}
+	if err != nil {
+		fhirError(ctx, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	// server assigns ids of created resources
+	patient.Id = uuid.New().String()
+	err = db.CreateDocument(ctx, patient.Id, &patient)
+
+	switch err {
+	case nil:
+		ctx.Header("Location", fhirBaseUrl(ctx)+"/Patient/"+patient.Id)
+		writeFhir(ctx, http.StatusCreated, fhirPatient(patient))
+	case db_service.ErrConflict:
+		fhirError(ctx, http.StatusConflict, "duplicate", "Patient already exists")
+	default:
+		fhirError(ctx, http.StatusBadGateway, "exception", err.Error())
+	}
+}
+
+// FindAppointments - Proposes appointments in free slots for the examination
+func (this *implFhirAPI) FindAppointments(ctx *gin.Context) {
+	reservationDB, patientDB, ambulanceDB, ok := fhirServices(ctx)
+	if !ok {
+		return
+	}
+	staffDB, ok := fhirStaffService(ctx)
+	if !ok {
+		return
+	}
+	waitlistDB, ok := fhirWaitlistService(ctx)
+	if !ok {
+		return
+	}
+
+	examinationType := MedicalExaminations(fhirTokenParam(ctx.Query("service-type")))
+	if !examinationType.IsValid() {
+		fhirError(ctx, http.StatusBadRequest, "required", "service-type must be one of the examination types")
+		return
+	}
+
+	start, startErr := fhir.ParseDateParam(ctx.Query("start"))
+	end, endErr := fhir.ParseDateParam(ctx.Query("end"))
+	if startErr != nil || endErr != nil || start.Prefix != "eq" || end.Prefix != "eq" {
+		fhirError(ctx, http.StatusBadRequest, "required", "start and end dates are required")
+		return
+	}
+	lower, upper, err := fhirSlotSearchRange([]string{"ge" + ctx.Query("start"), "le" + ctx.Query("end")})
+	if err != nil {
+		fhirError(ctx, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	var patient *Patient
+	if patientParam := ctx.Query("patient"); patientParam != "" {
+		patient, err = patientDB.FindDocument(ctx, fhirReferenceParam(patientParam, "Patient"))
+		switch err {
+		case nil:
+		case db_service.ErrNotFound:
+			fhirError(ctx, http.StatusNotFound, "not-found", "Patient not found")
+			return
+		default:
+			fhirError(ctx, http.StatusBadGateway, "exception", err.Error())
+			return
+		}
+	}
+
+	skip, limit, err := fhirPagination(ctx)
+	if err != nil {
+		fhirError(ctx, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	examinations, err := findFhirSlots(ctx, reservationDB, ambulanceDB, staffDB, waitlistDB, examinationType, lower, upper, fhirReferenceParam(ctx.Query("location"), "Location"))
+	if err != nil {
+		fhirError(ctx, http.StatusBadGateway, "exception", err.Error())
+		return
+	}
+
+	total := int64(len(examinations))
+	bundle := fhir.NewSearchSet(total)
+	for _, examination := range pageOf(examinations, skip, limit) {
+		bundle.Entry = append(bundle.Entry, fhir.BundleEntry{
+			Resource: fhirProposedAppointment(examination, patient),
+			Search:   &fhir.BundleSearch{Mode: "match"},
+		})
+	}
+	addFhirPageLinks(ctx, bundle, skip, limit, total)
+	writeFhir(ctx, http.StatusOK, bundle)
+}
+
+// ReadAppointment - Reads the appointment
+func (this *implFhirAPI) ReadAppointment(ctx *gin.Context) {
+	reservationDB, patientDB, ambulanceDB, ok := fhirServices(ctx)
+	if !ok {
+		return
+	}
+
+	reservationInput, err := reservationDB.FindDocument(ctx, ctx.Param("id"))
+	if err == nil {
+		var reservations []Reservation
+		reservations, err = expandReservations(ctx, patientDB, ambulanceDB, []ReservationInput{*reservationInput})
+		if err == nil {
+			writeFhir(ctx, http.StatusOK, fhirAppointment(reservations[0]))
+			return
+		}
+	}
+
+	switch err {
+	case db_service.ErrNotFound:
+		fhirError(ctx, http.StatusNotFound, "not-found", "Appointment not found")
+	default:
+		fhirError(ctx, http.StatusBadGateway, "exception", err.Error())
+	}
+}
+
+// ReadPatient - Reads the patient
+func (this *implFhirAPI) ReadPatient(ctx *gin.Context) {
+	_, db, _, ok := fhirServices(ctx)
+	if !ok {
+		return
+	}
+
+	patient, err := db.FindDocument(ctx, ctx.Param("id"))
+
+	switch err {
+	case nil:
+		writeFhir(ctx, http.StatusOK, fhirPatient(*patient))
+	case db_service.ErrNotFound:
+		fhirError(ctx, http.StatusNotFound, "not-found", "Patient not found")
+	default:
+		fhirError(ctx, http.StatusBadGateway, "exception", err.Error())
+	}
+}
+
+// ReadSlot - Reads the slot, it is busy when the time was reserved meanwhile
+func (this *implFhirAPI) ReadSlot(ctx *gin.Context) {
+	reservationDB, _, ambulanceDB, ok := fhirServices(ctx)
+	if !ok {
+		return
+	}
+	staffDB, ok := fhirStaffService(ctx)
+	if !ok {
+		return
+	}
+	waitlistDB, ok := fhirWaitlistService(ctx)
+	if !ok {
+		return
+	}
+
+	ambulanceId, examinationType, start, err := parseFhirSlotId(ctx.Param("id"))
+	if err != nil {
+		fhirError(ctx, http.StatusNotFound, "not-found", err.Error())
+		return
+	}
+
+	ambulance, err := ambulanceDB.FindDocument(ctx, ambulanceId)
+	switch err {
+	case nil:
+	case db_service.ErrNotFound:
+		fhirError(ctx, http.StatusNotFound, "not-found", "Slot not found")
+		return
+	default:
+		fhirError(ctx, http.StatusBadGateway, "exception", err.Error())
+		return
+	}
+	if !slices.Contains(ambulance.MedicalExaminations, examinationType) {
+		fhirError(ctx, http.StatusNotFound, "not-found", "Slot not found")
+		return
+	}
+
+	examination := Examination{
+		Ambulance:       *ambulance,
+		Start:           start,
+		End:             start.Add(examinationTimes[examinationType]),
+		ExaminationType: examinationType,
+	}
+	err = checkReservationOverlap(ctx, reservationDB, staffDB, waitlistDB, ambulance, &ReservationInput{
+		AmbulanceId:     ambulance.Id,
+		Start:           examination.Start,
+		End:             examination.End,
+		ExaminationType: examinationType,
+	})
+
+	switch err {
+	case nil:
+		writeFhir(ctx, http.StatusOK, fhirSlot(examination, "free"))
+	case errReservationOverlap, errNoStaffAvailable:
+		writeFhir(ctx, http.StatusOK, fhirSlot(examination, "busy"))
+	default:
+		fhirError(ctx, http.StatusBadGateway, "exception", err.Error())
+	}
+}
+
+// SearchAppointments - Searches appointments by patient, location, date, status and service type
+func (this *implFhirAPI) SearchAppointments(ctx *gin.Context) {
+	reservationDB, patientDB, ambulanceDB, ok := fhirServices(ctx)
+	if !ok {
+		return
+	}
+
+	skip, limit, err := fhirPagination(ctx)
+	if err != nil {
+		fhirError(ctx, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	filters := []db_service.Filter{}
+	if id := ctx.Query("_id"); id != "" {
+		filters = append(filters, db_service.Eq("id", id))
+	}
+	if patient := ctx.Query("patient"); patient != "" {
+		filters = append(filters, db_service.Eq("patientid", fhirReferenceParam(patient, "Patient")))
+	}
+	if location := ctx.Query("location"); location != "" {
+		filters = append(filters, db_service.Eq("ambulanceid", fhirReferenceParam(location, "Location")))
+	}
+	if serviceType := ctx.Query("service-type"); serviceType != "" {
+		filters = append(filters, db_service.Eq("examinationtype", fhirTokenParam(serviceType)))
+	}
+	for _, value := range ctx.QueryArray("date") {
+		param, err := fhir.ParseDateParam(value)
+		if err != nil {
+			fhirError(ctx, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+		filters = append(filters, fhirDateFilter("start", param, fhirInstantBound))
+	}
+	if statusValues := fhirQueryValues(ctx.Request.URL.Query(), "status"); len(statusValues) > 0 {
+		statusFilters := []db_service.Filter{}
+		for _, value := range statusValues {
+			status, ok := fhirAppointmentStatus(value)
+			if !ok {
+				continue
+			}
+			if status == SCHEDULED {
+				// reservations stored before cancellation was introduced have no status
+				statusFilters = append(statusFilters, activeReservationFilter())
+			} else {
+				statusFilters = append(statusFilters, db_service.Eq("status", status))
+			}
+		}
+		if len(statusFilters) == 0 {
+			// none of the statuses is used by reservations
+			statusFilters = append(statusFilters, db_service.Exists("id", false))
+		}
+		filters = append(filters, db_service.Or(statusFilters...))
+	}
+
+	query := db_service.NewQuery(db_service.And(filters...)).SortBy("start", false).SortBy("id", false)
+	total, err := reservationDB.CountDocuments(ctx, query)
+	var reservations []Reservation
+	if err == nil {
+		var reservationInputs []ReservationInput
+		reservationInputs, err = reservationDB.FindDocuments(ctx, query.Page(skip, limit))
+		if err == nil {
+			reservations, err = expandReservations(ctx, patientDB, ambulanceDB, reservationInputs)
+		}
+	}
+	if err != nil {
+		fhirError(ctx, http.StatusBadGateway, "exception", err.Error())
+		return
+	}
+
+	bundle := fhir.NewSearchSet(total)
+	for _, reservation := range reservations {
+		bundle.AddMatch(fhirBaseUrl(ctx), "Appointment", reservation.Id, fhirAppointment(reservation))
+	}
+	addFhirPageLinks(ctx, bundle, skip, limit, total)
+	writeFhir(ctx, http.StatusOK, bundle)
+}
+
+// SearchPatients - Searches patients by name, birth date and gender
+func (this *implFhirAPI) SearchPatients(ctx *gin.Context) {
+	_, db, _, ok := fhirServices(ctx)
+	if !ok {
+		return
+	}
+
+	skip, limit, err := fhirPagination(ctx)
+	if err != nil {
+		fhirError(ctx, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	// string parameters match case and diacritics insensitive prefixes, see
+	// https://hl7.org/fhir/R4/search.html#string
+	filters := []db_service.Filter{}
+	if id := ctx.Query("_id"); id != "" {
+		filters = append(filters, db_service.Eq("id", id))
+	}
+	for _, word := range strings.Fields(ctx.Query("name")) {
+		filters = append(filters, namePrefixFilter(word))
+	}
+	if family := ctx.Query("family"); family != "" {
+		filters = append(filters, db_service.Gte("lastname", family), db_service.Lt("lastname", family+"\uffff"))
+	}
+	if given := ctx.Query("given"); given != "" {
+		filters = append(filters, db_service.Gte("firstname", given), db_service.Lt("firstname", given+"\uffff"))
+	}
+	if gender := ctx.Query("gender"); gender != "" {
+		filters = append(filters, db_service.Eq("sex", fhirTokenParam(gender)))
+	}
+	for _, value := range ctx.QueryArray("birthdate") {
+		param, err := fhir.ParseDateParam(value)
+		if err != nil {
+			fhirError(ctx, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+		// birthdays are stored as YYYY-MM-DD, so they compare as strings
+		filters = append(filters, fhirDateFilter("birthday", param, fhirDateBound))
+	}
+
+	query := db_service.NewQuery(db_service.And(filters...)).
+		WithCollation(patientNameCollationLocale, patientNameCollationStrength).
+		SortBy("lastname", false).SortBy("firstname", false).SortBy("id", false)
+
+	total, err := db.CountDocuments(ctx, query)
+	var patients []Patient
+	if err == nil {
+		patients, err = db.FindDocuments(ctx, query.Page(skip, limit))
+	}
+	if err != nil {
+		fhirError(ctx, http.StatusBadGateway, "exception", err.Error())
+		return
+	}
+
+	bundle := fhir.NewSearchSet(total)
+	for _, patient := range patients {
+		bundle.AddMatch(fhirBaseUrl(ctx), "Patient", patient.Id, fhirPatient(patient))
+	}
+	addFhirPageLinks(ctx, bundle, skip, limit, total)
+	writeFhir(ctx, http.StatusOK, bundle)
+}
+
+// SearchSlots - Searches free slots for the examination, the slots are
+// computed from office hours and reservations of the ambulances
+func (this *implFhirAPI) SearchSlots(ctx *gin.Context) {
+	reservationDB, _, ambulanceDB, ok := fhirServices(ctx)
+	if !ok {
+		return
+	}
+	staffDB, ok := fhirStaffService(ctx)
+	if !ok {
+		return
+	}
+	waitlistDB, ok := fhirWaitlistService(ctx)
+	if !ok {
+		return
+	}
+
+	examinationType := MedicalExaminations(fhirTokenParam(ctx.Query("service-type")))
+	if !examinationType.IsValid() {
+		fhirError(ctx, http.StatusBadRequest, "required", "service-type must be one of the examination types")
+		return
+	}
+
+	lower, upper, err := fhirSlotSearchRange(ctx.QueryArray("start"))
+	if err != nil {
+		fhirError(ctx, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	skip, limit, err := fhirPagination(ctx)
+	if err != nil {
+		fhirError(ctx, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	examinations := []Examination{}
+	statusValues := fhirQueryValues(ctx.Request.URL.Query(), "status")
+	// only free slots are published, busy time belongs to the appointments
+	if len(statusValues) == 0 || slices.Contains(statusValues, "free") {
+		examinations, err = findFhirSlots(ctx, reservationDB, ambulanceDB, staffDB, waitlistDB, examinationType, lower, upper, fhirReferenceParam(ctx.Query("schedule"), "Schedule"))
+		if err != nil {
+			fhirError(ctx, http.StatusBadGateway, "exception", err.Error())
+			return
+		}
+	}
+
+	total := int64(len(examinations))
+	bundle := fhir.NewSearchSet(total)
+	for _, examination := range pageOf(examinations, skip, limit) {
+		slot := fhirSlot(examination, "free")
+		bundle.AddMatch(fhirBaseUrl(ctx), "Slot", slot.Id, slot)
+	}
+	addFhirPageLinks(ctx, bundle, skip, limit, total)
+	writeFhir(ctx, http.StatusOK, bundle)
+}
+
+func (this *implFhirAPI) readAmbulance(resource fhirAmbulanceResource) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		_, _, db, ok := fhirServices(ctx)
+		if !ok {
+			return
+		}
+
+		ambulance, err := db.FindDocument(ctx, ctx.Param("id"))
+
+		switch err {
+		case nil:
+			writeFhir(ctx, http.StatusOK, resource.mapper(*ambulance))
+		case db_service.ErrNotFound:
+			fhirError(ctx, http.StatusNotFound, "not-found", resource.resourceType+" not found")
+		default:
+			fhirError(ctx, http.StatusBadGateway, "exception", err.Error())
+		}
+	}
+}
+
+func (this *implFhirAPI) searchAmbulances(resource fhirAmbulanceResource) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		_, _, db, ok := fhirServices(ctx)
+		if !ok {
+			return
+		}
+
+		skip, limit, err := fhirPagination(ctx)
+		if err != nil {
+			fhirError(ctx, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+
+		filters := []db_service.Filter{}
+		if id := ctx.Query("_id"); id != "" {
+			filters = append(filters, db_service.Eq("id", id))
+		}
+		if name := ctx.Query("name"); name != "" {
+			filters = append(filters, db_service.Gte("name", name), db_service.Lt("name", name+"\uffff"))
+		}
+		if serviceType := ctx.Query("service-type"); serviceType != "" {
+			filters = append(filters, db_service.Eq("medicalexaminations", fhirTokenParam(serviceType)))
+		}
+
+		query := db_service.NewQuery(db_service.And(filters...)).SortBy("name", false).SortBy("id", false)
+		total, err := db.CountDocuments(ctx, query)
+		var ambulances []Ambulance
+		if err == nil {
+			ambulances, err = db.FindDocuments(ctx, query.Page(skip, limit))
+		}
+		if err != nil {
+			fhirError(ctx, http.StatusBadGateway, "exception", err.Error())
+			return
+		}
+
+		bundle := fhir.NewSearchSet(total)
+		for _, ambulance := range ambulances {
+			bundle.AddMatch(fhirBaseUrl(ctx), resource.resourceType, ambulance.Id, resource.mapper(ambulance))
+		}
+		addFhirPageLinks(ctx, bundle, skip, limit, total)
+		writeFhir(ctx, http.StatusOK, bundle)
+	}
+}
+
+// fhirServices returns db services of the facade, it responds with
+// OperationOutcome when they are missing
+func fhirServices(ctx *gin.Context) (
+	db_service.DbService[ReservationInput],
+	db_service.DbService[Patient],
+	db_service.DbService[Ambulance],
+	bool,
+) {
+	reservationValue, reservationExists := ctx.Get("db_service_reservation")
+	patientValue, patientExists := ctx.Get("db_service_patient")
+	ambulanceValue, ambulanceExists := ctx.Get("db_service_ambulance")
+	if !reservationExists || !patientExists || !ambulanceExists {
+		fhirError(ctx, http.StatusInternalServerError, "exception", "db_service not found")
+		return nil, nil, nil, false
+	}
+
+	reservationDB, reservationOK := reservationValue.(db_service.DbService[ReservationInput])
+	patientDB, patientOK := patientValue.(db_service.DbService[Patient])
+	ambulanceDB, ambulanceOK := ambulanceValue.(db_service.DbService[Ambulance])
+	if !reservationOK || !patientOK || !ambulanceOK {
+		fhirError(ctx, http.StatusInternalServerError, "exception", "cannot cast db_service context to db_service.DbService")
+		return nil, nil, nil, false
+	}
+	return reservationDB, patientDB, ambulanceDB, true
+}
+
+// fhirStaffService returns the staff db service, it responds with
+// OperationOutcome when it is missing
+func fhirStaffService(ctx *gin.Context) (db_service.DbService[Staff], bool) {
+	value, exists := ctx.Get("db_service_staff")
+	if !exists {
+		fhirError(ctx, http.StatusInternalServerError, "exception", "db_service not found")
+		return nil, false
+	}
+
+	staffDB, ok := value.(db_service.DbService[Staff])
+	if !ok {
+		fhirError(ctx, http.StatusInternalServerError, "exception", "cannot cast db_service context to db_service.DbService")
+		return nil, false
+	}
+	return staffDB, true
+}
+
+// fhirWaitlistService returns the waitlist db service, it responds with
+// OperationOutcome when it is missing
+func fhirWaitlistService(ctx *gin.Context) (db_service.DbService[WaitlistEntry], bool) {
+	value, exists := ctx.Get("db_service_waitlist")
+	if !exists {
+		fhirError(ctx, http.StatusInternalServerError, "exception", "db_service not found")
+		return nil, false
+	}
+
+	waitlistDB, ok := value.(db_service.DbService[WaitlistEntry])
+	if !ok {
+		fhirError(ctx, http.StatusInternalServerError, "exception", "cannot cast db_service context to db_service.DbService")
+		return nil, false
+	}
+	return waitlistDB, true
+}
@@ -0,0 +1,189 @@
+package reservation
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/hl7"
+)
+
+// GetHl7Message - Get the HL7 message in ER7 encoding
+func (this *implHl7API) GetHl7Message(ctx *gin.Context) {
+	db, ok := hl7MessageService(ctx)
+	if !ok {
+		return
+	}
+
+	message, err := db.FindDocument(ctx, ctx.Param("messageId"))
+
+	switch err {
+	case nil:
+		ctx.Data(http.StatusOK, hl7.ContentType, []byte(message.Message))
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "HL7 message not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to load HL7 message from database",
+				"error":   err.Error(),
+			})
+	}
+}
+
+// GetHl7Messages - Get HL7 SIU messages of reservation events
+func (this *implHl7API) GetHl7Messages(ctx *gin.Context) {
+	db, ok := hl7MessageService(ctx)
+	if !ok {
+		return
+	}
+
+	badRequest := func(err error) {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid query parameters",
+				"error":   err.Error(),
+			})
+	}
+
+	skip, limit, err := parsePagination(ctx)
+	if err != nil {
+		badRequest(err)
+		return
+	}
+
+	filters := []db_service.Filter{}
+
+	if since := ctx.Query("since"); since != "" {
+		sinceTime, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			badRequest(fmt.Errorf("Failed to parse since: %v", err))
+			return
+		}
+		filters = append(filters, db_service.Gt("createdat", sinceTime))
+	}
+
+	if reservationId := ctx.Query("reservationId"); reservationId != "" {
+		filters = append(filters, db_service.Eq("reservationid", reservationId))
+	}
+
+	if status := ctx.Query("status"); status != "" {
+		switch Hl7MessageStatus(status) {
+		case PENDING, SENT, FAILED:
+			filters = append(filters, db_service.Eq("status", status))
+		default:
+			badRequest(fmt.Errorf("Invalid status: %v", status))
+			return
+		}
+	}
+
+	query := db_service.NewQuery(db_service.And(filters...)).SortBy("createdat", false).SortBy("id", false)
+
+	total, err := db.CountDocuments(ctx, query)
+	var messages []Hl7Message
+	if err == nil {
+		messages, err = db.FindDocuments(ctx, query.Page(skip, limit))
+	}
+	if err != nil {
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to retrieve HL7 messages from database",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	if len(messages) == 0 {
+		messages = []Hl7Message{}
+	}
+
+	setTotalCount(ctx, total)
+	ctx.JSON(
+		http.StatusOK,
+		messages,
+	)
+}
+
+// ResendHl7Message - Schedules the message to be pushed again
+func (this *implHl7API) ResendHl7Message(ctx *gin.Context) {
+	db, ok := hl7MessageService(ctx)
+	if !ok {
+		return
+	}
+
+	messageId := ctx.Param("messageId")
+	message, err := db.FindDocument(ctx, messageId)
+	if err == nil {
+		message.Status = PENDING
+		message.Attempts = 0
+		message.SentAt = time.Time{}
+		err = db.UpdateDocument(ctx, messageId, message)
+	}
+
+	switch err {
+	case nil:
+		ctx.JSON(
+			http.StatusOK,
+			message,
+		)
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "HL7 message not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to update HL7 message in database",
+				"error":   err.Error(),
+			})
+	}
+}
+
+func hl7MessageService(ctx *gin.Context) (db_service.DbService[Hl7Message], bool) {
+	value, exists := ctx.Get("db_service_hl7_message")
+	if !exists {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service not found",
+				"error":   "db_service not found",
+			})
+		return nil, false
+	}
+
+	db, ok := value.(db_service.DbService[Hl7Message])
+	if !ok {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service context is not of type db_service.DbService",
+				"error":   "cannot cast db_service context to db_service.DbService",
+			})
+		return nil, false
+	}
+	return db, true
+}
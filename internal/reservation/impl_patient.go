@@ -1,7 +1,13 @@
 package reservation
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -136,13 +142,28 @@ func (this *implPatientAPI) CreateReservation(ctx *gin.Context) {
 		return
 	}
 
+	// occurrences of a series are created by the reservation series endpoints
+	if request.SeriesId != "" || !request.RecurrenceId.IsZero() {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid reservation data",
+				"error":   "seriesId and recurrenceId are read-only, create reservation series instead",
+			})
+		return
+	}
+
 	reservation := Reservation{}
 
 	// Fetch patient and ambulance from database
 	patientValue, patientExists := ctx.Get("db_service_patient")
 	ambulanceValue, ambulanceExists := ctx.Get("db_service_ambulance")
+	staffValue, staffExists := ctx.Get("db_service_staff")
+	waitlistValue, waitlistExists := ctx.Get("db_service_waitlist")
+	transactorValue, transactorExists := ctx.Get("db_transactor")
 
-	if !patientExists || !ambulanceExists {
+	if !patientExists || !ambulanceExists || !staffExists || !waitlistExists || !transactorExists {
 		ctx.JSON(
 			http.StatusInternalServerError,
 			gin.H{
@@ -155,8 +176,11 @@ func (this *implPatientAPI) CreateReservation(ctx *gin.Context) {
 
 	patientDB, patientOK := patientValue.(db_service.DbService[Patient])
 	ambulanceDB, ambulanceOK := ambulanceValue.(db_service.DbService[Ambulance])
+	staffDB, staffOK := staffValue.(db_service.DbService[Staff])
+	waitlistDB, waitlistOK := waitlistValue.(db_service.DbService[WaitlistEntry])
+	transactor, transactorOK := transactorValue.(db_service.Transactor)
 
-	if !patientOK || !ambulanceOK {
+	if !patientOK || !ambulanceOK || !staffOK || !waitlistOK || !transactorOK {
 		ctx.JSON(
 			http.StatusInternalServerError,
 			gin.H{
@@ -171,7 +195,19 @@ func (this *implPatientAPI) CreateReservation(ctx *gin.Context) {
 	patientId := ctx.Param("patientId")
 	patient, err := patientDB.FindDocument(ctx, patientId)
 
-	if err != nil {
+	switch err {
+	case nil:
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Patient not found",
+				"error":   err.Error(),
+			},
+		)
+		return
+	default:
 		ctx.JSON(
 			http.StatusBadGateway,
 			gin.H{
@@ -187,7 +223,19 @@ func (this *implPatientAPI) CreateReservation(ctx *gin.Context) {
 	ambulanceId := request.AmbulanceId
 	ambulance, err := ambulanceDB.FindDocument(ctx, ambulanceId)
 
-	if err != nil {
+	switch err {
+	case nil:
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Ambulance not found",
+				"error":   err.Error(),
+			},
+		)
+		return
+	default:
 		ctx.JSON(
 			http.StatusBadGateway,
 			gin.H{
@@ -208,16 +256,28 @@ func (this *implPatientAPI) CreateReservation(ctx *gin.Context) {
 	reservation.ExaminationType = request.ExaminationType
 	reservation.Message = request.Message
 
+	err = reservation.Validate()
+	if err != nil {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid reservation data",
+				"error":   err.Error(),
+			})
+		return
+	}
+
 	request.Id = reservation.Id
 	request.PatientId = patient.Id
 
-	err = db.CreateDocument(ctx, reservation.Id, &request)
+	created, err := createReservation(ctx, transactor, db, patientDB, ambulanceDB, staffDB, waitlistDB, &request)
 
 	switch err {
 	case nil:
 		ctx.JSON(
 			http.StatusCreated,
-			reservation,
+			created,
 		)
 	case db_service.ErrConflict:
 		ctx.JSON(
@@ -228,6 +288,33 @@ func (this *implPatientAPI) CreateReservation(ctx *gin.Context) {
 				"error":   err.Error(),
 			},
 		)
+	case errReservationOverlap:
+		ctx.JSON(
+			http.StatusConflict,
+			gin.H{
+				"status":  "Conflict",
+				"message": "The time slot is already reserved",
+				"error":   err.Error(),
+			},
+		)
+	case errNoStaffAvailable:
+		ctx.JSON(
+			http.StatusConflict,
+			gin.H{
+				"status":  "Conflict",
+				"message": "No staff member is available in the time slot",
+				"error":   err.Error(),
+			},
+		)
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Ambulance was deleted while processing the request",
+				"error":   err.Error(),
+			},
+		)
 	default:
 		ctx.JSON(
 			http.StatusBadGateway,
@@ -244,7 +331,12 @@ func (this *implPatientAPI) CreateReservation(ctx *gin.Context) {
 func (this *implPatientAPI) DeletePatient(ctx *gin.Context) {
 	value, exists := ctx.Get("db_service_patient")
 	reservationValue, reservationExists := ctx.Get("db_service_reservation")
-	if !exists || !reservationExists {
+	waitlistValue, waitlistExists := ctx.Get("db_service_waitlist")
+	feedValue, feedExists := ctx.Get("db_service_calendar_feed")
+	seriesValue, seriesExists := ctx.Get("db_service_reservation_series")
+	ambulanceValue, ambulanceExists := ctx.Get("db_service_ambulance")
+	transactorValue, transactorExists := ctx.Get("db_transactor")
+	if !exists || !reservationExists || !waitlistExists || !feedExists || !seriesExists || !ambulanceExists || !transactorExists {
 		ctx.JSON(
 			http.StatusInternalServerError,
 			gin.H{
@@ -257,7 +349,12 @@ func (this *implPatientAPI) DeletePatient(ctx *gin.Context) {
   
 	db, ok := value.(db_service.DbService[Patient])
 	reservationDB, reservationOK := reservationValue.(db_service.DbService[ReservationInput])
-	if !ok || !reservationOK {
+	waitlistDB, waitlistOK := waitlistValue.(db_service.DbService[WaitlistEntry])
+	feedDB, feedOK := feedValue.(db_service.DbService[CalendarFeedRecord])
+	seriesDB, seriesOK := seriesValue.(db_service.DbService[ReservationSeries])
+	ambulanceDB, ambulanceOK := ambulanceValue.(db_service.DbService[Ambulance])
+	transactor, transactorOK := transactorValue.(db_service.Transactor)
+	if !ok || !reservationOK || !waitlistOK || !feedOK || !seriesOK || !ambulanceOK || !transactorOK {
 		ctx.JSON(
 			http.StatusInternalServerError,
 			gin.H{
@@ -269,10 +366,57 @@ func (this *implPatientAPI) DeletePatient(ctx *gin.Context) {
 	}
   
 	patientId := ctx.Param("patientId")
-	err := db.DeleteDocument(ctx, patientId)
+
+	// delete the patient together with its reservations, reservation series,
+	// waitlist entries and calendar feeds, so no orphans are left behind
+	outbox := hl7Outbox(ctx)
+	var reservationInputs []ReservationInput
+	err := transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		// the patient is loaded first so the deleted reservations can be exported
+		patient, err := db.FindDocument(txCtx, patientId)
+		if err != nil {
+			return err
+		}
+		if err := db.DeleteDocument(txCtx, patientId); err != nil {
+			return err
+		}
+		reservationInputs, err = reservationDB.FindDocuments(txCtx, db_service.NewQuery(db_service.Eq("patientid", patientId)))
+		if err != nil {
+			return err
+		}
+		reservations, err := deletedReservations(txCtx, nil, ambulanceDB, reservationInputs, []Patient{*patient}, nil)
+		if err != nil {
+			return err
+		}
+		if err := outbox.ExportDeleted(txCtx, reservations); err != nil {
+			return err
+		}
+		if err := reservationDB.DeleteDocumentsByField(txCtx, "patientid", patientId); err != nil {
+			return err
+		}
+		if err := seriesDB.DeleteDocumentsByField(txCtx, "patientid", patientId); err != nil {
+			return err
+		}
+		if err := waitlistDB.DeleteDocumentsByField(txCtx, "patientid", patientId); err != nil {
+			return err
+		}
+		return feedDB.DeleteDocumentsByField(txCtx, "ownerid", patientId)
+	})
   
 	switch err {
 	case nil:
+		ambulanceIds := make([]string, 0, len(reservationInputs))
+		reservationIds := make([]string, 0, len(reservationInputs))
+		for _, reservationInput := range reservationInputs {
+			if reservationInput.Start.After(time.Now()) {
+				offerFreedSlot(ctx, reservationInput)
+			}
+			ambulanceIds = append(ambulanceIds, reservationInput.AmbulanceId)
+			reservationIds = append(reservationIds, reservationInput.Id)
+		}
+		touchCalendarFeeds(ctx, ambulanceIds...)
+		publishWebhook(ctx, PATIENT_DELETED, patientDeletedData{PatientId: patientId, ReservationIds: reservationIds})
+		ctx.AbortWithStatus(http.StatusNoContent)
 	case db_service.ErrNotFound:
 		ctx.JSON(
 			http.StatusNotFound,
@@ -282,7 +426,6 @@ func (this *implPatientAPI) DeletePatient(ctx *gin.Context) {
 				"error":   err.Error(),
 			},
 		)
-		return
 	default:
 		ctx.JSON(
 			http.StatusBadGateway,
@@ -291,31 +434,6 @@ func (this *implPatientAPI) DeletePatient(ctx *gin.Context) {
 				"message": "Failed to delete patient from database",
 				"error":   err.Error(),
 			})
-		return
-	}
-
-	err = reservationDB.DeleteDocumentsByField(ctx, "patientid", patientId)
-
-	switch err {
-	case nil:
-		ctx.AbortWithStatus(http.StatusNoContent)
-	case db_service.ErrNotFound:
-		ctx.JSON(
-			http.StatusNotFound,
-			gin.H{
-				"status":  "Not Found",
-				"message": "Reservations not found",
-				"error":   err.Error(),
-			},
-		)
-	default:
-		ctx.JSON(
-			http.StatusBadGateway,
-			gin.H{
-				"status":  "Bad Gateway",
-				"message": "Failed to delete reservations from database",
-				"error":   err.Error(),
-			})
 	}
 }
 
@@ -447,49 +565,66 @@ func (this *implPatientAPI) GetPatientReservations(ctx *gin.Context) {
 		return
 	}
 
-    reservations := make([]Reservation, len(reservationInputs))
-    for i, input := range reservationInputs {
-        patient, err := patientDB.FindDocument(ctx, input.PatientId)
-        if err != nil {
-            ctx.JSON(
-                http.StatusInternalServerError,
-                gin.H{
-                    "status":  "Internal Server Error",
-                    "message": "Failed to retrieve patient from database",
-                    "error":   err.Error(),
-                })
-            return
-        }
-
-        ambulance, err := ambulanceDB.FindDocument(ctx, input.AmbulanceId)
-        if err != nil {
-            ctx.JSON(
-                http.StatusInternalServerError,
-                gin.H{
-                    "status":  "Internal Server Error",
-                    "message": "Failed to retrieve ambulance from database",
-                    "error":   err.Error(),
-                })
-            return
-        }
-
-        reservations[i] = Reservation{
-            Id:           input.Id,
-            Patient:      *patient,
-            Ambulance:    *ambulance,
-            Start:       input.Start,
-            End:         input.End,
-            ExaminationType: input.ExaminationType,
-            Message:     input.Message,
-        }
+    reservations, err := expandReservations(ctx, patientDB, ambulanceDB, reservationInputs)
+    if err != nil {
+        ctx.JSON(
+            http.StatusInternalServerError,
+            gin.H{
+                "status":  "Internal Server Error",
+                "message": "Failed to retrieve reservation details from database",
+                "error":   err.Error(),
+            })
+        return
     }
-    
+
     ctx.JSON(
         http.StatusOK,
         reservations,
     )
 }
 
+// GetPatientReservationsCalendar - Export reservations of the patient as iCalendar
+func (this *implPatientAPI) GetPatientReservationsCalendar(ctx *gin.Context) {
+	reservationDB, patientDB, ambulanceDB, ok := reservationServices(ctx)
+	if !ok {
+		return
+	}
+
+	patientId := ctx.Param("patientId")
+	patient, err := patientDB.FindDocument(ctx, patientId)
+
+	switch err {
+	case nil:
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Patient not found",
+				"error":   err.Error(),
+			},
+		)
+		return
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to load patient from database",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	reservations, ok := loadReservations(ctx, reservationDB, patientDB, ambulanceDB, "patientid", patientId)
+	if !ok {
+		return
+	}
+
+	name := patient.FirstName + " " + patient.LastName
+	writeCalendar(ctx, "patient-"+patientId+".ics", reservationsCalendar(name, reservations, patientCounterpart))
+}
+
 // GetPatients - Get a list of all patients
 func (this *implPatientAPI) GetPatients(ctx *gin.Context) {
 	value, exists := ctx.Get("db_service_patient")
@@ -539,19 +674,94 @@ func (this *implPatientAPI) GetPatients(ctx *gin.Context) {
 	)
 }
 
-func isDatetimeInsideDate(date time.Time, datetime time.Time) bool {
-	year, month, day := date.Date()
-	datetimeYear, datetimeMonth, datetimeDay := datetime.Date()
+// ImportPatients - Import patients from CSV or JSON Lines
+func (this *implPatientAPI) ImportPatients(ctx *gin.Context) {
+	value, exists := ctx.Get("db_service_patient")
+	if !exists {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service not found",
+				"error":   "db_service not found",
+			})
+		return
+	}
 
-	return year == datetimeYear && month == datetimeMonth && day == datetimeDay
+	db, ok := value.(db_service.DbService[Patient])
+	if !ok {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service context is not of type db_service.DbService",
+				"error":   "cannot cast db_service context to db_service.DbService",
+			})
+		return
+	}
+
+	format, ok := PatientImportFormat(ctx.ContentType())
+	if !ok {
+		ctx.JSON(
+			http.StatusUnsupportedMediaType,
+			gin.H{
+				"status":  "Unsupported Media Type",
+				"message": "Import accepts text/csv or application/x-ndjson",
+				"error":   fmt.Sprintf("unsupported content type %q", ctx.ContentType()),
+			})
+		return
+	}
+
+	dryRun := false
+	if value := ctx.Query("dryRun"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			ctx.JSON(
+				http.StatusBadRequest,
+				gin.H{
+					"status":  "Bad Request",
+					"message": "Invalid query parameters",
+					"error":   fmt.Sprintf("Failed to parse dryRun: %v", err),
+				})
+			return
+		}
+		dryRun = parsed
+	}
+
+	importer := &PatientImporter{PatientDB: db}
+	report, err := importer.Import(ctx, ctx.Request.Body, format, dryRun)
+
+	switch {
+	case err == nil:
+		ctx.JSON(
+			http.StatusOK,
+			report,
+		)
+	case errors.Is(err, errInvalidPatientImport):
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid import file",
+				"error":   err.Error(),
+			})
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to import patients to database",
+				"error":   err.Error(),
+			})
+	}
 }
 
-var examinationTimes = map[MedicalExaminations]int{
-	"x_ray": 4, // 60 minutes
-	"blood_test": 1, // 15 minutes
-	"ultrasound": 2, // 30 minutes
-	"mri": 6, // 90 minutes
-	"ct": 3, // 45 minutes
+var examinationTimes = map[MedicalExaminations]time.Duration{
+	"x_ray": 60 * time.Minute,
+	"blood_test": 15 * time.Minute,
+	"ultrasound": 30 * time.Minute,
+	"mri": 90 * time.Minute,
+	"ct": 45 * time.Minute,
 }
 
 // RequestExamination - Request an examination for a specific patient
@@ -640,6 +850,15 @@ func (this *implPatientAPI) RequestExamination(ctx *gin.Context) {
 		return
 	}
 
+	staffDB, ok := staffService(ctx)
+	if !ok {
+		return
+	}
+	waitlistDB, ok := waitlistService(ctx)
+	if !ok {
+		return
+	}
+
 	requestDate, err := time.Parse("2006-01-02", request.Date)
 	if err != nil {
 		ctx.JSON(
@@ -654,110 +873,210 @@ func (this *implPatientAPI) RequestExamination(ctx *gin.Context) {
 
 	examinations := make([]Examination, 0)
 
+	now := time.Now()
 	for _, ambulance := range ambulances {
-		reservationInputs, err := reservationDB.GetDocumentsByField(ctx, "ambulanceid", ambulance.Id)
-
+		available, err := availableExaminations(ctx, reservationDB, staffDB, waitlistDB, ambulance, requestDate, request.ExaminationType, now)
 		if err != nil {
 			ctx.JSON(
 				http.StatusInternalServerError,
 				gin.H{
 					"status":  "Internal Server Error",
-					"message": "Failed to retrieve reservations from database",
+					"message": "Failed to compute available examinations",
 					"error":   err.Error(),
 				})
 			return
 		}
 
-		closeTime, err := time.Parse("15:04", ambulance.OfficeHours.Close)
-		if err != nil {
-			ctx.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"status":  "Internal Server Error",
-					"message": "Failed to parse ambulance closing time",
-					"error":   err.Error(),
-				})
-			return
+		// offer the earliest slot of every ambulance
+		if len(available) > 0 {
+			examinations = append(examinations, available[0])
 		}
-		openTime, err := time.Parse("15:04", ambulance.OfficeHours.Open)
-		if err != nil {
+	}
+
+	ctx.JSON(http.StatusOK, examinations)
+}
+
+// SearchPatients - Search patients by name and birthday
+func (this *implPatientAPI) SearchPatients(ctx *gin.Context) {
+	value, exists := ctx.Get("db_service_patient")
+	if !exists {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service not found",
+				"error":   "db_service not found",
+			})
+		return
+	}
+
+	db, ok := value.(db_service.DbService[Patient])
+	if !ok {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service context is not of type db_service.DbService",
+				"error":   "cannot cast db_service context to db_service.DbService",
+			})
+		return
+	}
+
+	skip, limit, err := parsePagination(ctx)
+	if err != nil {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid pagination",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	term := strings.TrimSpace(ctx.Query("q"))
+	birthday := ctx.Query("birthday")
+	match := ctx.DefaultQuery("match", "exact")
+
+	if term == "" && birthday == "" {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid search parameters",
+				"error":   "q or birthday is required",
+			})
+		return
+	}
+
+	birthdayFilter := db_service.Filter{}
+	if birthday != "" {
+		if _, err := time.Parse("2006-01-02", birthday); err != nil {
 			ctx.JSON(
-				http.StatusInternalServerError,
+				http.StatusBadRequest,
 				gin.H{
-					"status":  "Internal Server Error",
-					"message": "Failed to parse ambulance opening time",
-					"error":   err.Error(),
+					"status":  "Bad Request",
+					"message": "Invalid search parameters",
+					"error":   fmt.Sprintf("Failed to parse birthday: %v", err),
 				})
 			return
 		}
+		birthdayFilter = db_service.Eq("birthday", birthday)
+	}
 
-		duration := closeTime.Sub(openTime)
-		interval := time.Minute * 15
-
-		numIntervals := int(duration.Minutes() / interval.Minutes())
-
-		intervals := make([]bool, numIntervals)
-		for _, reservationInput := range reservationInputs {
-			if !isDatetimeInsideDate(requestDate, reservationInput.Start) {
-				continue
-			}
+	var patients []Patient
+	var total int64
+
+	switch match {
+	case "exact":
+		// text index ranks the matches, ties are ordered by name
+		query := db_service.NewQuery(birthdayFilter)
+		if term != "" {
+			query = db_service.NewQuery(db_service.And(db_service.Text(term), birthdayFilter)).SortByRelevance()
+		} else {
+			query = query.WithCollation(patientNameCollationLocale, patientNameCollationStrength)
+		}
+		query = query.SortBy("lastname", false).SortBy("firstname", false).SortBy("id", false)
 
-			reservationDuration := reservationInput.End.Sub(reservationInput.Start)
-
-			reservationHours, err := time.Parse("15:04", reservationInput.Start.Format("15:04"))
-			if err != nil {
-				ctx.JSON(
-					http.StatusInternalServerError,
-					gin.H{
-						"status":  "Internal Server Error",
-						"message": "Failed to parse reservation start time",
-						"error":   err.Error(),
-					})
-				return
-			}
+		total, err = db.CountDocuments(ctx, query)
+		if err == nil {
+			patients, err = db.FindDocuments(ctx, query.Page(skip, limit))
+		}
+	case "prefix":
+		// every word of the term must prefix the first or last name
+		filters := []db_service.Filter{birthdayFilter}
+		for _, word := range strings.Fields(term) {
+			filters = append(filters, namePrefixFilter(word))
+		}
+		query := db_service.NewQuery(db_service.And(filters...)).
+			WithCollation(patientNameCollationLocale, patientNameCollationStrength).
+			SortBy("lastname", false).SortBy("firstname", false).SortBy("id", false)
 
-			reservationOffset := reservationHours.Sub(openTime)
+		total, err = db.CountDocuments(ctx, query)
+		if err == nil {
+			patients, err = db.FindDocuments(ctx, query.Page(skip, limit))
+		}
+	case "fuzzy":
+		patients, total, err = searchPatientsFuzzy(ctx, db, term, birthdayFilter, skip, limit)
+	default:
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid search parameters",
+				"error":   "match must be one of exact, prefix, fuzzy",
+			})
+		return
+	}
 
-			startIndex := int(reservationOffset.Minutes() / interval.Minutes())
-			numReservationIntervals := int(reservationDuration.Minutes() / interval.Minutes())
+	if err != nil {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "Failed to search patients in database",
+				"error":   err.Error(),
+			})
+		return
+	}
 
-			for i := startIndex; i < startIndex+numReservationIntervals; i++ {
-				intervals[i] = true
-			}
-		}
+	if len(patients) == 0 {
+		patients = []Patient{}
+	}
 
-		examinationTime := examinationTimes[request.ExaminationType]
+	setTotalCount(ctx, total)
+	ctx.JSON(
+		http.StatusOK,
+		patients,
+	)
+}
 
-		for i := 0; i < numIntervals - examinationTime - 1; i++ {
-			found := true
-			for j := 0; j <= examinationTime - 1; j++ {
-				if intervals[i + j] {
-					i += j
-					found = false
-					break
-				}
-			}
+// searchPatientsFuzzy ranks patients by edit distance of their names to the term.
+// Candidates are narrowed to names starting with the same letters as the term
+// words, as typos in the first letter are rare.
+func searchPatientsFuzzy(ctx *gin.Context, db db_service.DbService[Patient], term string, birthdayFilter db_service.Filter, skip int64, limit int64) ([]Patient, int64, error) {
+	tokens := nameTokens(term)
 
-			if found {
-				startIndex := i
-				endIndex := i + examinationTime
+	letterFilters := []db_service.Filter{}
+	for _, token := range tokens {
+		letterFilters = append(letterFilters, namePrefixFilter(firstLetter(token)))
+	}
 
-				startTime := requestDate.Add(time.Duration(openTime.Hour()) * time.Hour).Add(time.Duration(openTime.Minute()) * time.Minute).Add(interval * time.Duration(startIndex))
-				endTime := requestDate.Add(time.Duration(openTime.Hour()) * time.Hour).Add(time.Duration(openTime.Minute()) * time.Minute).Add(interval * time.Duration(endIndex))
+	candidates, err := db.FindDocuments(ctx, db_service.NewQuery(db_service.And(birthdayFilter, db_service.Or(letterFilters...))).
+		WithCollation(patientNameCollationLocale, patientNameCollationStrength))
+	if err != nil {
+		return nil, 0, err
+	}
 
-				examinations = append(examinations, Examination{
-					Ambulance: ambulance,
-					Start: startTime,
-					End: endTime,
-					ExaminationType: request.ExaminationType,
-				})
-				
-				break
-			}
+	type scoredPatient struct {
+		patient Patient
+		score   int
+	}
+	matches := make([]scoredPatient, 0, len(candidates))
+	for _, candidate := range candidates {
+		if len(tokens) == 0 {
+			matches = append(matches, scoredPatient{candidate, 0})
+		} else if score, ok := fuzzyNameScore(&candidate, tokens); ok {
+			matches = append(matches, scoredPatient{candidate, score})
 		}
 	}
 
-	ctx.JSON(http.StatusOK, examinations)
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score < matches[j].score
+		}
+		left, right := matches[i].patient, matches[j].patient
+		if normalizeName(left.LastName) != normalizeName(right.LastName) {
+			return normalizeName(left.LastName) < normalizeName(right.LastName)
+		}
+		return normalizeName(left.FirstName) < normalizeName(right.FirstName)
+	})
+
+	patients := make([]Patient, 0, limit)
+	for _, match := range pageOf(matches, skip, limit) {
+		patients = append(patients, match.patient)
+	}
+	return patients, int64(len(matches)), nil
 }
 
 // UpdatePatient - Update an existing patient
@@ -803,6 +1122,26 @@ func (this *implPatientAPI) UpdatePatient(ctx *gin.Context) {
 			patient.Bio = entry.Bio
 		}
 
+		if entry.Email != "" {
+			patient.Email = entry.Email
+		}
+
+		if entry.Phone != "" {
+			patient.Phone = entry.Phone
+		}
+
+		if entry.Address != (PostalAddress{}) {
+			patient.Address = entry.Address
+		}
+
+		if entry.PreferredLanguage != "" {
+			patient.PreferredLanguage = entry.PreferredLanguage
+		}
+
+		if entry.EmergencyContact != (EmergencyContact{}) {
+			patient.EmergencyContact = entry.EmergencyContact
+		}
+
 		return patient, patient, http.StatusOK
 	})
 }
@@ -1,16 +1,63 @@
 package reservation
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/ical"
 )
 
+// CancelReservation - Cancels a reservation
+func (this *implReservationAPI) CancelReservation(ctx *gin.Context) {
+	updateReservationFunc(ctx, func(c *gin.Context, reservationInput *ReservationInput) (updatedReservation *ReservationInput, responseContent interface{}, status int) {
+		if reservationInput.Status == CANCELLED {
+			return nil, gin.H{
+				"status":  "Conflict",
+				"message": "Reservation is already cancelled",
+				"error":   "reservation is cancelled",
+			}, http.StatusConflict
+		}
+
+		patientValue, patientExists := ctx.Get("db_service_patient")
+		ambulanceValue, ambulanceExists := ctx.Get("db_service_ambulance")
+		patientDB, patientOK := patientValue.(db_service.DbService[Patient])
+		ambulanceDB, ambulanceOK := ambulanceValue.(db_service.DbService[Ambulance])
+		if !patientExists || !ambulanceExists || !patientOK || !ambulanceOK {
+			return nil, gin.H{
+				"status":  "Internal Server Error",
+				"message": "db not found",
+				"error":   "db not found",
+			}, http.StatusInternalServerError
+		}
+
+		reservationInput.Status = CANCELLED
+
+		reservations, err := expandReservations(ctx, patientDB, ambulanceDB, []ReservationInput{*reservationInput})
+		if err != nil {
+			return nil, gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to load patient and ambulance of the reservation",
+				"error":   err.Error(),
+			}, http.StatusBadGateway
+		}
+
+		return reservationInput, reservations[0], http.StatusOK
+	})
+}
+
 // DeleteReservation - Deletes a reservation
 func (this *implReservationAPI) DeleteReservation(ctx *gin.Context) {
-	value, exists := ctx.Get("db_service_reservation")
-	if !exists {
+	db, patientDB, ambulanceDB, ok := reservationServices(ctx)
+	if !ok {
+		return
+	}
+	transactorValue, transactorExists := ctx.Get("db_transactor")
+	if !transactorExists {
 		ctx.JSON(
 			http.StatusInternalServerError,
 			gin.H{
@@ -20,9 +67,8 @@ func (this *implReservationAPI) DeleteReservation(ctx *gin.Context) {
 			})
 		return
 	}
-  
-	db, ok := value.(db_service.DbService[ReservationInput])
-	if !ok {
+	transactor, transactorOK := transactorValue.(db_service.Transactor)
+	if !transactorOK {
 		ctx.JSON(
 			http.StatusInternalServerError,
 			gin.H{
@@ -32,12 +78,39 @@ func (this *implReservationAPI) DeleteReservation(ctx *gin.Context) {
 			})
 		return
 	}
-  
+
 	reservationId := ctx.Param("reservationId")
-	err := db.DeleteDocument(ctx, reservationId)
-  
+	outbox := hl7Outbox(ctx)
+	var reservationInput *ReservationInput
+	var reservations []Reservation
+	err := transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		// the reservation is loaded first so the patient can be notified about it
+		var err error
+		reservationInput, err = db.FindDocument(txCtx, reservationId)
+		if err != nil {
+			return err
+		}
+		reservations, err = deletedReservations(txCtx, patientDB, ambulanceDB, []ReservationInput{*reservationInput}, nil, nil)
+		if err != nil {
+			return err
+		}
+		if err := db.DeleteDocument(txCtx, reservationId); err != nil {
+			return err
+		}
+		return outbox.ExportDeleted(txCtx, reservations)
+	})
+
 	switch err {
 	case nil:
+		for _, reservation := range reservations {
+			// cancelled reservations were already announced to the patient
+			if reservation.Status != CANCELLED {
+				notifyReservation(ctx, EventReservationDeleted, reservation)
+			}
+			publishWebhook(ctx, RESERVATION_DELETED, reservation)
+		}
+		offerFreedSlot(ctx, *reservationInput)
+		touchCalendarFeeds(ctx, reservationInput.PatientId, reservationInput.AmbulanceId)
 		ctx.AbortWithStatus(http.StatusNoContent)
 	case db_service.ErrNotFound:
 		ctx.JSON(
@@ -61,42 +134,73 @@ func (this *implReservationAPI) DeleteReservation(ctx *gin.Context) {
 
 // GetReservationById - Get a reservation by ID
 func (this *implReservationAPI) GetReservationById(ctx *gin.Context) {
-	value, exists := ctx.Get("db_service_reservation")
-	if !exists {
-		ctx.JSON(
-			http.StatusInternalServerError,
-			gin.H{
-				"status":  "Internal Server Error",
-				"message": "db_service not found",
-				"error":   "db_service not found",
-			})
+	reservationDB, patientDB, ambulanceDB, ok := reservationServices(ctx)
+	if !ok {
 		return
 	}
-  
-	db, ok := value.(db_service.DbService[ReservationInput])
-	if !ok {
+
+	reservationId := ctx.Param("reservationId")
+	reservationInput, err := reservationDB.FindDocument(ctx, reservationId)
+	var reservations []Reservation
+	if err == nil {
+		reservations, err = expandReservations(ctx, patientDB, ambulanceDB, []ReservationInput{*reservationInput})
+	}
+
+	switch err {
+	case nil:
 		ctx.JSON(
-			http.StatusInternalServerError,
+			http.StatusOK,
+			reservations[0],
+		)
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
 			gin.H{
-				"status":  "Internal Server Error",
-				"message": "db_service context is not of type db_service.DbService",
-				"error":   "cannot cast db_service context to db_service.DbService",
+				"status":  "Not Found",
+				"message": "Reservation not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to load reservation from database",
+				"error":   err.Error(),
 			})
+	}
+}
+
+// GetReservationCalendar - Export the reservation as iCalendar
+func (this *implReservationAPI) GetReservationCalendar(ctx *gin.Context) {
+	reservationDB, patientDB, ambulanceDB, ok := reservationServices(ctx)
+	if !ok {
 		return
 	}
-  
+
 	reservationId := ctx.Param("reservationId")
-	reservationInput, err := db.FindDocument(ctx, reservationId)
+	reservationInput, err := reservationDB.FindDocument(ctx, reservationId)
+	var reservations []Reservation
+	if err == nil {
+		reservations, err = expandReservations(ctx, patientDB, ambulanceDB, []ReservationInput{*reservationInput})
+	}
 
 	switch err {
 	case nil:
-		
+		reservation := reservations[0]
+		calendar := reservationsCalendar(reservation.Ambulance.Name, reservations, patientCounterpart)
+		if reservation.Status == CANCELLED {
+			// imported events are removed by the cancel request
+			calendar.Method = ical.MethodCancel
+		}
+		writeCalendar(ctx, "reservation-"+reservation.Id+".ics", calendar)
 	case db_service.ErrNotFound:
 		ctx.JSON(
 			http.StatusNotFound,
 			gin.H{
 				"status":  "Not Found",
-				"message": "Ambulance not found",
+				"message": "Reservation not found",
 				"error":   err.Error(),
 			},
 		)
@@ -105,84 +209,173 @@ func (this *implReservationAPI) GetReservationById(ctx *gin.Context) {
 			http.StatusBadGateway,
 			gin.H{
 				"status":  "Bad Gateway",
-				"message": "Failed to create ambulance in database",
+				"message": "Failed to load reservation from database",
 				"error":   err.Error(),
-			},
-		)
+			})
 	}
+}
 
+// reservationSortFields maps the sort parameter to the document fields
+var reservationSortFields = map[string]string{
+	"start":           "start",
+	"end":             "end",
+	"examinationType": "examinationtype",
+}
+
+// GetReservations - Get a list of reservations
+func (this *implReservationAPI) GetReservations(ctx *gin.Context) {
+	value, exists := ctx.Get("db_service_reservation")
 	patientValue, patientExists := ctx.Get("db_service_patient")
 	ambulanceValue, ambulanceExists := ctx.Get("db_service_ambulance")
-
-	if !patientExists || !ambulanceExists {
+	if !exists || !patientExists || !ambulanceExists {
 		ctx.JSON(
 			http.StatusInternalServerError,
 			gin.H{
 				"status":  "Internal Server Error",
-				"message": "db not found",
-				"error":   "db not found",
+				"message": "db_service not found",
+				"error":   "db_service not found",
 			})
 		return
 	}
 
+	db, ok := value.(db_service.DbService[ReservationInput])
 	patientDB, patientOK := patientValue.(db_service.DbService[Patient])
 	ambulanceDB, ambulanceOK := ambulanceValue.(db_service.DbService[Ambulance])
-
-	if !patientOK || !ambulanceOK {
+	if !ok || !patientOK || !ambulanceOK {
 		ctx.JSON(
 			http.StatusInternalServerError,
 			gin.H{
 				"status":  "Internal Server Error",
-				"message": "db context is not of required type",
-				"error":   "cannot cast db context to db_service.DbService",
+				"message": "db_service context is not of type db_service.DbService",
+				"error":   "cannot cast db_service context to db_service.DbService",
 			})
 		return
 	}
 
-	patient, err := patientDB.FindDocument(ctx, reservationInput.PatientId)
+	badRequest := func(err error) {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid filter parameters",
+				"error":   err.Error(),
+			})
+	}
+
+	skip, limit, err := parsePagination(ctx)
+	if err != nil {
+		badRequest(err)
+		return
+	}
+
+	filters := []db_service.Filter{}
+
+	if from := ctx.Query("from"); from != "" {
+		fromTime, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			badRequest(fmt.Errorf("Failed to parse from: %v", err))
+			return
+		}
+		filters = append(filters, db_service.Gt("end", fromTime))
+	}
+
+	if to := ctx.Query("to"); to != "" {
+		toTime, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			badRequest(fmt.Errorf("Failed to parse to: %v", err))
+			return
+		}
+		filters = append(filters, db_service.Lt("start", toTime))
+	}
+
+	if ambulanceId := ctx.Query("ambulanceId"); ambulanceId != "" {
+		filters = append(filters, db_service.Eq("ambulanceid", ambulanceId))
+	}
+
+	if patientId := ctx.Query("patientId"); patientId != "" {
+		filters = append(filters, db_service.Eq("patientid", patientId))
+	}
+
+	if examinationTypes := ctx.QueryArray("examinationType"); len(examinationTypes) > 0 {
+		for _, examinationType := range examinationTypes {
+			if !MedicalExaminations(examinationType).IsValid() {
+				badRequest(fmt.Errorf("Invalid examination type: %v", examinationType))
+				return
+			}
+		}
+		filters = append(filters, db_service.In("examinationtype", examinationTypes))
+	}
+
+	if status := ctx.Query("status"); status != "" {
+		switch ReservationStatus(status) {
+		case SCHEDULED:
+			filters = append(filters, activeReservationFilter())
+		case CANCELLED:
+			filters = append(filters, db_service.Eq("status", CANCELLED))
+		default:
+			badRequest(fmt.Errorf("Invalid status: %v", status))
+			return
+		}
+	}
+
+	sortParam := ctx.DefaultQuery("sort", "start")
+	sortField, ok := reservationSortFields[strings.TrimPrefix(sortParam, "-")]
+	if !ok {
+		badRequest(fmt.Errorf("Invalid sort field: %v", sortParam))
+		return
+	}
+
+	query := db_service.NewQuery(db_service.And(filters...)).
+		SortBy(sortField, strings.HasPrefix(sortParam, "-")).
+		SortBy("id", false)
+
+	total, err := db.CountDocuments(ctx, query)
 	if err != nil {
 		ctx.JSON(
 			http.StatusInternalServerError,
 			gin.H{
 				"status":  "Internal Server Error",
-				"message": "Failed to retrieve patient from database",
+				"message": "Failed to count reservations in database",
 				"error":   err.Error(),
 			})
 		return
 	}
 
-	ambulance, err := ambulanceDB.FindDocument(ctx, reservationInput.AmbulanceId)
+	reservationInputs, err := db.FindDocuments(ctx, query.Page(skip, limit))
 	if err != nil {
 		ctx.JSON(
 			http.StatusInternalServerError,
 			gin.H{
 				"status":  "Internal Server Error",
-				"message": "Failed to retrieve ambulance from database",
+				"message": "Failed to retrieve reservations from database",
 				"error":   err.Error(),
 			})
 		return
 	}
 
-	reservation := Reservation{
-		Id: reservationInput.Id,
-		Patient: *patient,
-		Ambulance: *ambulance,
-		Start: reservationInput.Start,
-		End: reservationInput.End,
-		ExaminationType: reservationInput.ExaminationType,
-		Message: reservationInput.Message,
+	reservations, err := expandReservations(ctx, patientDB, ambulanceDB, reservationInputs)
+	if err != nil {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "Failed to retrieve reservation details from database",
+				"error":   err.Error(),
+			})
+		return
 	}
 
+	setTotalCount(ctx, total)
 	ctx.JSON(
 		http.StatusOK,
-		reservation,
+		reservations,
 	)
 }
 
 // UpdateReservation - Update an existing reservation
 func (this *implReservationAPI) UpdateReservation(ctx *gin.Context) {
 	updateReservationFunc(ctx, func(c *gin.Context, reservationInput *ReservationInput) (updatedReservation *ReservationInput, responseContent interface{}, status int) {
-		var entry ReservationInput
+		var entry UpdateReservationRequest
 
 		if err := c.ShouldBindJSON(&entry); err != nil {
 			return nil, gin.H{
@@ -192,58 +385,94 @@ func (this *implReservationAPI) UpdateReservation(ctx *gin.Context) {
 			}, http.StatusBadRequest
 		}
 
+		if len(entry.Message) > 200 {
+			return nil, gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid reservation data",
+				"error":   "Message exceeds maximum length of 200 characters",
+			}, http.StatusBadRequest
+		}
+
 		reservationInput.Message = entry.Message
 
+		// reschedule the reservation
+		if !entry.Start.IsZero() || !entry.End.IsZero() {
+			if reservationInput.Status == CANCELLED {
+				return nil, gin.H{
+					"status":  "Conflict",
+					"message": "Cancelled reservation cannot be rescheduled",
+					"error":   "reservation is cancelled",
+				}, http.StatusConflict
+			}
+
+			if entry.Start.IsZero() || entry.End.IsZero() {
+				return nil, gin.H{
+					"status":  "Bad Request",
+					"message": "Invalid reservation data",
+					"error":   "start and end must be provided together",
+				}, http.StatusBadRequest
+			}
+
+			if entry.Start.Before(time.Now()) || !entry.Start.Before(entry.End) {
+				return nil, gin.H{
+					"status":  "Bad Request",
+					"message": "Invalid reservation data",
+					"error":   "start must be in the future and before end",
+				}, http.StatusBadRequest
+			}
+
+			reservationInput.Start = entry.Start
+			reservationInput.End = entry.End
+		}
+
 		patientValue, patientExists := ctx.Get("db_service_patient")
 		ambulanceValue, ambulanceExists := ctx.Get("db_service_ambulance")
 
 		if !patientExists || !ambulanceExists {
-			ctx.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"status":  "Internal Server Error",
-					"message": "db not found",
-					"error":   "db not found",
-				})
-			return
+			return nil, gin.H{
+				"status":  "Internal Server Error",
+				"message": "db not found",
+				"error":   "db not found",
+			}, http.StatusInternalServerError
 		}
 
 		patientDB, patientOK := patientValue.(db_service.DbService[Patient])
 		ambulanceDB, ambulanceOK := ambulanceValue.(db_service.DbService[Ambulance])
 
 		if !patientOK || !ambulanceOK {
-			ctx.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"status":  "Internal Server Error",
-					"message": "db context is not of required type",
-					"error":   "cannot cast db context to db_service.DbService",
-				})
-			return
+			return nil, gin.H{
+				"status":  "Internal Server Error",
+				"message": "db context is not of required type",
+				"error":   "cannot cast db context to db_service.DbService",
+			}, http.StatusInternalServerError
 		}
 
 		patient, err := patientDB.FindDocument(ctx, reservationInput.PatientId)
 		if err != nil {
-			ctx.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"status":  "Internal Server Error",
-					"message": "Failed to retrieve patient from database",
-					"error":   err.Error(),
-				})
-			return
+			return nil, gin.H{
+				"status":  "Internal Server Error",
+				"message": "Failed to retrieve patient from database",
+				"error":   err.Error(),
+			}, http.StatusInternalServerError
 		}
 
 		ambulance, err := ambulanceDB.FindDocument(ctx, reservationInput.AmbulanceId)
 		if err != nil {
-			ctx.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"status":  "Internal Server Error",
-					"message": "Failed to retrieve ambulance from database",
+			return nil, gin.H{
+				"status":  "Internal Server Error",
+				"message": "Failed to retrieve ambulance from database",
+				"error":   err.Error(),
+			}, http.StatusInternalServerError
+		}
+
+		if !entry.Start.IsZero() {
+			if err := ambulance.validateSlot(reservationInput.ExaminationType, reservationInput.Start, reservationInput.End); err != nil {
+				return nil, gin.H{
+					"status":  "Bad Request",
+					"message": "Invalid reservation data",
 					"error":   err.Error(),
-				})
-			return
+				}, http.StatusBadRequest
+			}
 		}
 
 		reservation := Reservation{
@@ -254,6 +483,7 @@ func (this *implReservationAPI) UpdateReservation(ctx *gin.Context) {
 			End: reservationInput.End,
 			ExaminationType: reservationInput.ExaminationType,
 			Message: reservationInput.Message,
+			Status: reservationInput.Status,
 		}
 
 		return reservationInput, reservation, http.StatusOK
@@ -0,0 +1,474 @@
+package reservation
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+)
+
+// CancelReservationSeries - Cancel the reservation series as a whole
+func (this *implReservationSeriesAPI) CancelReservationSeries(ctx *gin.Context) {
+	services, ok := reservationSeriesServices(ctx)
+	if !ok {
+		return
+	}
+
+	series, ok := loadReservationSeries(ctx, services)
+	if !ok {
+		return
+	}
+	if series.Status == CANCELLED {
+		ctx.JSON(
+			http.StatusConflict,
+			gin.H{
+				"status":  "Conflict",
+				"message": "Reservation series is already cancelled",
+				"error":   "reservation series is cancelled",
+			})
+		return
+	}
+
+	now := time.Now().UTC()
+	occurrences, err := futureSeriesOccurrences(ctx, services.reservationDB, series.Id, now)
+	for i := 0; err == nil && i < len(occurrences); i++ {
+		if occurrences[i].Status != CANCELLED && occurrences[i].Start.After(now) {
+			err = cancelSeriesOccurrence(ctx, services, occurrences[i])
+		}
+	}
+	if err == nil {
+		series.Status = CANCELLED
+		series.UpdatedAt = now
+		err = services.seriesDB.UpdateDocument(ctx, series.Id, series)
+	}
+
+	switch err {
+	case nil:
+		ctx.JSON(
+			http.StatusOK,
+			series,
+		)
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Reservation series was deleted while processing the request",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to cancel reservation series in database",
+				"error":   err.Error(),
+			})
+	}
+}
+
+// CreateReservationSeries - Book recurring reservations for the patient
+func (this *implReservationSeriesAPI) CreateReservationSeries(ctx *gin.Context) {
+	services, ok := reservationSeriesServices(ctx)
+	if !ok {
+		return
+	}
+
+	input := ReservationSeriesInput{}
+	if err := ctx.BindJSON(&input); err != nil {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid request body",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid reservation series data",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	patient, ok := loadSeriesPatient(ctx, services, ctx.Param("patientId"))
+	if !ok {
+		return
+	}
+	ambulance, ok := loadSeriesAmbulance(ctx, services, input.AmbulanceId)
+	if !ok {
+		return
+	}
+
+	// occurrences keep the wall-clock time of the start in the time zone of
+	// the ambulance across daylight saving time changes
+	start := input.Start.In(ambulance.location())
+	now := time.Now().UTC()
+	series := ReservationSeries{
+		Id:              uuid.New().String(),
+		PatientId:       patient.Id,
+		AmbulanceId:     ambulance.Id,
+		Start:           start,
+		End:             input.End,
+		ExaminationType: input.ExaminationType,
+		Message:         input.Message,
+		Recurrence:      input.Recurrence,
+		Status:          SCHEDULED,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := services.seriesDB.CreateDocument(ctx, series.Id, &series); err != nil {
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to create reservation series in database",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	booked, unplaced := bookSeriesOccurrences(ctx, services, &series, *patient, *ambulance, input.Recurrence.occurrences(start))
+
+	ctx.JSON(
+		http.StatusCreated,
+		ReservationSeriesResult{Series: series, Reservations: booked, Unplaced: unplaced},
+	)
+}
+
+// GetPatientReservationSeries - Get reservation series of the patient
+func (this *implReservationSeriesAPI) GetPatientReservationSeries(ctx *gin.Context) {
+	services, ok := reservationSeriesServices(ctx)
+	if !ok {
+		return
+	}
+
+	patient, ok := loadSeriesPatient(ctx, services, ctx.Param("patientId"))
+	if !ok {
+		return
+	}
+
+	series, err := services.seriesDB.FindDocuments(ctx, db_service.NewQuery(db_service.Eq("patientid", patient.Id)).SortBy("start", false))
+	if err != nil {
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to retrieve reservation series from database",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	if len(series) == 0 {
+		series = []ReservationSeries{}
+	}
+
+	ctx.JSON(
+		http.StatusOK,
+		series,
+	)
+}
+
+// GetReservationSeries - Get a reservation series by ID
+func (this *implReservationSeriesAPI) GetReservationSeries(ctx *gin.Context) {
+	services, ok := reservationSeriesServices(ctx)
+	if !ok {
+		return
+	}
+
+	if series, ok := loadReservationSeries(ctx, services); ok {
+		ctx.JSON(
+			http.StatusOK,
+			series,
+		)
+	}
+}
+
+// GetReservationSeriesReservations - Get occurrences of the reservation series
+func (this *implReservationSeriesAPI) GetReservationSeriesReservations(ctx *gin.Context) {
+	services, ok := reservationSeriesServices(ctx)
+	if !ok {
+		return
+	}
+
+	series, ok := loadReservationSeries(ctx, services)
+	if !ok {
+		return
+	}
+
+	reservationInputs, err := services.reservationDB.FindDocuments(ctx, db_service.NewQuery(db_service.Eq("seriesid", series.Id)).SortBy("start", false))
+	var reservations []Reservation
+	if err == nil {
+		reservations, err = expandReservations(ctx, services.patientDB, services.ambulanceDB, reservationInputs)
+	}
+	if err != nil {
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to retrieve reservations of the series from database",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	ctx.JSON(
+		http.StatusOK,
+		reservations,
+	)
+}
+
+// UpdateReservationSeries - Update the reservation series as a whole
+func (this *implReservationSeriesAPI) UpdateReservationSeries(ctx *gin.Context) {
+	services, ok := reservationSeriesServices(ctx)
+	if !ok {
+		return
+	}
+
+	series, ok := loadReservationSeries(ctx, services)
+	if !ok {
+		return
+	}
+	if series.Status == CANCELLED {
+		ctx.JSON(
+			http.StatusConflict,
+			gin.H{
+				"status":  "Conflict",
+				"message": "Reservation series is cancelled",
+				"error":   "reservation series is cancelled",
+			})
+		return
+	}
+
+	input := ReservationSeriesInput{}
+	if err := ctx.BindJSON(&input); err != nil {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid request body",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid reservation series data",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	patient, ok := loadSeriesPatient(ctx, services, series.PatientId)
+	if !ok {
+		return
+	}
+	ambulance, ok := loadSeriesAmbulance(ctx, services, input.AmbulanceId)
+	if !ok {
+		return
+	}
+
+	series.AmbulanceId = ambulance.Id
+	series.Start = input.Start.In(ambulance.location())
+	series.End = input.End
+	series.ExaminationType = input.ExaminationType
+	series.Message = input.Message
+	series.Recurrence = input.Recurrence
+	series.UpdatedAt = time.Now().UTC()
+
+	kept, starts, err := rescheduleSeriesOccurrences(ctx, services, series, series.UpdatedAt)
+	if err == nil {
+		err = services.seriesDB.UpdateDocument(ctx, series.Id, series)
+	}
+	var reservations []Reservation
+	if err == nil {
+		reservations, err = expandReservations(ctx, services.patientDB, services.ambulanceDB, kept)
+	}
+	if err != nil {
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to update reservation series in database",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	booked, unplaced := bookSeriesOccurrences(ctx, services, series, *patient, *ambulance, starts)
+
+	ctx.JSON(
+		http.StatusOK,
+		ReservationSeriesResult{Series: *series, Reservations: append(reservations, booked...), Unplaced: unplaced},
+	)
+}
+
+// rescheduleSeriesOccurrences matches the future occurrences to the updated
+// series. Occurrences of the series rule that are still scheduled at their
+// original time keep their reservation, the others are cancelled. It returns
+// the kept reservations and starts of the occurrences to book.
+func rescheduleSeriesOccurrences(
+	ctx *gin.Context,
+	services *seriesServices,
+	series *ReservationSeries,
+	now time.Time,
+) ([]ReservationInput, []time.Time, error) {
+	occurrences, err := futureSeriesOccurrences(ctx, services.reservationDB, series.Id, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the recurrence may have been cancelled and booked again, the active
+	// occurrence takes precedence
+	byRecurrenceId := map[int64]ReservationInput{}
+	for _, occurrence := range occurrences {
+		key := occurrence.RecurrenceId.UnixMilli()
+		if existing, exists := byRecurrenceId[key]; !exists || existing.Status == CANCELLED {
+			byRecurrenceId[key] = occurrence
+		}
+	}
+
+	duration := series.End.Sub(series.Start)
+	kept := []ReservationInput{}
+	starts := []time.Time{}
+	for _, start := range series.Recurrence.occurrences(series.Start) {
+		if !start.After(now) {
+			continue
+		}
+		occurrence, exists := byRecurrenceId[start.UnixMilli()]
+		delete(byRecurrenceId, start.UnixMilli())
+		switch {
+		case !exists:
+			starts = append(starts, start)
+		case occurrence.Status == CANCELLED:
+			// cancelled individually
+		case !occurrence.Start.Equal(occurrence.RecurrenceId):
+			// rescheduled individually
+			kept = append(kept, occurrence)
+		case occurrence.AmbulanceId == series.AmbulanceId &&
+			occurrence.End.Sub(occurrence.Start) == duration &&
+			occurrence.ExaminationType == series.ExaminationType:
+			if occurrence.Message != series.Message {
+				occurrence.Message = series.Message
+				occurrence.Sequence++
+				occurrence.UpdatedAt = now
+				if err := services.reservationDB.UpdateDocument(ctx, occurrence.Id, &occurrence); err != nil {
+					return nil, nil, err
+				}
+				publishReservationInput(ctx, RESERVATION_UPDATED, occurrence)
+			}
+			kept = append(kept, occurrence)
+		default:
+			if err := cancelSeriesOccurrence(ctx, services, occurrence); err != nil {
+				return nil, nil, err
+			}
+			starts = append(starts, start)
+		}
+	}
+
+	// occurrences no longer produced by the rule
+	for _, occurrence := range byRecurrenceId {
+		if occurrence.Status != CANCELLED && occurrence.Start.Equal(occurrence.RecurrenceId) && occurrence.Start.After(now) {
+			if err := cancelSeriesOccurrence(ctx, services, occurrence); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return kept, starts, nil
+}
+
+// loadReservationSeries loads the series of the request, it responds with
+// error on failure
+func loadReservationSeries(ctx *gin.Context, services *seriesServices) (*ReservationSeries, bool) {
+	series, err := services.seriesDB.FindDocument(ctx, ctx.Param("seriesId"))
+
+	switch err {
+	case nil:
+		return series, true
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Reservation series not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to load reservation series from database",
+				"error":   err.Error(),
+			})
+	}
+	return nil, false
+}
+
+func loadSeriesPatient(ctx *gin.Context, services *seriesServices, patientId string) (*Patient, bool) {
+	patient, err := services.patientDB.FindDocument(ctx, patientId)
+
+	switch err {
+	case nil:
+		return patient, true
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Patient not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to fetch patient from database",
+				"error":   err.Error(),
+			})
+	}
+	return nil, false
+}
+
+func loadSeriesAmbulance(ctx *gin.Context, services *seriesServices, ambulanceId string) (*Ambulance, bool) {
+	ambulance, err := services.ambulanceDB.FindDocument(ctx, ambulanceId)
+
+	switch err {
+	case nil:
+		return ambulance, true
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Ambulance not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to fetch ambulance from database",
+				"error":   err.Error(),
+			})
+	}
+	return nil, false
+}
@@ -0,0 +1,319 @@
+package reservation
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+)
+
+// CreateStaffMember - Create a new staff member
+func (this *implStaffAPI) CreateStaffMember(ctx *gin.Context) {
+	db, ok := staffService(ctx)
+	if !ok {
+		return
+	}
+	_, _, ambulanceDB, ok := reservationServices(ctx)
+	if !ok {
+		return
+	}
+
+	staff := Staff{}
+	if err := ctx.BindJSON(&staff); err != nil {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid request body",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	if !validateStaffMember(ctx, ambulanceDB, &staff) {
+		return
+	}
+
+	staff.Id = uuid.New().String()
+	err := db.CreateDocument(ctx, staff.Id, &staff)
+
+	switch err {
+	case nil:
+		ctx.JSON(
+			http.StatusCreated,
+			staff,
+		)
+	case db_service.ErrConflict:
+		ctx.JSON(
+			http.StatusConflict,
+			gin.H{
+				"status":  "Conflict",
+				"message": "Staff member already exists",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to create staff member in database",
+				"error":   err.Error(),
+			},
+		)
+	}
+}
+
+// DeleteStaffMember - Deletes a staff member
+func (this *implStaffAPI) DeleteStaffMember(ctx *gin.Context) {
+	db, ok := staffService(ctx)
+	if !ok {
+		return
+	}
+	reservationDB, _, _, ok := reservationServices(ctx)
+	if !ok {
+		return
+	}
+
+	staffId := ctx.Param("staffId")
+
+	// upcoming reservations would lose the staff member performing them
+	upcoming, err := reservationDB.CountDocuments(ctx, db_service.NewQuery(db_service.And(
+		db_service.Eq("staffid", staffId),
+		db_service.Gt("end", time.Now()),
+		activeReservationFilter(),
+	)))
+	if err == nil && upcoming > 0 {
+		ctx.JSON(
+			http.StatusConflict,
+			gin.H{
+				"status":  "Conflict",
+				"message": "The staff member has upcoming reservations",
+				"error":   fmt.Sprintf("staff member %v has %v upcoming reservation(s)", staffId, upcoming),
+			})
+		return
+	}
+	if err == nil {
+		err = db.DeleteDocument(ctx, staffId)
+	}
+
+	switch err {
+	case nil:
+		ctx.AbortWithStatus(http.StatusNoContent)
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Staff member not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to delete staff member from database",
+				"error":   err.Error(),
+			})
+	}
+}
+
+// GetStaff - Get all staff members
+func (this *implStaffAPI) GetStaff(ctx *gin.Context) {
+	db, ok := staffService(ctx)
+	if !ok {
+		return
+	}
+
+	filters := []db_service.Filter{}
+	if ambulanceId := ctx.Query("ambulanceId"); ambulanceId != "" {
+		filters = append(filters, db_service.Eq("ambulanceids", ambulanceId))
+	}
+	if examinationType := ctx.Query("examinationType"); examinationType != "" {
+		if !MedicalExaminations(examinationType).IsValid() {
+			ctx.JSON(
+				http.StatusBadRequest,
+				gin.H{
+					"status":  "Bad Request",
+					"message": "Invalid filter parameters",
+					"error":   fmt.Sprintf("Invalid medical examination %q", examinationType),
+				})
+			return
+		}
+		filters = append(filters, db_service.Eq("medicalexaminations", examinationType))
+	}
+
+	staff, err := db.FindDocuments(ctx, db_service.NewQuery(db_service.And(filters...)).SortBy("name", false))
+	if err != nil {
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to retrieve staff from database",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	if len(staff) == 0 {
+		staff = []Staff{}
+	}
+
+	ctx.JSON(
+		http.StatusOK,
+		staff,
+	)
+}
+
+// GetStaffMember - Get a staff member by ID
+func (this *implStaffAPI) GetStaffMember(ctx *gin.Context) {
+	db, ok := staffService(ctx)
+	if !ok {
+		return
+	}
+
+	staff, err := db.FindDocument(ctx, ctx.Param("staffId"))
+
+	switch err {
+	case nil:
+		ctx.JSON(
+			http.StatusOK,
+			staff,
+		)
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Staff member not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to load staff member from database",
+				"error":   err.Error(),
+			},
+		)
+	}
+}
+
+// UpdateStaffMember - Update an existing staff member
+func (this *implStaffAPI) UpdateStaffMember(ctx *gin.Context) {
+	db, ok := staffService(ctx)
+	if !ok {
+		return
+	}
+	_, _, ambulanceDB, ok := reservationServices(ctx)
+	if !ok {
+		return
+	}
+
+	staffId := ctx.Param("staffId")
+	if _, err := db.FindDocument(ctx, staffId); err != nil {
+		status, message := http.StatusBadGateway, "Failed to load staff member from database"
+		if err == db_service.ErrNotFound {
+			status, message = http.StatusNotFound, "Staff member not found"
+		}
+		ctx.JSON(
+			status,
+			gin.H{
+				"status":  http.StatusText(status),
+				"message": message,
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	staff := Staff{}
+	if err := ctx.BindJSON(&staff); err != nil {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid request body",
+				"error":   err.Error(),
+			})
+		return
+	}
+	staff.Id = staffId
+
+	if !validateStaffMember(ctx, ambulanceDB, &staff) {
+		return
+	}
+
+	// reservations keep their staff member, the new shifts apply to
+	// new bookings and rescheduling
+	err := db.UpdateDocument(ctx, staffId, &staff)
+
+	switch err {
+	case nil:
+		ctx.JSON(
+			http.StatusOK,
+			staff,
+		)
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Staff member was deleted while processing the request",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to update staff member in database",
+				"error":   err.Error(),
+			})
+	}
+}
+
+// validateStaffMember validates the staff member and checks that its
+// ambulances exist, it responds with error on failure
+func validateStaffMember(ctx *gin.Context, ambulanceDB db_service.DbService[Ambulance], staff *Staff) bool {
+	if err := staff.Validate(); err != nil {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid staff member data",
+				"error":   err.Error(),
+			})
+		return false
+	}
+
+	ambulances, err := ambulanceDB.FindDocuments(ctx, db_service.NewQuery(db_service.In("id", staff.AmbulanceIds)).Project("id"))
+	if err != nil {
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to fetch ambulances from database",
+				"error":   err.Error(),
+			})
+		return false
+	}
+	if len(ambulances) != len(staff.AmbulanceIds) {
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Ambulance not found",
+				"error":   fmt.Sprintf("%v of %v ambulances of the staff member exist", len(ambulances), len(staff.AmbulanceIds)),
+			})
+		return false
+	}
+	return true
+}
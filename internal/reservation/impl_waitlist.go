@@ -0,0 +1,423 @@
+package reservation
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+)
+
+// ClaimWaitlistOffer - Books the slot offered to the waitlist entry
+func (this *implWaitlistAPI) ClaimWaitlistOffer(ctx *gin.Context) {
+	value, exists := ctx.Get("waitlist")
+	if !exists {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "waitlist service not found",
+				"error":   "waitlist service not found",
+			})
+		return
+	}
+
+	waitlist, ok := value.(*WaitlistService)
+	if !ok {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "waitlist context is not of type *WaitlistService",
+				"error":   "cannot cast waitlist context to *WaitlistService",
+			})
+		return
+	}
+
+	reservation, err := waitlist.Claim(ctx, ctx.Param("entryId"))
+
+	switch err {
+	case nil:
+		notifyReservation(ctx, EventReservationCreated, *reservation)
+		publishWebhook(ctx, RESERVATION_CREATED, *reservation)
+		ctx.JSON(
+			http.StatusCreated,
+			reservation,
+		)
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Waitlist entry not found",
+				"error":   err.Error(),
+			},
+		)
+	case errNoWaitlistOffer:
+		ctx.JSON(
+			http.StatusConflict,
+			gin.H{
+				"status":  "Conflict",
+				"message": "The waitlist entry has no pending offer",
+				"error":   err.Error(),
+			},
+		)
+	case errReservationOverlap, errNoStaffAvailable:
+		ctx.JSON(
+			http.StatusConflict,
+			gin.H{
+				"status":  "Conflict",
+				"message": "The offered time slot was reserved meanwhile, the entry stays on the waitlist",
+				"error":   err.Error(),
+			},
+		)
+	case errWaitlistOfferExpired:
+		ctx.JSON(
+			http.StatusGone,
+			gin.H{
+				"status":  "Gone",
+				"message": "The offer has expired",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to book the offered slot",
+				"error":   err.Error(),
+			})
+	}
+}
+
+// CreateWaitlistEntry - Register the patient on the waitlist
+func (this *implWaitlistAPI) CreateWaitlistEntry(ctx *gin.Context) {
+	value, exists := ctx.Get("db_service_waitlist")
+	patientValue, patientExists := ctx.Get("db_service_patient")
+	ambulanceValue, ambulanceExists := ctx.Get("db_service_ambulance")
+	if !exists || !patientExists || !ambulanceExists {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service not found",
+				"error":   "db_service not found",
+			})
+		return
+	}
+
+	db, ok := value.(db_service.DbService[WaitlistEntry])
+	patientDB, patientOK := patientValue.(db_service.DbService[Patient])
+	ambulanceDB, ambulanceOK := ambulanceValue.(db_service.DbService[Ambulance])
+	if !ok || !patientOK || !ambulanceOK {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service context is not of type db_service.DbService",
+				"error":   "cannot cast db_service context to db_service.DbService",
+			})
+		return
+	}
+
+	input := WaitlistEntryInput{}
+	err := ctx.BindJSON(&input)
+	if err != nil {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid request body",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid waitlist entry data",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	patientId := ctx.Param("patientId")
+	_, err = patientDB.FindDocument(ctx, patientId)
+
+	switch err {
+	case nil:
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Patient not found",
+				"error":   err.Error(),
+			},
+		)
+		return
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to fetch patient from database",
+				"error":   err.Error(),
+			},
+		)
+		return
+	}
+
+	if len(input.AmbulanceIds) > 0 {
+		ambulances, err := ambulanceDB.FindDocuments(ctx, db_service.NewQuery(db_service.And(
+			db_service.In("id", input.AmbulanceIds),
+			db_service.Eq("medicalexaminations", input.ExaminationType),
+		)).Project("id"))
+		if err != nil {
+			ctx.JSON(
+				http.StatusBadGateway,
+				gin.H{
+					"status":  "Bad Gateway",
+					"message": "Failed to fetch ambulances from database",
+					"error":   err.Error(),
+				},
+			)
+			return
+		}
+
+		found := make(map[string]bool, len(ambulances))
+		for _, ambulance := range ambulances {
+			found[ambulance.Id] = true
+		}
+		for _, ambulanceId := range input.AmbulanceIds {
+			if !found[ambulanceId] {
+				ctx.JSON(
+					http.StatusNotFound,
+					gin.H{
+						"status":  "Not Found",
+						"message": "Ambulance not found or it does not offer the examination",
+						"error":   ambulanceId,
+					},
+				)
+				return
+			}
+		}
+	}
+
+	entry := WaitlistEntry{
+		Id:              uuid.New().String(),
+		PatientId:       patientId,
+		ExaminationType: input.ExaminationType,
+		From:            input.From,
+		To:              input.To,
+		AmbulanceIds:    input.AmbulanceIds,
+		AutoBook:        input.AutoBook,
+		Status:          WAITING,
+		CreatedAt:       time.Now().UTC(),
+	}
+	err = db.CreateDocument(ctx, entry.Id, &entry)
+
+	switch err {
+	case nil:
+		ctx.JSON(
+			http.StatusCreated,
+			entry,
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to create waitlist entry in database",
+				"error":   err.Error(),
+			},
+		)
+	}
+}
+
+// DeleteWaitlistEntry - Removes the patient from the waitlist
+func (this *implWaitlistAPI) DeleteWaitlistEntry(ctx *gin.Context) {
+	value, exists := ctx.Get("db_service_waitlist")
+	if !exists {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service not found",
+				"error":   "db_service not found",
+			})
+		return
+	}
+
+	db, ok := value.(db_service.DbService[WaitlistEntry])
+	if !ok {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service context is not of type db_service.DbService",
+				"error":   "cannot cast db_service context to db_service.DbService",
+			})
+		return
+	}
+
+	err := db.DeleteDocument(ctx, ctx.Param("entryId"))
+
+	switch err {
+	case nil:
+		ctx.AbortWithStatus(http.StatusNoContent)
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Waitlist entry not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to delete waitlist entry from database",
+				"error":   err.Error(),
+			})
+	}
+}
+
+// GetPatientWaitlist - Get waitlist entries of the patient
+func (this *implWaitlistAPI) GetPatientWaitlist(ctx *gin.Context) {
+	value, exists := ctx.Get("db_service_waitlist")
+	patientValue, patientExists := ctx.Get("db_service_patient")
+	if !exists || !patientExists {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service not found",
+				"error":   "db_service not found",
+			})
+		return
+	}
+
+	db, ok := value.(db_service.DbService[WaitlistEntry])
+	patientDB, patientOK := patientValue.(db_service.DbService[Patient])
+	if !ok || !patientOK {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service context is not of type db_service.DbService",
+				"error":   "cannot cast db_service context to db_service.DbService",
+			})
+		return
+	}
+
+	patientId := ctx.Param("patientId")
+	_, err := patientDB.FindDocument(ctx, patientId)
+
+	switch err {
+	case nil:
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Patient not found",
+				"error":   err.Error(),
+			},
+		)
+		return
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to fetch patient from database",
+				"error":   err.Error(),
+			},
+		)
+		return
+	}
+
+	entries, err := db.FindDocuments(ctx, db_service.NewQuery(db_service.Eq("patientid", patientId)).SortBy("createdat", false))
+	if err != nil {
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to retrieve waitlist entries from database",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	if len(entries) == 0 {
+		entries = []WaitlistEntry{}
+	}
+
+	ctx.JSON(
+		http.StatusOK,
+		entries,
+	)
+}
+
+// GetWaitlistEntry - Get a waitlist entry by ID
+func (this *implWaitlistAPI) GetWaitlistEntry(ctx *gin.Context) {
+	value, exists := ctx.Get("db_service_waitlist")
+	if !exists {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service not found",
+				"error":   "db_service not found",
+			})
+		return
+	}
+
+	db, ok := value.(db_service.DbService[WaitlistEntry])
+	if !ok {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service context is not of type db_service.DbService",
+				"error":   "cannot cast db_service context to db_service.DbService",
+			})
+		return
+	}
+
+	entry, err := db.FindDocument(ctx, ctx.Param("entryId"))
+
+	switch err {
+	case nil:
+		ctx.JSON(
+			http.StatusOK,
+			entry,
+		)
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Waitlist entry not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to load waitlist entry from database",
+				"error":   err.Error(),
+			})
+	}
+}
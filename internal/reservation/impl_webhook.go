@@ -0,0 +1,365 @@
+package reservation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+)
+
+// CreateWebhook - Subscribe URL to events
+func (this *implWebhookAPI) CreateWebhook(ctx *gin.Context) {
+	db, _, ok := webhookServices(ctx)
+	if !ok {
+		return
+	}
+
+	input := WebhookInput{}
+	if err := ctx.BindJSON(&input); err != nil {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid request body",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid webhook data",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	secret := input.Secret
+	if secret == "" {
+		var err error
+		if secret, err = newWebhookSecret(); err != nil {
+			ctx.JSON(
+				http.StatusInternalServerError,
+				gin.H{
+					"status":  "Internal Server Error",
+					"message": "Failed to generate secret",
+					"error":   err.Error(),
+				})
+			return
+		}
+	}
+
+	record := WebhookRecord{
+		Webhook: Webhook{
+			Id:          uuid.New().String(),
+			Url:         input.Url,
+			Events:      input.Events,
+			Description: input.Description,
+			CreatedAt:   time.Now().UTC(),
+		},
+		Secret: secret,
+	}
+	err := db.CreateDocument(ctx, record.Id, &record)
+
+	switch err {
+	case nil:
+		ctx.JSON(
+			http.StatusCreated,
+			WebhookSecret{Webhook: record.Webhook, Secret: secret},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to create webhook in database",
+				"error":   err.Error(),
+			})
+	}
+}
+
+// DeleteWebhook - Unsubscribe the webhook, its deliveries are deleted as well
+func (this *implWebhookAPI) DeleteWebhook(ctx *gin.Context) {
+	db, deliveryDB, ok := webhookServices(ctx)
+	if !ok {
+		return
+	}
+	transactorValue, exists := ctx.Get("db_transactor")
+	transactor, ok := transactorValue.(db_service.Transactor)
+	if !exists || !ok {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_transactor not found",
+				"error":   "cannot cast db_transactor context to db_service.Transactor",
+			})
+		return
+	}
+
+	webhookId := ctx.Param("webhookId")
+	err := transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		if err := db.DeleteDocument(txCtx, webhookId); err != nil {
+			return err
+		}
+		return deliveryDB.DeleteDocumentsByField(txCtx, "webhookid", webhookId)
+	})
+
+	switch err {
+	case nil:
+		ctx.AbortWithStatus(http.StatusNoContent)
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Webhook not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to delete webhook from database",
+				"error":   err.Error(),
+			})
+	}
+}
+
+// GetWebhook - Get the webhook subscription
+func (this *implWebhookAPI) GetWebhook(ctx *gin.Context) {
+	db, _, ok := webhookServices(ctx)
+	if !ok {
+		return
+	}
+
+	record, err := db.FindDocument(ctx, ctx.Param("webhookId"))
+
+	switch err {
+	case nil:
+		ctx.JSON(
+			http.StatusOK,
+			record.Webhook,
+		)
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Webhook not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to load webhook from database",
+				"error":   err.Error(),
+			})
+	}
+}
+
+// GetWebhookDeliveries - Get delivery log of the webhook
+func (this *implWebhookAPI) GetWebhookDeliveries(ctx *gin.Context) {
+	db, deliveryDB, ok := webhookServices(ctx)
+	if !ok {
+		return
+	}
+
+	badRequest := func(err error) {
+		ctx.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status":  "Bad Request",
+				"message": "Invalid query parameters",
+				"error":   err.Error(),
+			})
+	}
+
+	skip, limit, err := parsePagination(ctx)
+	if err != nil {
+		badRequest(err)
+		return
+	}
+
+	webhookId := ctx.Param("webhookId")
+	filters := []db_service.Filter{db_service.Eq("webhookid", webhookId)}
+
+	if status := ctx.Query("status"); status != "" {
+		switch WebhookDeliveryStatus(status) {
+		case QUEUED, DELIVERED, DEAD_LETTER:
+			filters = append(filters, db_service.Eq("status", status))
+		default:
+			badRequest(fmt.Errorf("Invalid status: %v", status))
+			return
+		}
+	}
+
+	_, err = db.FindDocument(ctx, webhookId)
+	switch err {
+	case nil:
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Webhook not found",
+				"error":   err.Error(),
+			},
+		)
+		return
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to load webhook from database",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	query := db_service.NewQuery(db_service.And(filters...)).SortBy("createdat", true).SortBy("id", true)
+
+	total, err := deliveryDB.CountDocuments(ctx, query)
+	var deliveries []WebhookDelivery
+	if err == nil {
+		deliveries, err = deliveryDB.FindDocuments(ctx, query.Page(skip, limit))
+	}
+	if err != nil {
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to retrieve webhook deliveries from database",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	if len(deliveries) == 0 {
+		deliveries = []WebhookDelivery{}
+	}
+
+	setTotalCount(ctx, total)
+	ctx.JSON(
+		http.StatusOK,
+		deliveries,
+	)
+}
+
+// GetWebhooks - Get a list of all webhook subscriptions
+func (this *implWebhookAPI) GetWebhooks(ctx *gin.Context) {
+	db, _, ok := webhookServices(ctx)
+	if !ok {
+		return
+	}
+
+	records, err := db.GetDocuments(ctx)
+	if err != nil {
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to retrieve webhooks from database",
+				"error":   err.Error(),
+			})
+		return
+	}
+
+	webhooks := make([]Webhook, 0, len(records))
+	for _, record := range records {
+		webhooks = append(webhooks, record.Webhook)
+	}
+
+	ctx.JSON(
+		http.StatusOK,
+		webhooks,
+	)
+}
+
+// RedeliverWebhookDelivery - Schedules the delivery to be attempted again
+func (this *implWebhookAPI) RedeliverWebhookDelivery(ctx *gin.Context) {
+	_, deliveryDB, ok := webhookServices(ctx)
+	if !ok {
+		return
+	}
+
+	deliveryId := ctx.Param("deliveryId")
+	delivery, err := deliveryDB.FindDocument(ctx, deliveryId)
+	if err == nil && delivery.WebhookId != ctx.Param("webhookId") {
+		err = db_service.ErrNotFound
+	}
+	if err == nil {
+		delivery.Status = QUEUED
+		delivery.Attempts = 0
+		delivery.NextAttemptAt = time.Now().UTC()
+		delivery.DeliveredAt = time.Time{}
+		err = deliveryDB.UpdateDocument(ctx, deliveryId, delivery)
+	}
+
+	switch err {
+	case nil:
+		ctx.JSON(
+			http.StatusOK,
+			delivery,
+		)
+	case db_service.ErrNotFound:
+		ctx.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status":  "Not Found",
+				"message": "Webhook delivery not found",
+				"error":   err.Error(),
+			},
+		)
+	default:
+		ctx.JSON(
+			http.StatusBadGateway,
+			gin.H{
+				"status":  "Bad Gateway",
+				"message": "Failed to update webhook delivery in database",
+				"error":   err.Error(),
+			})
+	}
+}
+
+func webhookServices(ctx *gin.Context) (db_service.DbService[WebhookRecord], db_service.DbService[WebhookDelivery], bool) {
+	value, exists := ctx.Get("db_service_webhook")
+	deliveryValue, deliveryExists := ctx.Get("db_service_webhook_delivery")
+	if !exists || !deliveryExists {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service not found",
+				"error":   "db_service not found",
+			})
+		return nil, nil, false
+	}
+
+	db, ok := value.(db_service.DbService[WebhookRecord])
+	deliveryDB, deliveryOK := deliveryValue.(db_service.DbService[WebhookDelivery])
+	if !ok || !deliveryOK {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service context is not of type db_service.DbService",
+				"error":   "cannot cast db_service context to db_service.DbService",
+			})
+		return nil, nil, false
+	}
+	return db, deliveryDB, true
+}
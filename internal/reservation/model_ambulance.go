@@ -21,4 +21,13 @@ type Ambulance struct {
 	OfficeHours OfficeHours `json:"officeHours"`
 
 	MedicalExaminations []MedicalExaminations `json:"medicalExaminations"`
+
+	// Rooms and devices of the ambulance, without resources the ambulance runs one examination at a time
+	Resources []AmbulanceResource `json:"resources,omitempty"`
+
+	// IANA time zone of the office hours, e.g. Europe/Bratislava, UTC when empty
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// Granularity of the offered slots in minutes, 15 when empty
+	SlotMinutes int32 `json:"slotMinutes,omitempty"`
 }
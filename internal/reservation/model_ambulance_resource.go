@@ -0,0 +1,25 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+// AmbulanceResource - Room or device of the ambulance running one examination at a time
+type AmbulanceResource struct {
+
+	// Unique within the ambulance, generated when empty
+	Id string `json:"id,omitempty"`
+
+	Name string `json:"name"`
+
+	Kind ResourceKind `json:"kind,omitempty"`
+
+	// Examinations the resource can run, a subset of the examinations of the ambulance
+	MedicalExaminations []MedicalExaminations `json:"medicalExaminations"`
+}
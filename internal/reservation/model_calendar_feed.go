@@ -0,0 +1,29 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+import (
+	"time"
+)
+
+type CalendarFeed struct {
+
+	Id string `json:"id"`
+
+	OwnerType string `json:"ownerType"`
+
+	OwnerId string `json:"ownerId"`
+
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Time the token was last replaced
+	RotatedAt time.Time `json:"rotatedAt,omitempty"`
+}
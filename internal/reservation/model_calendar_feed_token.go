@@ -0,0 +1,22 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+type CalendarFeedToken struct {
+
+	Feed CalendarFeed `json:"feed"`
+
+	// Secret token, it cannot be retrieved again
+	Token string `json:"token"`
+
+	// Subscription URL of the feed
+	Url string `json:"url"`
+}
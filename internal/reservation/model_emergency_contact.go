@@ -0,0 +1,21 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+type EmergencyContact struct {
+
+	Name string `json:"name"`
+
+	Relationship string `json:"relationship,omitempty"`
+
+	// Phone number in international format, e.g. +421 900 123 456
+	Phone string `json:"phone"`
+}
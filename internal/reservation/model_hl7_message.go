@@ -0,0 +1,41 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+import (
+	"time"
+)
+
+type Hl7Message struct {
+
+	// Message control ID (MSH-10)
+	Id string `json:"id"`
+
+	ReservationId string `json:"reservationId"`
+
+	// S12 new, S13 rescheduled or S15 cancelled appointment
+	TriggerEvent string `json:"triggerEvent"`
+
+	// Message in ER7 encoding, segments are separated by carriage return
+	Message string `json:"message"`
+
+	Status Hl7MessageStatus `json:"status"`
+
+	// Number of push delivery attempts
+	Attempts int32 `json:"attempts,omitempty"`
+
+	// Error of the last failed delivery attempt
+	LastError string `json:"lastError,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+
+	SentAt time.Time `json:"sentAt,omitempty"`
+}
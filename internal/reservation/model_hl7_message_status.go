@@ -0,0 +1,21 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+// Hl7MessageStatus : Pending messages wait for push delivery, sent messages were acknowledged by the receiver and failed messages ran out of delivery attempts
+type Hl7MessageStatus string
+
+// List of Hl7MessageStatus
+const (
+	PENDING Hl7MessageStatus = "pending"
+	SENT Hl7MessageStatus = "sent"
+	FAILED Hl7MessageStatus = "failed"
+)
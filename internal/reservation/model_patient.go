@@ -23,4 +23,16 @@ type Patient struct {
 	Sex Sex `json:"sex"`
 
 	Bio string `json:"bio,omitempty"`
+
+	Email string `json:"email,omitempty"`
+
+	// Phone number in international format, e.g. +421 900 123 456
+	Phone string `json:"phone,omitempty"`
+
+	Address PostalAddress `json:"address,omitempty"`
+
+	// BCP 47 language tag, e.g. sk or en-GB
+	PreferredLanguage string `json:"preferredLanguage,omitempty"`
+
+	EmergencyContact EmergencyContact `json:"emergencyContact,omitempty"`
 }
@@ -0,0 +1,27 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+type PatientImportReport struct {
+
+	DryRun bool `json:"dryRun"`
+
+	Total int32 `json:"total"`
+
+	// Number of created patients, or of valid rows in dry run
+	Imported int32 `json:"imported"`
+
+	Duplicates int32 `json:"duplicates"`
+
+	Invalid int32 `json:"invalid"`
+
+	Rows []PatientImportRow `json:"rows"`
+}
@@ -0,0 +1,25 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+type PatientImportRow struct {
+
+	// Line number of the row in the imported file
+	Line int32 `json:"line"`
+
+	Status PatientImportRowStatus `json:"status"`
+
+	// Created patient, or the existing patient for duplicates
+	PatientId string `json:"patientId,omitempty"`
+
+	// Reason why the row is invalid
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,22 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+// PatientImportRowStatus : Imported rows created a patient, valid rows would create one in dry run, duplicate rows match an existing patient and invalid rows failed validation
+type PatientImportRowStatus string
+
+// List of PatientImportRowStatus
+const (
+	IMPORTED PatientImportRowStatus = "imported"
+	VALID PatientImportRowStatus = "valid"
+	DUPLICATE PatientImportRowStatus = "duplicate"
+	INVALID PatientImportRowStatus = "invalid"
+)
@@ -0,0 +1,23 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+type PostalAddress struct {
+
+	Street string `json:"street,omitempty"`
+
+	City string `json:"city,omitempty"`
+
+	PostalCode string `json:"postalCode,omitempty"`
+
+	// ISO 3166-1 alpha-2 country code
+	Country string `json:"country,omitempty"`
+}
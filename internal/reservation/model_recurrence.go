@@ -0,0 +1,29 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+import (
+	"time"
+)
+
+// Recurrence - Subset of the iCalendar RRULE, the series ends after count occurrences or at until, exactly one of them is required. Monthly occurrences are skipped in months without the day of the first one.
+type Recurrence struct {
+
+	Frequency RecurrenceFrequency `json:"frequency"`
+
+	// Number of frequency periods between occurrences
+	Interval int32 `json:"interval,omitempty"`
+
+	Count int32 `json:"count,omitempty"`
+
+	// Occurrences start at or before until
+	Until time.Time `json:"until,omitempty"`
+}
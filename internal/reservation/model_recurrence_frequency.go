@@ -0,0 +1,20 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+type RecurrenceFrequency string
+
+// List of RecurrenceFrequency
+const (
+	DAILY RecurrenceFrequency = "daily"
+	WEEKLY RecurrenceFrequency = "weekly"
+	MONTHLY RecurrenceFrequency = "monthly"
+)
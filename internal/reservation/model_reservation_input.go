@@ -22,12 +22,34 @@ type ReservationInput struct {
 
 	PatientId string `json:"patientId,omitempty"`
 
+	// Start of one of the slots offered by the ambulance, a multiple of its slot minutes after opening
 	Start time.Time `json:"start"`
 
+	// End of the examination, the examination must last its duration and end within the office hours
 	End time.Time `json:"end"`
 
 	ExaminationType MedicalExaminations `json:"examinationType"`
 
 	// Optional message for the reservation
 	Message string `json:"message,omitempty"`
+
+	Status ReservationStatus `json:"status,omitempty"`
+
+	// Incremented with every change of the reservation
+	Sequence int32 `json:"sequence,omitempty"`
+
+	// Time of the last change of the reservation
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+
+	// Reservation series of the occurrence
+	SeriesId string `json:"seriesId,omitempty"`
+
+	// Start of the occurrence according to the series rule, it differs from start when the occurrence was rescheduled
+	RecurrenceId time.Time `json:"recurrenceId,omitempty"`
+
+	// Resource of the ambulance running the examination, assigned when booked
+	ResourceId string `json:"resourceId,omitempty"`
+
+	// Staff member performing the examination, assigned when booked
+	StaffId string `json:"staffId,omitempty"`
 }
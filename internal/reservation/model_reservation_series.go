@@ -0,0 +1,43 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+import (
+	"time"
+)
+
+type ReservationSeries struct {
+
+	Id string `json:"id"`
+
+	PatientId string `json:"patientId"`
+
+	AmbulanceId string `json:"ambulanceId"`
+
+	// Start of the first occurrence
+	Start time.Time `json:"start"`
+
+	// End of the first occurrence
+	End time.Time `json:"end"`
+
+	ExaminationType MedicalExaminations `json:"examinationType"`
+
+	// Optional message for the reservations
+	Message string `json:"message,omitempty"`
+
+	Recurrence Recurrence `json:"recurrence"`
+
+	Status ReservationStatus `json:"status"`
+
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+}
@@ -0,0 +1,21 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+type ReservationSeriesResult struct {
+
+	Series ReservationSeries `json:"series"`
+
+	// Scheduled future occurrences of the series
+	Reservations []Reservation `json:"reservations"`
+
+	Unplaced []UnplacedOccurrence `json:"unplaced"`
+}
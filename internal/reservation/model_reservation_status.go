@@ -0,0 +1,20 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+// ReservationStatus : Cancelled reservations do not occupy their time slot
+type ReservationStatus string
+
+// List of ReservationStatus
+const (
+	SCHEDULED ReservationStatus = "scheduled"
+	CANCELLED ReservationStatus = "cancelled"
+)
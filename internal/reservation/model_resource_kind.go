@@ -0,0 +1,19 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+type ResourceKind string
+
+// List of ResourceKind
+const (
+	ROOM ResourceKind = "room"
+	DEVICE ResourceKind = "device"
+)
@@ -10,10 +10,13 @@
 
 package reservation
 
+// Sex : Administrative gender of the patient, aligned with HL7 FHIR AdministrativeGender
 type Sex string
 
 // List of Sex
 const (
 	MALE Sex = "male"
 	FEMALE Sex = "female"
+	OTHER Sex = "other"
+	UNKNOWN Sex = "unknown"
 )
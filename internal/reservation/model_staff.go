@@ -0,0 +1,28 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+type Staff struct {
+
+	Id string `json:"id"`
+
+	Name string `json:"name"`
+
+	Role StaffRole `json:"role"`
+
+	// Ambulances the staff member works at
+	AmbulanceIds []string `json:"ambulanceIds"`
+
+	// Examinations the staff member is qualified for
+	MedicalExaminations []MedicalExaminations `json:"medicalExaminations"`
+
+	Shifts []StaffShift `json:"shifts,omitempty"`
+}
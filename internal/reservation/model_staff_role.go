@@ -0,0 +1,20 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+type StaffRole string
+
+// List of StaffRole
+const (
+	DOCTOR StaffRole = "doctor"
+	TECHNICIAN StaffRole = "technician"
+	NURSE StaffRole = "nurse"
+)
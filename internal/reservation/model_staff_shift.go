@@ -0,0 +1,25 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+// StaffShift - Weekly working shift of the staff member at the ambulance
+type StaffShift struct {
+
+	AmbulanceId string `json:"ambulanceId"`
+
+	Weekday Weekday `json:"weekday"`
+
+	// Start of the shift, wall-clock time in the 15:04 format
+	Start string `json:"start"`
+
+	// End of the shift, wall-clock time in the 15:04 format
+	End string `json:"end"`
+}
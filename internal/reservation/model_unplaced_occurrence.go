@@ -0,0 +1,25 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+import (
+	"time"
+)
+
+type UnplacedOccurrence struct {
+
+	Start time.Time `json:"start"`
+
+	End time.Time `json:"end"`
+
+	// Why the occurrence could not be booked
+	Reason string `json:"reason"`
+}
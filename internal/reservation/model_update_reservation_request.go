@@ -10,7 +10,17 @@
 
 package reservation
 
+import (
+	"time"
+)
+
 type UpdateReservationRequest struct {
 
 	Message string `json:"message,omitempty"`
+
+	// New start of the reservation, the reservation is rescheduled when present
+	Start time.Time `json:"start,omitempty"`
+
+	// New end of the reservation, required together with start
+	End time.Time `json:"end,omitempty"`
 }
@@ -0,0 +1,41 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+import (
+	"time"
+)
+
+type WaitlistEntry struct {
+
+	Id string `json:"id"`
+
+	PatientId string `json:"patientId"`
+
+	ExaminationType MedicalExaminations `json:"examinationType"`
+
+	From time.Time `json:"from"`
+
+	To time.Time `json:"to"`
+
+	AmbulanceIds []string `json:"ambulanceIds,omitempty"`
+
+	AutoBook bool `json:"autoBook,omitempty"`
+
+	Status WaitlistStatus `json:"status"`
+
+	Offer WaitlistOffer `json:"offer,omitempty"`
+
+	// Reservation booked from the waitlist
+	ReservationId string `json:"reservationId,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,32 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+import (
+	"time"
+)
+
+type WaitlistEntryInput struct {
+
+	ExaminationType MedicalExaminations `json:"examinationType"`
+
+	// Start of the window the patient is able to attend
+	From time.Time `json:"from"`
+
+	// End of the window the patient is able to attend
+	To time.Time `json:"to"`
+
+	// Preferred ambulances, any ambulance is accepted when empty
+	AmbulanceIds []string `json:"ambulanceIds,omitempty"`
+
+	// Books the freed slot directly instead of offering it
+	AutoBook bool `json:"autoBook,omitempty"`
+}
@@ -0,0 +1,36 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+import (
+	"time"
+)
+
+type WaitlistOffer struct {
+
+	AmbulanceId string `json:"ambulanceId"`
+
+	Start time.Time `json:"start"`
+
+	End time.Time `json:"end"`
+
+	// The offer must be claimed before this time
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// Id of the reservation booked when the offer is claimed, the offer holds the slot until then
+	ReservationId string `json:"reservationId,omitempty"`
+
+	// Resource of the ambulance held by the offer
+	ResourceId string `json:"resourceId,omitempty"`
+
+	// Staff member held by the offer
+	StaffId string `json:"staffId,omitempty"`
+}
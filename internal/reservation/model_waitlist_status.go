@@ -0,0 +1,22 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+// WaitlistStatus : Waiting entries get offers of freed slots, offered entries have a pending offer, booked entries got a reservation and expired entries let the offer expire
+type WaitlistStatus string
+
+// List of WaitlistStatus
+const (
+	WAITING WaitlistStatus = "waiting"
+	OFFERED WaitlistStatus = "offered"
+	BOOKED WaitlistStatus = "booked"
+	EXPIRED WaitlistStatus = "expired"
+)
@@ -0,0 +1,28 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+import (
+	"time"
+)
+
+type Webhook struct {
+
+	Id string `json:"id"`
+
+	Url string `json:"url"`
+
+	Events []WebhookEvent `json:"events"`
+
+	Description string `json:"description,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
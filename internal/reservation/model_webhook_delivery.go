@@ -0,0 +1,42 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+import (
+	"time"
+)
+
+type WebhookDelivery struct {
+
+	Id string `json:"id"`
+
+	WebhookId string `json:"webhookId"`
+
+	Event WebhookEvent `json:"event"`
+
+	// JSON body of the delivery
+	Payload string `json:"payload"`
+
+	Status WebhookDeliveryStatus `json:"status"`
+
+	Attempts int32 `json:"attempts,omitempty"`
+
+	NextAttemptAt time.Time `json:"nextAttemptAt,omitempty"`
+
+	// HTTP status of the last attempt, 0 when no response was received
+	LastStatusCode int32 `json:"lastStatusCode,omitempty"`
+
+	LastError string `json:"lastError,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+
+	DeliveredAt time.Time `json:"deliveredAt,omitempty"`
+}
@@ -0,0 +1,21 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+// WebhookDeliveryStatus : Queued deliveries wait for the next attempt, delivered ones were accepted with 2xx response and dead letter ones ran out of attempts
+type WebhookDeliveryStatus string
+
+// List of WebhookDeliveryStatus
+const (
+	QUEUED WebhookDeliveryStatus = "queued"
+	DELIVERED WebhookDeliveryStatus = "delivered"
+	DEAD_LETTER WebhookDeliveryStatus = "dead_letter"
+)
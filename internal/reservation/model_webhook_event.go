@@ -0,0 +1,22 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+// WebhookEvent : Type of the event delivered to the webhook
+type WebhookEvent string
+
+// List of WebhookEvent
+const (
+	RESERVATION_CREATED WebhookEvent = "reservation.created"
+	RESERVATION_UPDATED WebhookEvent = "reservation.updated"
+	RESERVATION_DELETED WebhookEvent = "reservation.deleted"
+	PATIENT_DELETED WebhookEvent = "patient.deleted"
+)
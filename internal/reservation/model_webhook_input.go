@@ -0,0 +1,24 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+type WebhookInput struct {
+
+	// HTTP or HTTPS URL receiving the events
+	Url string `json:"url"`
+
+	Events []WebhookEvent `json:"events"`
+
+	Description string `json:"description,omitempty"`
+
+	// Signing secret, generated when not given
+	Secret string `json:"secret,omitempty"`
+}
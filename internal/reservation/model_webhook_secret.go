@@ -0,0 +1,19 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+type WebhookSecret struct {
+
+	Webhook Webhook `json:"webhook"`
+
+	// Signing secret, it cannot be retrieved again
+	Secret string `json:"secret"`
+}
@@ -0,0 +1,24 @@
+/*
+ * Reservation Api
+ *
+ * No description provided (generated by Openapi Generator https://github.com/openapitools/openapi-generator)
+ *
+ * API version: 1.0.0
+ * Contact: xbublavy@stuba.sk
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package reservation
+
+type Weekday string
+
+// List of Weekday
+const (
+	MONDAY Weekday = "monday"
+	TUESDAY Weekday = "tuesday"
+	WEDNESDAY Weekday = "wednesday"
+	THURSDAY Weekday = "thursday"
+	FRIDAY Weekday = "friday"
+	SATURDAY Weekday = "saturday"
+	SUNDAY Weekday = "sunday"
+)
@@ -22,6 +22,16 @@ func AddRoutes(engine *gin.Engine) {
     api.addRoutes(group)
   }
   
+  {
+    api := newCalendarFeedAPI()
+    api.addRoutes(group)
+  }
+  
+  {
+    api := newHl7API()
+    api.addRoutes(group)
+  }
+  
   {
     api := newPatientAPI()
     api.addRoutes(group)
@@ -32,4 +42,24 @@ func AddRoutes(engine *gin.Engine) {
     api.addRoutes(group)
   }
   
+  {
+    api := newReservationSeriesAPI()
+    api.addRoutes(group)
+  }
+  
+  {
+    api := newStaffAPI()
+    api.addRoutes(group)
+  }
+  
+  {
+    api := newWaitlistAPI()
+    api.addRoutes(group)
+  }
+  
+  {
+    api := newWebhookAPI()
+    api.addRoutes(group)
+  }
+  
 }
\ No newline at end of file
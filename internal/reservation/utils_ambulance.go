@@ -2,10 +2,13 @@ package reservation
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/scheduling"
 )
 
 type ambulanceUpdater = func(
@@ -183,7 +186,13 @@ func (a *Ambulance) Validate() error {
         return fmt.Errorf("The medical examinations contain duplicate values: %v", duplicates)
     }
 
-    return nil
+    // Check if the time zone and slot granularity are valid
+    if err := validateAmbulanceSchedule(a.TimeZone, a.SlotMinutes); err != nil {
+        return err
+    }
+
+    // Check if the resources run the medical examinations of the ambulance
+    return validateAmbulanceResources(a.Resources, a.MedicalExaminations)
 }
 
 func (a *AmbulanceInput) Validate() error {
@@ -224,5 +233,93 @@ func (a *AmbulanceInput) Validate() error {
         return fmt.Errorf("The medical examinations contain duplicate values: %v", duplicates)
     }
 
+    // Check if the time zone and slot granularity are valid
+    if err := validateAmbulanceSchedule(a.TimeZone, a.SlotMinutes); err != nil {
+        return err
+    }
+
+    // Check if the resources run the medical examinations of the ambulance
+    return validateAmbulanceResources(a.Resources, a.MedicalExaminations)
+}
+
+// defaultSlotMinutes is the slot granularity of ambulances without one
+const defaultSlotMinutes = 15
+
+// validateAmbulanceSchedule checks that the time zone is a known IANA time
+// zone and that the slots divide an hour
+func validateAmbulanceSchedule(timeZone string, slotMinutes int32) error {
+    if timeZone != "" {
+        if _, err := time.LoadLocation(timeZone); err != nil {
+            return fmt.Errorf("Invalid time zone %q, use an IANA time zone such as Europe/Bratislava", timeZone)
+        }
+    }
+    if slotMinutes < 0 || slotMinutes > 60 || (slotMinutes > 0 && 60%slotMinutes != 0) {
+        return fmt.Errorf("Invalid slot minutes %v, slots must divide an hour", slotMinutes)
+    }
+    return nil
+}
+
+// location returns the time zone of the office hours, UTC when the ambulance
+// has none. Validate rejects unknown time zones, so the host time zone never
+// leaks into the schedule.
+func (a *Ambulance) location() *time.Location {
+    if a.TimeZone == "" {
+        return time.UTC
+    }
+    location, err := time.LoadLocation(a.TimeZone)
+    if err != nil {
+        log.Printf("Unknown time zone %q of ambulance %v, using UTC", a.TimeZone, a.Id)
+        return time.UTC
+    }
+    return location
+}
+
+// officeHoursOn returns the office hours on the calendar date of day in the
+// time zone of the ambulance. Office hours are wall-clock times, so the day
+// may be shorter or longer when the daylight saving time changes.
+func (a *Ambulance) officeHoursOn(day time.Time) (scheduling.Interval, error) {
+    openMinutes, err := clockMinutes(a.OfficeHours.Open)
+    if err != nil {
+        return scheduling.Interval{}, err
+    }
+    closeMinutes, err := clockMinutes(a.OfficeHours.Close)
+    if err != nil {
+        return scheduling.Interval{}, err
+    }
+
+    location := a.location()
+    year, month, date := day.Date()
+    return scheduling.Interval{
+        Start: time.Date(year, month, date, 0, openMinutes, 0, 0, location),
+        End:   time.Date(year, month, date, 0, closeMinutes, 0, 0, location),
+    }, nil
+}
+
+// validateSlot checks that the examination takes one of the slots offered by
+// the ambulance: it lasts as long as the examination, lies within the office
+// hours and starts at a multiple of the slot granularity after opening
+func (a *Ambulance) validateSlot(examinationType MedicalExaminations, start time.Time, end time.Time) error {
+    if duration := examinationTimes[examinationType]; end.Sub(start) != duration {
+        return fmt.Errorf("The examination %v lasts %v", examinationType, duration)
+    }
+
+    hours, err := a.officeHoursOn(start.In(a.location()))
+    if err != nil {
+        return fmt.Errorf("Invalid office hours of the ambulance: %v", err)
+    }
+    if !hours.Contains(scheduling.Interval{Start: start, End: end}) {
+        return fmt.Errorf("The examination must take place within the office hours %v-%v", a.OfficeHours.Open, a.OfficeHours.Close)
+    }
+    if start.Sub(hours.Start)%a.slotDuration() != 0 {
+        return fmt.Errorf("The examination must start at a multiple of %v after opening", a.slotDuration())
+    }
     return nil
-}
\ No newline at end of file
+}
+
+// slotDuration returns the granularity of the slots offered by the ambulance
+func (a *Ambulance) slotDuration() time.Duration {
+    if a.SlotMinutes <= 0 {
+        return defaultSlotMinutes * time.Minute
+    }
+    return time.Duration(a.SlotMinutes) * time.Minute
+}
@@ -0,0 +1,141 @@
+package reservation
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// bookableResources returns the resources of the ambulance. Ambulances
+// without resources have one implicit resource with empty id running the
+// examinations of the ambulance, so they keep running one examination at a
+// time.
+func (a *Ambulance) bookableResources() []AmbulanceResource {
+	if len(a.Resources) > 0 {
+		return a.Resources
+	}
+	return []AmbulanceResource{{Name: a.Name, MedicalExaminations: a.MedicalExaminations}}
+}
+
+// canRun checks if the resource runs the examination, resources without
+// examinations run any
+func (r *AmbulanceResource) canRun(examinationType MedicalExaminations) bool {
+	return len(r.MedicalExaminations) == 0 || slices.Contains(r.MedicalExaminations, examinationType)
+}
+
+// validateAmbulanceResources checks that every resource runs some of the
+// examinations of the ambulance, and that every examination of the ambulance
+// has a resource running it
+func validateAmbulanceResources(resources []AmbulanceResource, examinations []MedicalExaminations) error {
+	if len(resources) == 0 {
+		return nil
+	}
+
+	ids := map[string]bool{}
+	covered := map[MedicalExaminations]bool{}
+	for _, resource := range resources {
+		if resource.Id != "" {
+			if ids[resource.Id] {
+				return fmt.Errorf("Duplicate resource id %q", resource.Id)
+			}
+			ids[resource.Id] = true
+		}
+
+		if len(resource.Name) == 0 || len(resource.Name) > 50 {
+			return fmt.Errorf("Invalid resource name. Name must be at least one character long and max 50 characters long.")
+		}
+
+		switch resource.Kind {
+		case "", ROOM, DEVICE:
+		default:
+			return fmt.Errorf("Invalid kind %q of resource %v", resource.Kind, resource.Name)
+		}
+
+		if len(resource.MedicalExaminations) == 0 {
+			return fmt.Errorf("Resource %v runs no medical examinations", resource.Name)
+		}
+		for _, examination := range resource.MedicalExaminations {
+			if !slices.Contains(examinations, examination) {
+				return fmt.Errorf("Resource %v runs %v, which is not an examination of the ambulance", resource.Name, examination)
+			}
+			covered[examination] = true
+		}
+	}
+
+	for _, examination := range examinations {
+		if !covered[examination] {
+			return fmt.Errorf("No resource runs the medical examination %v", examination)
+		}
+	}
+	return nil
+}
+
+// assignResourceIds generates ids of the new resources
+func assignResourceIds(resources []AmbulanceResource) {
+	for i := range resources {
+		if resources[i].Id == "" {
+			resources[i].Id = uuid.New().String()
+		}
+	}
+}
+
+// assignReservationResource assigns the reservation to a resource of the
+// ambulance running its examination and not used by the overlapping
+// reservations. It returns errReservationOverlap when all such resources are
+// taken.
+func assignReservationResource(ambulance *Ambulance, reservationInput *ReservationInput, overlapping []ReservationInput) error {
+	resources := ambulance.bookableResources()
+	taken := make([]bool, len(resources))
+	byId := make(map[string]int, len(resources))
+	for i, resource := range resources {
+		byId[resource.Id] = i
+	}
+
+	unassigned := []ReservationInput{}
+	for _, other := range overlapping {
+		if i, ok := byId[other.ResourceId]; ok {
+			taken[i] = true
+		} else {
+			unassigned = append(unassigned, other)
+		}
+	}
+	// reservations booked before the resources were configured, or on
+	// removed resources, occupy some free resource as well
+	for _, other := range unassigned {
+		if i := pickResource(resources, taken, other.ExaminationType, reservationInput.ExaminationType); i >= 0 {
+			taken[i] = true
+		}
+	}
+
+	// rescheduled reservations and claimed offers keep their resource
+	if i, ok := byId[reservationInput.ResourceId]; ok && !taken[i] && resources[i].canRun(reservationInput.ExaminationType) {
+		return nil
+	}
+	for i, resource := range resources {
+		if !taken[i] && resource.canRun(reservationInput.ExaminationType) {
+			reservationInput.ResourceId = resource.Id
+			return nil
+		}
+	}
+	return errReservationOverlap
+}
+
+// pickResource returns a free resource for the examination, preferring the
+// ones not needed by the examination kept available, or -1 when none is free
+func pickResource(resources []AmbulanceResource, taken []bool, examinationType MedicalExaminations, keepAvailable MedicalExaminations) int {
+	picked := -1
+	for i, resource := range resources {
+		if taken[i] {
+			continue
+		}
+		preferred := !resource.canRun(keepAvailable)
+		if resource.canRun(examinationType) && preferred {
+			return i
+		}
+		if picked < 0 || (resource.canRun(examinationType) && !resources[picked].canRun(examinationType)) {
+			picked = i
+		}
+	}
+	return picked
+}
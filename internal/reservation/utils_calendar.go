@@ -0,0 +1,143 @@
+package reservation
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/ical"
+)
+
+var examinationNames = map[MedicalExaminations]string{
+	X_RAY:      "X-ray",
+	MRI:        "MRI",
+	CT:         "CT",
+	ULTRASOUND: "Ultrasound",
+	BLOOD_TEST: "Blood test",
+}
+
+// reservationEvent maps the reservation to calendar event, the counterpart
+// (ambulance for patients, patient for ambulances) is shown in the summary
+func reservationEvent(reservation Reservation, counterpart string) ical.Event {
+	examination, ok := examinationNames[reservation.ExaminationType]
+	if !ok {
+		examination = string(reservation.ExaminationType)
+	}
+
+	description := []string{
+		fmt.Sprintf("Patient: %v %v", reservation.Patient.FirstName, reservation.Patient.LastName),
+		fmt.Sprintf("Ambulance: %v", reservation.Ambulance.Name),
+	}
+	if reservation.Message != "" {
+		description = append(description, reservation.Message)
+	}
+
+	stamp := reservation.UpdatedAt
+	if stamp.IsZero() {
+		stamp = reservation.Start
+	}
+
+	return ical.Event{
+		UID:         reservation.Id,
+		Summary:     examination + " – " + counterpart,
+		Description: strings.Join(description, "\n"),
+		Location:    reservation.Ambulance.Address,
+		Start:       reservation.Start,
+		End:         reservation.End,
+		Stamp:       stamp,
+		Sequence:    int(reservation.Sequence),
+		Cancelled:   reservation.Status == CANCELLED,
+	}
+}
+
+// reservationsCalendar publishes the reservations, cancelled reservations are
+// kept with STATUS:CANCELLED so clients remove them
+func reservationsCalendar(name string, reservations []Reservation, counterpart func(Reservation) string) *ical.Calendar {
+	calendar := &ical.Calendar{Method: ical.MethodPublish, Name: name, Events: []ical.Event{}}
+	for _, reservation := range reservations {
+		calendar.Events = append(calendar.Events, reservationEvent(reservation, counterpart(reservation)))
+	}
+	return calendar
+}
+
+func patientCounterpart(reservation Reservation) string {
+	return reservation.Ambulance.Name
+}
+
+func ambulanceCounterpart(reservation Reservation) string {
+	return reservation.Patient.FirstName + " " + reservation.Patient.LastName
+}
+
+func writeCalendar(ctx *gin.Context, filename string, calendar *ical.Calendar) {
+	ctx.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	ctx.Data(http.StatusOK, ical.ContentType, []byte(calendar.String()))
+}
+
+// reservationServices returns db services needed to load reservations with
+// patients and ambulances, it responds with error when they are missing
+func reservationServices(ctx *gin.Context) (
+	db_service.DbService[ReservationInput],
+	db_service.DbService[Patient],
+	db_service.DbService[Ambulance],
+	bool,
+) {
+	reservationValue, reservationExists := ctx.Get("db_service_reservation")
+	patientValue, patientExists := ctx.Get("db_service_patient")
+	ambulanceValue, ambulanceExists := ctx.Get("db_service_ambulance")
+	if !reservationExists || !patientExists || !ambulanceExists {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service not found",
+				"error":   "db_service not found",
+			})
+		return nil, nil, nil, false
+	}
+
+	reservationDB, reservationOK := reservationValue.(db_service.DbService[ReservationInput])
+	patientDB, patientOK := patientValue.(db_service.DbService[Patient])
+	ambulanceDB, ambulanceOK := ambulanceValue.(db_service.DbService[Ambulance])
+	if !reservationOK || !patientOK || !ambulanceOK {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service context is not of type db_service.DbService",
+				"error":   "cannot cast db_service context to db_service.DbService",
+			})
+		return nil, nil, nil, false
+	}
+	return reservationDB, patientDB, ambulanceDB, true
+}
+
+// loadReservations loads the reservations matching the field and fills their
+// patients and ambulances, it responds with error on failure
+func loadReservations(
+	ctx *gin.Context,
+	reservationDB db_service.DbService[ReservationInput],
+	patientDB db_service.DbService[Patient],
+	ambulanceDB db_service.DbService[Ambulance],
+	field string,
+	value string,
+) ([]Reservation, bool) {
+	reservationInputs, err := reservationDB.FindDocuments(ctx, db_service.NewQuery(db_service.Eq(field, value)).SortBy("start", false))
+	if err == nil {
+		var reservations []Reservation
+		reservations, err = expandReservations(ctx, patientDB, ambulanceDB, reservationInputs)
+		if err == nil {
+			return reservations, true
+		}
+	}
+
+	ctx.JSON(
+		http.StatusBadGateway,
+		gin.H{
+			"status":  "Bad Gateway",
+			"message": "Failed to retrieve reservations from database",
+			"error":   err.Error(),
+		})
+	return nil, false
+}
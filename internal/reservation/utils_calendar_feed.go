@@ -0,0 +1,113 @@
+package reservation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+)
+
+// Owners of the calendar feeds
+const (
+	calendarFeedOwnerPatient   = "patient"
+	calendarFeedOwnerAmbulance = "ambulance"
+)
+
+// CalendarFeedRecord is the stored calendar feed, only the hash of its secret token is stored
+type CalendarFeedRecord struct {
+	CalendarFeed `bson:",inline"`
+
+	TokenHash string `json:"-"`
+
+	// ChangedAt is updated when reservations of the owner are deleted. Deleted
+	// reservations leave nothing behind whose modification time would change
+	// the Last-Modified time of the feed.
+	ChangedAt time.Time `json:"-"`
+}
+
+// newCalendarFeedToken generates random token and its hash
+func newCalendarFeedToken() (token string, tokenHash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(secret)
+	return token, hashCalendarFeedToken(token), nil
+}
+
+func hashCalendarFeedToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// calendarFeedUrl returns subscription URL of the token as seen by the client
+func calendarFeedUrl(ctx *gin.Context, token string) string {
+	return requestBaseUrl(ctx) + "/api/feeds/" + token + ".ics"
+}
+
+// requestBaseUrl returns scheme and host of the service as seen by the client
+func requestBaseUrl(ctx *gin.Context) string {
+	scheme := "http"
+	if ctx.Request.TLS != nil {
+		scheme = "https"
+	}
+	if forwarded := ctx.GetHeader("X-Forwarded-Proto"); forwarded != "" {
+		scheme = forwarded
+	}
+	host := ctx.Request.Host
+	if forwarded := ctx.GetHeader("X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+	return scheme + "://" + host
+}
+
+// calendarFeedLastModified returns the time of the last change of the feed content
+func calendarFeedLastModified(record *CalendarFeedRecord, reservations []Reservation) time.Time {
+	lastModified := record.CreatedAt
+	for _, changedAt := range []time.Time{record.RotatedAt, record.ChangedAt} {
+		if changedAt.After(lastModified) {
+			lastModified = changedAt
+		}
+	}
+	for _, reservation := range reservations {
+		if reservation.UpdatedAt.After(lastModified) {
+			lastModified = reservation.UpdatedAt
+		}
+	}
+	return lastModified.UTC().Truncate(time.Second)
+}
+
+// touchCalendarFeeds marks the feeds of the owners changed, so clients
+// revalidating by If-Modified-Since notice deleted reservations
+func touchCalendarFeeds(ctx *gin.Context, ownerIds ...string) {
+	value, exists := ctx.Get("db_service_calendar_feed")
+	if !exists || len(ownerIds) == 0 {
+		return
+	}
+	db, ok := value.(db_service.DbService[CalendarFeedRecord])
+	if !ok {
+		log.Printf("db_service_calendar_feed context is not of type db_service.DbService")
+		return
+	}
+
+	touchCtx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+	records, err := db.FindDocuments(touchCtx, db_service.NewQuery(db_service.In("ownerid", ownerIds)))
+	if err != nil {
+		log.Printf("Failed to load calendar feeds: %v", err)
+		return
+	}
+	now := time.Now().UTC()
+	for _, record := range records {
+		record.ChangedAt = now
+		if err := db.UpdateDocument(touchCtx, record.Id, &record); err != nil && err != db_service.ErrNotFound {
+			log.Printf("Failed to update calendar feed %v: %v", record.Id, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package reservation
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/scheduling"
+)
+
+// availableExaminations returns free time slots of the ambulance for the
+// examination on the calendar date of requestDate, taken in the time zone of
+// the ambulance. Reservations and pending waitlist offers occupy their time.
+// Every resource running the examination and every staff member
+// qualified for it has its own timeline, the slots are computed by the
+// scheduling package. Slots starting before now are not offered.
+func availableExaminations(
+	ctx context.Context,
+	reservationDB db_service.DbService[ReservationInput],
+	staffDB db_service.DbService[Staff],
+	waitlistDB db_service.DbService[WaitlistEntry],
+	ambulance Ambulance,
+	requestDate time.Time,
+	examinationType MedicalExaminations,
+	now time.Time,
+) ([]Examination, error) {
+	hours, err := ambulance.officeHoursOn(requestDate)
+	if err != nil {
+		return nil, err
+	}
+
+	reservationInputs, err := reservationDB.FindDocuments(ctx, db_service.NewQuery(db_service.And(
+		db_service.Eq("ambulanceid", ambulance.Id),
+		db_service.Lt("start", hours.End),
+		db_service.Gt("end", hours.Start),
+		activeReservationFilter(),
+	)).Project("start", "end", "resourceid", "examinationtype"))
+	if err != nil {
+		return nil, err
+	}
+	// slots offered to the waitlist are held until the offer is claimed
+	held, err := offerHolds(ctx, waitlistDB, db_service.And(
+		db_service.Eq("offer.ambulanceid", ambulance.Id),
+		db_service.Lt("offer.start", hours.End),
+		db_service.Gt("offer.end", hours.Start),
+	), "")
+	if err != nil {
+		return nil, err
+	}
+	reservationInputs = append(reservationInputs, held...)
+
+	resources := ambulance.bookableResources()
+	timelines := make([]scheduling.Timeline, len(resources))
+	resourceIndex := make(map[string]int, len(resources))
+	for i, resource := range resources {
+		timelines[i].Available = []scheduling.Interval{hours}
+		resourceIndex[resource.Id] = i
+	}
+
+	unassigned := []scheduling.Interval{}
+	for _, reservationInput := range reservationInputs {
+		reserved := scheduling.Interval{Start: reservationInput.Start, End: reservationInput.End}
+		if i, ok := resourceIndex[reservationInput.ResourceId]; ok {
+			timelines[i].Busy = append(timelines[i].Busy, reserved)
+		} else {
+			unassigned = append(unassigned, reserved)
+		}
+	}
+
+	// reservations booked before the resources were configured occupy a
+	// free resource, preferably one not running the examination
+	for _, reserved := range unassigned {
+		picked := -1
+		for i, resource := range resources {
+			if !slices.ContainsFunc(timelines[i].Busy, reserved.Overlaps) {
+				if picked < 0 || !resource.canRun(examinationType) {
+					picked = i
+				}
+				if !resource.canRun(examinationType) {
+					break
+				}
+			}
+		}
+		if picked >= 0 {
+			timelines[picked].Busy = append(timelines[picked].Busy, reserved)
+		}
+	}
+
+	capable := []scheduling.Timeline{}
+	for i, resource := range resources {
+		if resource.canRun(examinationType) {
+			capable = append(capable, timelines[i])
+		}
+	}
+
+	staff, err := staffTimelines(ctx, staffDB, reservationDB, waitlistDB, ambulance.Id, examinationType, hours)
+	if err != nil {
+		return nil, err
+	}
+
+	slots := scheduling.FreeSlots(scheduling.Request{
+		Hours:     hours,
+		Step:      ambulance.slotDuration(),
+		Duration:  examinationTimes[examinationType],
+		Now:       now,
+		Resources: capable,
+		Staff:     staff,
+	})
+
+	examinations := make([]Examination, 0, len(slots))
+	for _, slot := range slots {
+		examinations = append(examinations, Examination{
+			Ambulance:       ambulance,
+			Start:           slot.Start,
+			End:             slot.End,
+			ExaminationType: examinationType,
+		})
+	}
+	return examinations, nil
+}
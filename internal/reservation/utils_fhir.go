@@ -0,0 +1,539 @@
+package reservation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/fhir"
+)
+
+// fhirBasePath is the service base of the FHIR facade
+const fhirBasePath = "/fhir/R4"
+
+// maxFhirSlotSearchDays limits the range of the slot search, slots are
+// computed from office hours and reservations of every day in the range
+const maxFhirSlotSearchDays = 31
+
+var fhirDaysOfWeek = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+// writeFhir responds with the FHIR resource
+func writeFhir(ctx *gin.Context, status int, resource interface{}) {
+	body, err := json.Marshal(resource)
+	if err != nil {
+		fhirError(ctx, http.StatusInternalServerError, "exception", err.Error())
+		return
+	}
+	ctx.Data(status, fhir.ContentType, body)
+}
+
+// fhirError responds with OperationOutcome describing the error
+func fhirError(ctx *gin.Context, status int, code string, diagnostics string) {
+	body, _ := json.Marshal(fhir.NewOperationOutcome(code, diagnostics))
+	ctx.Data(status, fhir.ContentType, body)
+}
+
+func fhirBaseUrl(ctx *gin.Context) string {
+	return requestBaseUrl(ctx) + fhirBasePath
+}
+
+// fhirPagination reads the _count and _offset search parameters
+func fhirPagination(ctx *gin.Context) (skip int64, limit int64, err error) {
+	limit, err = strconv.ParseInt(ctx.DefaultQuery("_count", strconv.Itoa(defaultPageSize)), 10, 64)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, 0, fmt.Errorf("_count must be an integer between 1 and %v", maxPageSize)
+	}
+
+	skip, err = strconv.ParseInt(ctx.DefaultQuery("_offset", "0"), 10, 64)
+	if err != nil || skip < 0 {
+		return 0, 0, fmt.Errorf("_offset must be a non-negative integer")
+	}
+	return skip, limit, nil
+}
+
+// addFhirPageLinks links the bundle to its page and to the next page of the search
+func addFhirPageLinks(ctx *gin.Context, bundle *fhir.Bundle, skip int64, limit int64, total int64) {
+	self := *ctx.Request.URL
+	bundle.AddLink("self", requestBaseUrl(ctx)+self.RequestURI())
+
+	if skip+limit < total {
+		next := self
+		query := next.Query()
+		query.Set("_offset", strconv.FormatInt(skip+limit, 10))
+		query.Set("_count", strconv.FormatInt(limit, 10))
+		next.RawQuery = query.Encode()
+		bundle.AddLink("next", requestBaseUrl(ctx)+next.RequestURI())
+	}
+}
+
+// fhirReferenceParam returns id from the reference search parameter, both
+// "Patient/123" and "123" are accepted
+func fhirReferenceParam(value string, resourceType string) string {
+	if id, ok := fhir.ParseReference(value, resourceType); ok {
+		return id
+	}
+	return value
+}
+
+// fhirTokenParam returns code of the token search parameter, the system in
+// "system|code" is ignored
+func fhirTokenParam(value string) string {
+	if index := strings.LastIndex(value, "|"); index >= 0 {
+		return value[index+1:]
+	}
+	return value
+}
+
+// fhirDateFilter matches values of the field against the date search
+// parameter, bound converts the range bounds to the stored values
+func fhirDateFilter(field string, param fhir.DateParam, bound func(time.Time) interface{}) db_service.Filter {
+	switch param.Prefix {
+	case "gt":
+		return db_service.Gte(field, bound(param.Upper))
+	case "ge":
+		return db_service.Gte(field, bound(param.Lower))
+	case "lt":
+		return db_service.Lt(field, bound(param.Lower))
+	case "le":
+		return db_service.Lt(field, bound(param.Upper))
+	default:
+		return db_service.And(db_service.Gte(field, bound(param.Lower)), db_service.Lt(field, bound(param.Upper)))
+	}
+}
+
+func fhirInstantBound(t time.Time) interface{} {
+	return t
+}
+
+func fhirDateBound(t time.Time) interface{} {
+	return t.Format("2006-01-02")
+}
+
+// fhirDateRange intersects the date search parameters into [lower, upper),
+// zero times mean the range is not bounded
+func fhirDateRange(values []string) (lower time.Time, upper time.Time, err error) {
+	for _, value := range values {
+		param, err := fhir.ParseDateParam(value)
+		if err != nil {
+			return lower, upper, err
+		}
+
+		var from, to time.Time
+		switch param.Prefix {
+		case "gt":
+			from = param.Upper
+		case "ge":
+			from = param.Lower
+		case "lt":
+			to = param.Lower
+		case "le":
+			to = param.Upper
+		default:
+			from, to = param.Lower, param.Upper
+		}
+		if !from.IsZero() && (lower.IsZero() || from.After(lower)) {
+			lower = from
+		}
+		if !to.IsZero() && (upper.IsZero() || to.Before(upper)) {
+			upper = to
+		}
+	}
+	return lower, upper, nil
+}
+
+func examinationConcept(examinationType MedicalExaminations) fhir.CodeableConcept {
+	return fhir.CodeableConcept{
+		Coding: []fhir.Coding{{
+			System:  fhir.SystemExaminationType,
+			Code:    string(examinationType),
+			Display: examinationNames[examinationType],
+		}},
+		Text: examinationNames[examinationType],
+	}
+}
+
+// examinationFromConcepts returns the first examination type of the concepts
+func examinationFromConcepts(concepts []fhir.CodeableConcept) (MedicalExaminations, bool) {
+	for _, concept := range concepts {
+		for _, coding := range concept.Coding {
+			if coding.System != "" && coding.System != fhir.SystemExaminationType {
+				continue
+			}
+			if examinationType := MedicalExaminations(coding.Code); examinationType.IsValid() {
+				return examinationType, true
+			}
+		}
+	}
+	return "", false
+}
+
+func fhirPatient(patient Patient) fhir.Patient {
+	resource := fhir.Patient{
+		ResourceType: "Patient",
+		Id:           patient.Id,
+		Name: []fhir.HumanName{{
+			Text:   patient.FirstName + " " + patient.LastName,
+			Family: patient.LastName,
+			Given:  strings.Fields(patient.FirstName),
+		}},
+		Gender:    string(patient.Sex),
+		BirthDate: patient.Birthday,
+	}
+
+	if patient.Email != "" {
+		resource.Telecom = append(resource.Telecom, fhir.ContactPoint{System: "email", Value: patient.Email})
+	}
+	if patient.Phone != "" {
+		resource.Telecom = append(resource.Telecom, fhir.ContactPoint{System: "phone", Value: patient.Phone})
+	}
+
+	if patient.Address != (PostalAddress{}) {
+		address := fhir.Address{
+			City:       patient.Address.City,
+			PostalCode: patient.Address.PostalCode,
+			Country:    patient.Address.Country,
+		}
+		if patient.Address.Street != "" {
+			address.Line = []string{patient.Address.Street}
+		}
+		resource.Address = []fhir.Address{address}
+	}
+
+	if patient.PreferredLanguage != "" {
+		resource.Communication = []fhir.PatientCommunication{{
+			Language:  fhir.CodeableConcept{Coding: []fhir.Coding{{System: fhir.SystemBCP47, Code: patient.PreferredLanguage}}},
+			Preferred: true,
+		}}
+	}
+
+	if patient.EmergencyContact != (EmergencyContact{}) {
+		contact := fhir.PatientContact{
+			Name:    &fhir.HumanName{Text: patient.EmergencyContact.Name},
+			Telecom: []fhir.ContactPoint{{System: "phone", Value: patient.EmergencyContact.Phone}},
+		}
+		if patient.EmergencyContact.Relationship != "" {
+			contact.Relationship = []fhir.CodeableConcept{{Text: patient.EmergencyContact.Relationship}}
+		}
+		resource.Contact = []fhir.PatientContact{contact}
+	}
+	return resource
+}
+
+// patientFromFhir maps the FHIR patient, only the first name, address and
+// contact are kept as the patient has a single one of each
+func patientFromFhir(resource fhir.Patient) (Patient, error) {
+	if resource.ResourceType != "Patient" {
+		return Patient{}, fmt.Errorf("resourceType must be Patient")
+	}
+
+	patient := Patient{
+		Id:       resource.Id,
+		Sex:      Sex(resource.Gender),
+		Birthday: resource.BirthDate,
+	}
+
+	if len(resource.Name) > 0 {
+		patient.FirstName = strings.Join(resource.Name[0].Given, " ")
+		patient.LastName = resource.Name[0].Family
+	}
+
+	for _, telecom := range resource.Telecom {
+		switch {
+		case telecom.System == "email" && patient.Email == "":
+			patient.Email = telecom.Value
+		case (telecom.System == "phone" || telecom.System == "sms") && patient.Phone == "":
+			patient.Phone = telecom.Value
+		}
+	}
+
+	if len(resource.Address) > 0 {
+		address := resource.Address[0]
+		patient.Address = PostalAddress{
+			Street:     strings.Join(address.Line, ", "),
+			City:       address.City,
+			PostalCode: address.PostalCode,
+			Country:    address.Country,
+		}
+	}
+
+	for _, communication := range resource.Communication {
+		if language := communication.Language.Code(fhir.SystemBCP47); language != "" && (patient.PreferredLanguage == "" || communication.Preferred) {
+			patient.PreferredLanguage = language
+		}
+	}
+
+	if len(resource.Contact) > 0 {
+		contact := resource.Contact[0]
+		if contact.Name != nil {
+			patient.EmergencyContact.Name = contact.Name.Text
+			if patient.EmergencyContact.Name == "" {
+				patient.EmergencyContact.Name = strings.TrimSpace(strings.Join(contact.Name.Given, " ") + " " + contact.Name.Family)
+			}
+		}
+		if len(contact.Relationship) > 0 {
+			patient.EmergencyContact.Relationship = contact.Relationship[0].Text
+			if patient.EmergencyContact.Relationship == "" {
+				patient.EmergencyContact.Relationship = contact.Relationship[0].Code("")
+			}
+		}
+		for _, telecom := range contact.Telecom {
+			if telecom.System == "phone" {
+				patient.EmergencyContact.Phone = telecom.Value
+				break
+			}
+		}
+	}
+	return patient, nil
+}
+
+func fhirLocation(ambulance Ambulance) fhir.Location {
+	return fhir.Location{
+		ResourceType: "Location",
+		Id:           ambulance.Id,
+		Status:       "active",
+		Name:         ambulance.Name,
+		Mode:         "instance",
+		Address:      &fhir.Address{Text: ambulance.Address},
+		PhysicalType: &fhir.CodeableConcept{Coding: []fhir.Coding{{System: fhir.SystemLocationPhysicalType, Code: "ro", Display: "Room"}}},
+		HoursOfOperation: []fhir.LocationHoursOfOperation{{
+			DaysOfWeek:  fhirDaysOfWeek,
+			OpeningTime: ambulance.OfficeHours.Open + ":00",
+			ClosingTime: ambulance.OfficeHours.Close + ":00",
+		}},
+	}
+}
+
+func fhirHealthcareService(ambulance Ambulance) fhir.HealthcareService {
+	resource := fhir.HealthcareService{
+		ResourceType: "HealthcareService",
+		Id:           ambulance.Id,
+		Active:       true,
+		Name:         ambulance.Name,
+		Location:     []fhir.Reference{fhir.NewReference("Location", ambulance.Id, ambulance.Name)},
+		AvailableTime: []fhir.AvailableTime{{
+			DaysOfWeek:         fhirDaysOfWeek,
+			AvailableStartTime: ambulance.OfficeHours.Open + ":00",
+			AvailableEndTime:   ambulance.OfficeHours.Close + ":00",
+		}},
+	}
+	for _, examinationType := range ambulance.MedicalExaminations {
+		resource.Type = append(resource.Type, examinationConcept(examinationType))
+	}
+	return resource
+}
+
+// fhirSchedule publishes the office hours of the ambulance, it shares id with the ambulance
+func fhirSchedule(ambulance Ambulance) fhir.Schedule {
+	resource := fhir.Schedule{
+		ResourceType: "Schedule",
+		Id:           ambulance.Id,
+		Active:       true,
+		Actor: []fhir.Reference{
+			fhir.NewReference("Location", ambulance.Id, ambulance.Name),
+			fhir.NewReference("HealthcareService", ambulance.Id, ambulance.Name),
+		},
+	}
+	for _, examinationType := range ambulance.MedicalExaminations {
+		resource.ServiceType = append(resource.ServiceType, examinationConcept(examinationType))
+	}
+	return resource
+}
+
+// fhirSlotId identifies the computed slot by ambulance, examination and start,
+// underscores are not allowed in FHIR ids so they are replaced by hyphens
+func fhirSlotId(ambulanceId string, examinationType MedicalExaminations, start time.Time) string {
+	return ambulanceId + "." + strings.ReplaceAll(string(examinationType), "_", "-") + "." + start.UTC().Format("20060102T1504")
+}
+
+// parseFhirSlotId returns the ambulance, examination and start of the slot
+func parseFhirSlotId(id string) (ambulanceId string, examinationType MedicalExaminations, start time.Time, err error) {
+	parts := strings.Split(id, ".")
+	if len(parts) < 3 {
+		return "", "", start, fmt.Errorf("invalid slot id %v", id)
+	}
+
+	ambulanceId = strings.Join(parts[:len(parts)-2], ".")
+	examinationType = MedicalExaminations(strings.ReplaceAll(parts[len(parts)-2], "-", "_"))
+	if !examinationType.IsValid() {
+		return "", "", start, fmt.Errorf("invalid examination type of slot %v", id)
+	}
+
+	start, err = time.Parse("20060102T1504", parts[len(parts)-1])
+	if err != nil {
+		return "", "", start, fmt.Errorf("invalid start of slot %v", id)
+	}
+	return ambulanceId, examinationType, start, nil
+}
+
+func fhirSlot(examination Examination, status string) fhir.Slot {
+	return fhir.Slot{
+		ResourceType: "Slot",
+		Id:           fhirSlotId(examination.Ambulance.Id, examination.ExaminationType, examination.Start),
+		ServiceType:  []fhir.CodeableConcept{examinationConcept(examination.ExaminationType)},
+		Schedule:     fhir.NewReference("Schedule", examination.Ambulance.Id, examination.Ambulance.Name),
+		Status:       status,
+		Start:        examination.Start.UTC(),
+		End:          examination.End.UTC(),
+	}
+}
+
+// fhirProposedAppointment is result of the $find operation, booking it with
+// the slot reference creates the reservation
+func fhirProposedAppointment(examination Examination, patient *Patient) fhir.Appointment {
+	slot := fhirSlot(examination, "free")
+	resource := fhir.Appointment{
+		ResourceType: "Appointment",
+		Status:       "proposed",
+		ServiceType:  slot.ServiceType,
+		Description:  examinationNames[examination.ExaminationType],
+		Start:        &slot.Start,
+		End:          &slot.End,
+		Slot:         []fhir.Reference{fhir.NewReference("Slot", slot.Id, "")},
+		Participant: []fhir.AppointmentParticipant{
+			fhirLocationParticipant(examination.Ambulance, "needs-action"),
+		},
+	}
+	if patient != nil {
+		resource.Participant = append(resource.Participant, fhirPatientParticipant(*patient, "needs-action"))
+	}
+	return resource
+}
+
+func fhirAppointment(reservation Reservation) fhir.Appointment {
+	start := reservation.Start.UTC()
+	end := reservation.End.UTC()
+	status := "booked"
+	if reservation.Status == CANCELLED {
+		status = "cancelled"
+	}
+
+	resource := fhir.Appointment{
+		ResourceType: "Appointment",
+		Id:           reservation.Id,
+		Status:       status,
+		ServiceType:  []fhir.CodeableConcept{examinationConcept(reservation.ExaminationType)},
+		Description:  examinationNames[reservation.ExaminationType],
+		Start:        &start,
+		End:          &end,
+		Comment:      reservation.Message,
+		Participant: []fhir.AppointmentParticipant{
+			fhirPatientParticipant(reservation.Patient, "accepted"),
+			fhirLocationParticipant(reservation.Ambulance, "accepted"),
+		},
+	}
+	if !reservation.UpdatedAt.IsZero() {
+		updatedAt := reservation.UpdatedAt.UTC()
+		resource.Meta = &fhir.Meta{
+			VersionId:   strconv.Itoa(int(reservation.Sequence) + 1),
+			LastUpdated: &updatedAt,
+		}
+	}
+	return resource
+}
+
+func fhirPatientParticipant(patient Patient, status string) fhir.AppointmentParticipant {
+	reference := fhir.NewReference("Patient", patient.Id, patient.FirstName+" "+patient.LastName)
+	return fhir.AppointmentParticipant{
+		Type:     []fhir.CodeableConcept{{Coding: []fhir.Coding{{System: fhir.SystemParticipationType, Code: "SBJ", Display: "subject"}}}},
+		Actor:    &reference,
+		Required: "required",
+		Status:   status,
+	}
+}
+
+func fhirLocationParticipant(ambulance Ambulance, status string) fhir.AppointmentParticipant {
+	reference := fhir.NewReference("Location", ambulance.Id, ambulance.Name)
+	return fhir.AppointmentParticipant{
+		Type:     []fhir.CodeableConcept{{Coding: []fhir.Coding{{System: fhir.SystemParticipationType, Code: "LOC", Display: "location"}}}},
+		Actor:    &reference,
+		Required: "required",
+		Status:   status,
+	}
+}
+
+// fhirAppointmentStatus maps the appointment status search parameter to reservation status
+func fhirAppointmentStatus(status string) (ReservationStatus, bool) {
+	switch status {
+	case "booked":
+		return SCHEDULED, true
+	case "cancelled":
+		return CANCELLED, true
+	}
+	return "", false
+}
+
+// findFhirSlots computes free slots for the examination starting in [lower, upper)
+func findFhirSlots(
+	ctx *gin.Context,
+	reservationDB db_service.DbService[ReservationInput],
+	ambulanceDB db_service.DbService[Ambulance],
+	staffDB db_service.DbService[Staff],
+	waitlistDB db_service.DbService[WaitlistEntry],
+	examinationType MedicalExaminations,
+	lower time.Time,
+	upper time.Time,
+	ambulanceId string,
+) ([]Examination, error) {
+	filter := db_service.Eq("medicalexaminations", examinationType)
+	if ambulanceId != "" {
+		filter = db_service.And(filter, db_service.Eq("id", ambulanceId))
+	}
+	ambulances, err := ambulanceDB.FindDocuments(ctx, db_service.NewQuery(filter).SortBy("name", false))
+	if err != nil {
+		return nil, err
+	}
+
+	// days of the ambulances in other time zones start up to a day earlier or
+	// later than the UTC ones
+	examinations := []Examination{}
+	now := time.Now()
+	for day := lower.UTC().Truncate(24*time.Hour).AddDate(0, 0, -1); day.Before(upper.AddDate(0, 0, 1)); day = day.AddDate(0, 0, 1) {
+		for _, ambulance := range ambulances {
+			available, err := availableExaminations(ctx, reservationDB, staffDB, waitlistDB, ambulance, day, examinationType, now)
+			if err != nil {
+				return nil, err
+			}
+			for _, examination := range available {
+				if !examination.Start.Before(lower) && examination.Start.Before(upper) {
+					examinations = append(examinations, examination)
+				}
+			}
+		}
+	}
+	return examinations, nil
+}
+
+// fhirSlotSearchRange reads the range of the slot search, it must be bounded
+func fhirSlotSearchRange(values []string) (time.Time, time.Time, error) {
+	lower, upper, err := fhirDateRange(values)
+	if err != nil {
+		return lower, upper, err
+	}
+	if lower.IsZero() || upper.IsZero() {
+		return lower, upper, fmt.Errorf("start must be bounded from both sides, e.g. start=ge2024-05-01&start=lt2024-05-08")
+	}
+	if upper.Sub(lower) > maxFhirSlotSearchDays*24*time.Hour {
+		return lower, upper, fmt.Errorf("start range cannot exceed %v days", maxFhirSlotSearchDays)
+	}
+	return lower, upper, nil
+}
+
+// fhirQueryValues returns all values of the search parameter, comma separated
+// values are split as they are alternatives in FHIR
+func fhirQueryValues(query url.Values, name string) []string {
+	values := []string{}
+	for _, value := range query[name] {
+		for _, item := range strings.Split(value, ",") {
+			if item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,253 @@
+package reservation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/hl7"
+)
+
+// hl7IdentifierAuthority assigns the patient and appointment identifiers
+const hl7IdentifierAuthority = "RESERVATION"
+
+var hl7Sexes = map[Sex]string{
+	MALE:    "M",
+	FEMALE:  "F",
+	OTHER:   "O",
+	UNKNOWN: "U",
+}
+
+// Hl7Outbox stores SIU messages of reservation events, so the radiology
+// information system can pull them, and pushes them to the Sender in the
+// order they were created
+type Hl7Outbox struct {
+	OutboxDB db_service.DbService[Hl7Message]
+	Header   hl7.Header
+	// Sender pushes the messages, they are only available for pulling when nil
+	Sender hl7.Sender
+	// MaxAttempts of push delivery before the message is marked failed
+	MaxAttempts int32
+}
+
+// Enqueue stores SIU message of the reservation event
+func (this *Hl7Outbox) Enqueue(ctx context.Context, trigger string, reservation Reservation) (*Hl7Message, error) {
+	controlId, err := newHl7ControlId()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	message := Hl7Message{
+		Id:            controlId,
+		ReservationId: reservation.Id,
+		TriggerEvent:  trigger,
+		Message:       newSIUMessage(this.Header, trigger, reservation, controlId, now),
+		Status:        PENDING,
+		CreatedAt:     now.UTC(),
+	}
+	if err := this.OutboxDB.CreateDocument(ctx, message.Id, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// DeliverPending pushes the pending messages oldest first. The scan stops at
+// the first failure, so the receiver does not get a reschedule before the
+// appointment it moves.
+func (this *Hl7Outbox) DeliverPending(ctx context.Context) error {
+	messages, err := this.OutboxDB.FindDocuments(ctx, db_service.NewQuery(db_service.Eq("status", PENDING)).
+		SortBy("createdat", false).SortBy("id", false))
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		// claim the attempt, so replicas do not push the same message concurrently
+		attempts := message.Attempts
+		message.Attempts++
+		switch err := this.OutboxDB.UpdateDocumentIf(ctx, message.Id, db_service.And(
+			db_service.Eq("status", PENDING),
+			db_service.Eq("attempts", attempts),
+		), &message); err {
+		case nil:
+		case db_service.ErrNotFound:
+			continue
+		default:
+			return err
+		}
+
+		sendErr := this.Sender.Send(ctx, message.Message)
+		if sendErr == nil {
+			message.Status = SENT
+			message.SentAt = time.Now().UTC()
+			message.LastError = ""
+		} else {
+			message.LastError = sendErr.Error()
+			if message.Attempts >= this.MaxAttempts {
+				message.Status = FAILED
+			}
+		}
+		if err := this.OutboxDB.UpdateDocument(ctx, message.Id, &message); err != nil {
+			return err
+		}
+
+		if sendErr != nil {
+			if message.Status == FAILED {
+				log.Printf("HL7 message %v failed after %v attempts: %v", message.Id, message.Attempts, sendErr)
+				continue
+			}
+			return fmt.Errorf("failed to send HL7 message %v: %w", message.Id, sendErr)
+		}
+	}
+	return nil
+}
+
+// Run pushes the pending messages every interval until the context is cancelled
+func (this *Hl7Outbox) Run(ctx context.Context, interval time.Duration) {
+	if this.Sender == nil {
+		log.Printf("HL7 push delivery is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := this.DeliverPending(ctx); err != nil {
+			log.Printf("Failed to deliver HL7 messages: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newHl7ControlId generates unique message control id, MSH-10 is limited to 20 characters
+func newHl7ControlId() (string, error) {
+	random := make([]byte, 10)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(random), nil
+}
+
+// newSIUMessage maps the reservation to SIU message of the trigger event,
+// the segments are MSH, SCH, NTE, PID, RGS, AIS and AIL
+func newSIUMessage(header hl7.Header, trigger string, reservation Reservation, controlId string, now time.Time) string {
+	patient, ambulance := reservation.Patient, reservation.Ambulance
+	message := hl7.NewMessage(header, "SIU", trigger, "SIU_"+trigger, controlId, now)
+
+	fillerStatus, segmentAction := "Booked", "A"
+	eventReason := ""
+	switch trigger {
+	case hl7.TriggerRescheduled:
+		segmentAction, eventReason = "U", "Rescheduled"
+	case hl7.TriggerCancelled:
+		fillerStatus, segmentAction, eventReason = "Cancelled", "D", "Cancelled"
+	}
+
+	examination := hl7.Components(string(reservation.ExaminationType), examinationNames[reservation.ExaminationType], hl7IdentifierAuthority)
+	location := reservation.Ambulance.location()
+	start, end := reservation.Start.In(location), reservation.End.In(location)
+	duration := strconv.Itoa(int(end.Sub(start).Minutes()))
+
+	// SCH-1 placer appointment ID, SCH-6 event reason, SCH-7 appointment reason,
+	// SCH-9 and SCH-10 duration, SCH-11 timing, SCH-25 filler status
+	message.Add("SCH",
+		hl7.Components(reservation.Id, hl7IdentifierAuthority), "", "", "", "",
+		hl7.Components("", eventReason),
+		examination, "",
+		duration, "min",
+		hl7.Components("", "", "", hl7.Timestamp(start), hl7.Timestamp(end)),
+		"", "", "", "", "", "", "", "", "", "", "", "", "",
+		hl7.Components(fillerStatus),
+	)
+
+	if reservation.Message != "" {
+		message.Add("NTE", "1", "", hl7.Escape(reservation.Message))
+	}
+
+	// PID-3 identifier, PID-5 name, PID-7 birth date, PID-8 sex, PID-11
+	// address, PID-13 home phone and email, PID-15 primary language
+	telecom := []string{}
+	if patient.Phone != "" {
+		telecom = append(telecom, hl7.Components("", "PRN", "PH", "", "", "", "", "", "", "", "", patient.Phone))
+	}
+	if patient.Email != "" {
+		telecom = append(telecom, hl7.Components("", "NET", "Internet", patient.Email))
+	}
+	message.Add("PID",
+		"1", "",
+		hl7.Components(patient.Id, "", "", hl7IdentifierAuthority, "PI"), "",
+		hl7.Components(patient.LastName, patient.FirstName), "",
+		hl7.Date(patient.Birthday),
+		hl7Sexes[patient.Sex], "", "",
+		hl7.Components(patient.Address.Street, "", patient.Address.City, "", patient.Address.PostalCode, patient.Address.Country),
+		"",
+		strings.Join(telecom, "~"), "",
+		hl7.Escape(patient.PreferredLanguage),
+	)
+
+	message.Add("RGS", "1", segmentAction)
+
+	// AIS-3 universal service ID, AIS-4 start, AIS-7 and AIS-8 duration, AIS-10 filler status
+	message.Add("AIS", "1", segmentAction, examination, hl7.Timestamp(start), "", "", duration, "min", "", hl7.Components(fillerStatus))
+
+	// AIL-3 location with ambulance id as point of care and name as description,
+	// AIL-6 start, AIL-9 and AIL-10 duration, AIL-12 filler status
+	message.Add("AIL", "1", segmentAction,
+		hl7.Components(ambulance.Id, "", "", "", "", "", "", "", ambulance.Name), "", "",
+		hl7.Timestamp(start), "", "", duration, "min", "", hl7.Components(fillerStatus),
+	)
+	return message.Encode()
+}
+
+// hl7Outbox returns the outbox set in the context, export is disabled when
+// it returns nil
+func hl7Outbox(ctx *gin.Context) *Hl7Outbox {
+	value, exists := ctx.Get("hl7_outbox")
+	if !exists {
+		return nil
+	}
+	outbox, ok := value.(*Hl7Outbox)
+	if !ok {
+		log.Printf("hl7_outbox context is not of type *Hl7Outbox")
+	}
+	return outbox
+}
+
+// Export stores SIU message of the reservation event, nothing is exported
+// when the outbox is nil. Call it with the context of the transaction
+// changing the reservation, so the message is stored only with the change.
+func (this *Hl7Outbox) Export(txCtx context.Context, trigger string, reservation Reservation) error {
+	if this == nil {
+		return nil
+	}
+	if _, err := this.Enqueue(txCtx, trigger, reservation); err != nil {
+		return fmt.Errorf("failed to export %v of reservation %v: %w", trigger, reservation.Id, err)
+	}
+	return nil
+}
+
+// ExportDeleted exports the cancellation of the deleted reservations not
+// cancelled before, call it in the transaction deleting them
+func (this *Hl7Outbox) ExportDeleted(txCtx context.Context, reservations []Reservation) error {
+	for _, reservation := range reservations {
+		if reservation.Status == CANCELLED {
+			continue
+		}
+		if err := this.Export(txCtx, hl7.TriggerCancelled, reservation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package reservation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/hl7"
+)
+
+func newTestSIUReservation() Reservation {
+	start := time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC)
+	return Reservation{
+		Id: "reservation-1",
+		Patient: Patient{
+			Id:        "patient-1",
+			FirstName: "Jana",
+			LastName:  "Nováková",
+			Birthday:  "1990-02-03",
+			Sex:       FEMALE,
+			Email:     "jana@example.com",
+			Phone:     "+421900123456",
+			Address: PostalAddress{
+				Street:     "Ilkovičova 2",
+				City:       "Bratislava",
+				PostalCode: "84104",
+				Country:    "SK",
+			},
+			PreferredLanguage: "sk",
+		},
+		Ambulance: Ambulance{
+			Id:       "ambulance-1",
+			Name:     "Radiology",
+			TimeZone: "Europe/Bratislava",
+		},
+		Start:           start,
+		End:             start.Add(time.Hour),
+		ExaminationType: X_RAY,
+	}
+}
+
+// siuField is the expected encoded field of the segment
+type siuField struct {
+	segment string
+	field   int
+	want    string
+}
+
+func TestNewSIUMessageLayout(t *testing.T) {
+	header := hl7.Header{SendingApplication: "RESERVATION", SendingFacility: "WAC", ReceivingApplication: "RIS", ReceivingFacility: "HOSPITAL"}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		trigger string
+		// fields are the expected encoded fields
+		fields []siuField
+	}{
+		{
+			name:    "new appointment",
+			trigger: hl7.TriggerNewAppointment,
+			fields: []siuField{
+				{"MSH", 9, "SIU^S12^SIU_S12"},
+				{"MSH", 10, "CONTROL1"},
+				{"SCH", 1, "reservation-1^RESERVATION"},
+				{"SCH", 6, ""},
+				{"SCH", 7, "x_ray^X-ray^RESERVATION"},
+				{"SCH", 9, "60"},
+				{"SCH", 10, "min"},
+				{"SCH", 25, "Booked"},
+				{"PID", 3, "patient-1^^^RESERVATION^PI"},
+				{"PID", 5, "Nováková^Jana"},
+				{"PID", 7, "19900203"},
+				{"PID", 8, "F"},
+				{"PID", 11, "Ilkovičova 2^^Bratislava^^84104^SK"},
+				{"PID", 13, "^PRN^PH^^^^^^^^^+421900123456~^NET^Internet^jana@example.com"},
+				{"PID", 15, "sk"},
+				{"RGS", 2, "A"},
+				{"AIS", 2, "A"},
+				{"AIS", 3, "x_ray^X-ray^RESERVATION"},
+				{"AIS", 7, "60"},
+				{"AIS", 10, "Booked"},
+				{"AIL", 2, "A"},
+				{"AIL", 3, "ambulance-1^^^^^^^^Radiology"},
+				{"AIL", 9, "60"},
+				{"AIL", 12, "Booked"},
+			},
+		},
+		{
+			name:    "rescheduled",
+			trigger: hl7.TriggerRescheduled,
+			fields: []siuField{
+				{"MSH", 9, "SIU^S13^SIU_S13"},
+				{"SCH", 6, "^Rescheduled"},
+				{"SCH", 25, "Booked"},
+				{"RGS", 2, "U"},
+				{"AIS", 2, "U"},
+				{"AIL", 2, "U"},
+			},
+		},
+		{
+			name:    "cancelled",
+			trigger: hl7.TriggerCancelled,
+			fields: []siuField{
+				{"MSH", 9, "SIU^S15^SIU_S15"},
+				{"SCH", 6, "^Cancelled"},
+				{"SCH", 25, "Cancelled"},
+				{"RGS", 2, "D"},
+				{"AIS", 2, "D"},
+				{"AIS", 10, "Cancelled"},
+				{"AIL", 2, "D"},
+				{"AIL", 12, "Cancelled"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message, err := hl7.Parse(newSIUMessage(header, test.trigger, newTestSIUReservation(), "CONTROL1", now))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			for _, field := range test.fields {
+				if got := message.Field(field.segment, field.field); got != field.want {
+					t.Errorf("%v-%v = %q, want %q", field.segment, field.field, got, field.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewSIUMessageEscaping(t *testing.T) {
+	reservation := newTestSIUReservation()
+	reservation.Message = "fasting | no ^ jewellery & water ~ \\ done\nthanks"
+	reservation.Patient.LastName = "O^Brien|Smith"
+	reservation.Ambulance.Name = "X-ray & CT"
+	reservation.Patient.Address.Street = "Main ~ 1"
+
+	message, err := hl7.Parse(newSIUMessage(hl7.Header{}, hl7.TriggerNewAppointment, reservation, "CONTROL2", time.Now()))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := len(message.Segments); got != 7 {
+		t.Fatalf("message has %v segments, want MSH, SCH, NTE, PID, RGS, AIS and AIL", got)
+	}
+
+	tests := []struct {
+		name  string
+		field string
+		want  string
+	}{
+		{name: "note", field: message.Field("NTE", 3), want: reservation.Message},
+		{name: "family name", field: hl7.Component(message.Field("PID", 5), 1), want: "O^Brien|Smith"},
+		{name: "given name", field: hl7.Component(message.Field("PID", 5), 2), want: "Jana"},
+		{name: "street", field: hl7.Component(message.Field("PID", 11), 1), want: "Main ~ 1"},
+		{name: "ambulance name", field: hl7.Component(message.Field("AIL", 3), 9), want: "X-ray & CT"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := hl7.Unescape(test.field); got != test.want {
+				t.Errorf("%v = %q, want %q", test.name, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewSIUMessageTimeZone(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeZone string
+		start    time.Time
+		want     string
+		wantEnd  string
+	}{
+		{
+			name:     "summer time of the ambulance",
+			timeZone: "Europe/Bratislava",
+			start:    time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC),
+			want:     "20240506100000+0200",
+			wantEnd:  "20240506110000+0200",
+		},
+		{
+			name:     "winter time of the ambulance",
+			timeZone: "Europe/Bratislava",
+			start:    time.Date(2024, 12, 2, 8, 0, 0, 0, time.UTC),
+			want:     "20241202090000+0100",
+			wantEnd:  "20241202100000+0100",
+		},
+		{
+			name:     "ambulance without time zone",
+			timeZone: "",
+			start:    time.Date(2024, 5, 6, 8, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+			want:     "20240506060000+0000",
+			wantEnd:  "20240506070000+0000",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reservation := newTestSIUReservation()
+			reservation.Ambulance.TimeZone = test.timeZone
+			reservation.Start, reservation.End = test.start, test.start.Add(time.Hour)
+
+			message, err := hl7.Parse(newSIUMessage(hl7.Header{}, hl7.TriggerNewAppointment, reservation, "CONTROL3", time.Now()))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			timing := message.Field("SCH", 11)
+			for name, got := range map[string]string{
+				"SCH-11.4": hl7.Component(timing, 4),
+				"AIS-4":    message.Field("AIS", 4),
+				"AIL-6":    message.Field("AIL", 6),
+			} {
+				if got != test.want {
+					t.Errorf("%v = %q, want %q", name, got, test.want)
+				}
+			}
+			if got := hl7.Component(timing, 5); got != test.wantEnd {
+				t.Errorf("SCH-11.5 = %q, want %q", got, test.wantEnd)
+			}
+		})
+	}
+}
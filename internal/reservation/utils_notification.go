@@ -0,0 +1,75 @@
+package reservation
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/notification"
+)
+
+// Reservation events the patients are notified about
+const (
+	EventReservationCreated   = "reservation.created"
+	EventReservationUpdated   = "reservation.updated"
+	EventReservationDeleted   = "reservation.deleted"
+	EventReservationReminder  = "reservation.reminder"
+	EventReservationCancelled = "reservation.cancelled"
+	EventWaitlistOffered      = "waitlist.offered"
+)
+
+const notificationTimeout = 30 * time.Second
+
+// notifyReservation notifies the patient about the reservation event in the
+// background, so slow or failing channels do not delay the response.
+// Notifications are disabled when no notifier is set in the context.
+func notifyReservation(ctx *gin.Context, event string, reservation Reservation) {
+	value, exists := ctx.Get("notifier")
+	if !exists {
+		return
+	}
+
+	notifier, ok := value.(notification.Notifier)
+	if !ok {
+		log.Printf("notifier context is not of type notification.Notifier")
+		return
+	}
+
+	go func() {
+		notifyCtx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+		defer cancel()
+		if err := sendReservationNotification(notifyCtx, notifier, event, reservation); err != nil {
+			log.Printf("Failed to notify about %v of reservation %v: %v", event, reservation.Id, err)
+		}
+	}()
+}
+
+// sendReservationNotification renders the event message in the patient's
+// preferred language and delivers it to the patient
+func sendReservationNotification(ctx context.Context, notifier notification.Notifier, event string, reservation Reservation) error {
+	return sendPatientNotification(ctx, notifier, event, reservation.Patient, reservation)
+}
+
+// sendPatientNotification renders the event template with the data and delivers it to the patient
+func sendPatientNotification(ctx context.Context, notifier notification.Notifier, event string, patient Patient, data interface{}) error {
+	message, err := patientMessage(event, patient, data)
+	if err != nil {
+		return err
+	}
+	return notifier.Notify(ctx, message)
+}
+
+// patientMessage renders the event template with the data for the patient
+func patientMessage(event string, patient Patient, data interface{}) (notification.Message, error) {
+	message, err := notification.Render(event, patient.PreferredLanguage, data)
+	if err != nil {
+		return message, err
+	}
+	message.Recipient = notification.Recipient{
+		Name:  patient.FirstName + " " + patient.LastName,
+		Email: patient.Email,
+		Phone: patient.Phone,
+	}
+	return message, nil
+}
@@ -20,4 +20,20 @@ func (o *OfficeHours) IsValid() bool {
 	}
 
 	return true
-}
\ No newline at end of file
+}
+
+// IsOpenAt checks if the wall-clock time of t falls into the office hours
+func (o *OfficeHours) IsOpenAt(t time.Time) bool {
+	openTime, err := time.Parse("15:04", o.Open)
+	if err != nil {
+		return false
+	}
+
+	closeTime, err := time.Parse("15:04", o.Close)
+	if err != nil {
+		return false
+	}
+
+	clock, _ := time.Parse("15:04", t.Format("15:04"))
+	return !clock.Before(openTime) && clock.Before(closeTime)
+}
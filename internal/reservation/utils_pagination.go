@@ -0,0 +1,42 @@
+package reservation
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// parsePagination reads the page and pageSize query parameters and returns skip and limit for the query
+func parsePagination(ctx *gin.Context) (skip int64, limit int64, err error) {
+	page, err := strconv.ParseInt(ctx.DefaultQuery("page", "1"), 10, 64)
+	if err != nil || page < 1 {
+		return 0, 0, fmt.Errorf("page must be a positive integer")
+	}
+
+	pageSize, err := strconv.ParseInt(ctx.DefaultQuery("pageSize", strconv.Itoa(defaultPageSize)), 10, 64)
+	if err != nil || pageSize < 1 || pageSize > maxPageSize {
+		return 0, 0, fmt.Errorf("pageSize must be an integer between 1 and %v", maxPageSize)
+	}
+
+	return (page - 1) * pageSize, pageSize, nil
+}
+
+// setTotalCount reports the total number of items matching the request
+func setTotalCount(ctx *gin.Context, total int64) {
+	ctx.Header("X-Total-Count", strconv.FormatInt(total, 10))
+}
+
+// pageOf returns the page of items selected by skip and limit
+func pageOf[T any](items []T, skip int64, limit int64) []T {
+	if skip >= int64(len(items)) {
+		return []T{}
+	}
+	end := min(skip+limit, int64(len(items)))
+	return items[skip:end]
+}
@@ -3,10 +3,18 @@ package reservation
 import (
 	"fmt"
 	"net/http"
+	"net/mail"
+	"regexp"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
 )
 
 type patientUpdater = func(
@@ -139,6 +147,11 @@ func (patient *Patient) Validate() error {
         return fmt.Errorf("Bio exceeds maximum length of 200 characters")
     }
 
+    err := validateContactDetails(patient.Email, patient.Phone, patient.PreferredLanguage, &patient.Address, &patient.EmergencyContact)
+    if err != nil {
+        return err
+    }
+
     birthday, err := time.Parse("2006-01-02", patient.Birthday)
     if err != nil {
         return fmt.Errorf("Failed to parse birthday: %v", err)
@@ -175,6 +188,11 @@ func (patient *PatientInput) Validate() error {
     if len(patient.Bio) > 200 {
         return fmt.Errorf("Bio exceeds maximum length of 200 characters")
     }
+
+    err := validateContactDetails(patient.Email, patient.Phone, patient.PreferredLanguage, &patient.Address, &patient.EmergencyContact)
+    if err != nil {
+        return err
+    }
     
     birthday, err := time.Parse("2006-01-02", patient.Birthday)
     if err != nil {
@@ -186,4 +204,172 @@ func (patient *PatientInput) Validate() error {
     }
     
     return nil
-}
\ No newline at end of file
+}
+
+var (
+    phonePattern    = regexp.MustCompile(`^\+?[0-9]{6,15}$`)
+    languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+    countryPattern  = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// validatePhone accepts phone numbers with optional leading + and 6 to 15 digits,
+// spaces and dashes between the digits are ignored
+func validatePhone(phone string) error {
+    digits := strings.NewReplacer(" ", "", "-", "").Replace(phone)
+    if !phonePattern.MatchString(digits) {
+        return fmt.Errorf("Invalid phone number %q, use international format e.g. +421 900 123 456", phone)
+    }
+    return nil
+}
+
+// validateContactDetails checks the optional contact fields of the patient
+func validateContactDetails(email string, phone string, preferredLanguage string, address *PostalAddress, emergencyContact *EmergencyContact) error {
+    if email != "" {
+        parsed, err := mail.ParseAddress(email)
+        if err != nil || parsed.Address != email {
+            return fmt.Errorf("Invalid email address %q", email)
+        }
+    }
+
+    if phone != "" {
+        if err := validatePhone(phone); err != nil {
+            return err
+        }
+    }
+
+    if preferredLanguage != "" && !languagePattern.MatchString(preferredLanguage) {
+        return fmt.Errorf("Invalid preferred language %q, use BCP 47 language tag e.g. sk or en-GB", preferredLanguage)
+    }
+
+    if len(address.Street) > 100 {
+        return fmt.Errorf("Street exceeds maximum length of 100 characters")
+    }
+
+    if len(address.City) > 50 {
+        return fmt.Errorf("City exceeds maximum length of 50 characters")
+    }
+
+    if len(address.PostalCode) > 10 {
+        return fmt.Errorf("Postal code exceeds maximum length of 10 characters")
+    }
+
+    if address.Country != "" && !countryPattern.MatchString(address.Country) {
+        return fmt.Errorf("Invalid country %q, use ISO 3166-1 alpha-2 code e.g. SK", address.Country)
+    }
+
+    if *emergencyContact != (EmergencyContact{}) {
+        if len(emergencyContact.Name) == 0 {
+            return fmt.Errorf("Emergency contact name is required")
+        }
+
+        if len(emergencyContact.Name) > 50 {
+            return fmt.Errorf("Emergency contact name exceeds maximum length of 50 characters")
+        }
+
+        if len(emergencyContact.Relationship) > 30 {
+            return fmt.Errorf("Emergency contact relationship exceeds maximum length of 30 characters")
+        }
+
+        if err := validatePhone(emergencyContact.Phone); err != nil {
+            return fmt.Errorf("Emergency contact: %v", err)
+        }
+    }
+
+    return nil
+}
+
+var diacriticsRemover = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// normalizeName lower-cases the name and strips diacritics, e.g. "Ľubomír" -> "lubomir"
+func normalizeName(name string) string {
+    normalized, _, err := transform.String(diacriticsRemover, name)
+    if err != nil {
+        normalized = name
+    }
+    return strings.ToLower(strings.TrimSpace(normalized))
+}
+
+// nameTokens splits search term into normalized words
+func nameTokens(term string) []string {
+    return strings.Fields(normalizeName(term))
+}
+
+// levenshteinDistance counts single character edits needed to change a to b
+func levenshteinDistance(a string, b string) int {
+    source, target := []rune(a), []rune(b)
+    previous := make([]int, len(target)+1)
+    current := make([]int, len(target)+1)
+    for j := range previous {
+        previous[j] = j
+    }
+    for i := 1; i <= len(source); i++ {
+        current[0] = i
+        for j := 1; j <= len(target); j++ {
+            cost := 1
+            if source[i-1] == target[j-1] {
+                cost = 0
+            }
+            current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+        }
+        previous, current = current, previous
+    }
+    return previous[len(target)]
+}
+
+// fuzzyTolerance is the number of typos tolerated in the search token
+func fuzzyTolerance(token string) int {
+    if utf8.RuneCountInString(token) <= 4 {
+        return 1
+    }
+    return 2
+}
+
+// fuzzyNameScore returns sum of edit distances of the search tokens to the closest
+// first or last name word of the patient, ok is false if any token is too distant
+func fuzzyNameScore(patient *Patient, tokens []string) (score int, ok bool) {
+    words := append(nameTokens(patient.FirstName), nameTokens(patient.LastName)...)
+    for _, token := range tokens {
+        best := -1
+        for _, word := range words {
+            distance := levenshteinDistance(token, word)
+            // prefix of a longer name is a match as well
+            if prefix := []rune(word); len(prefix) > len([]rune(token)) {
+                distance = min(distance, levenshteinDistance(token, string(prefix[:len([]rune(token))])) + 1)
+            }
+            if best < 0 || distance < best {
+                best = distance
+            }
+        }
+        if best < 0 || best > fuzzyTolerance(token) {
+            return 0, false
+        }
+        score += best
+    }
+    return score, true
+}
+
+// namePrefixFilter matches patients whose first or last name starts with the prefix,
+// it must be used with the patientNameCollation
+func namePrefixFilter(prefix string) db_service.Filter {
+    // U+FFFF has the highest primary weight in the collation, so it bounds all names with the prefix
+    upperBound := prefix + "\uffff"
+    return db_service.Or(
+        db_service.And(db_service.Gte("lastname", prefix), db_service.Lt("lastname", upperBound)),
+        db_service.And(db_service.Gte("firstname", prefix), db_service.Lt("firstname", upperBound)),
+    )
+}
+
+// collation of the patient name indexes, case and diacritics insensitive
+const (
+    patientNameCollationLocale   = "sk"
+    patientNameCollationStrength = 1
+)
+
+// firstLetter returns the first letter of the token, "ch" is a single letter in Slovak collation
+func firstLetter(token string) string {
+    if strings.HasPrefix(token, "ch") {
+        return "ch"
+    }
+    letter, _ := utf8.DecodeRuneInString(token)
+    return string(letter)
+}
@@ -0,0 +1,288 @@
+package reservation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+)
+
+// Formats of the patient import
+const (
+	PatientImportCSV       = "csv"
+	PatientImportJSONLines = "jsonl"
+)
+
+const (
+	maxPatientImportRows    = 5000
+	maxPatientImportLineLen = 64 * 1024
+)
+
+// errInvalidPatientImport wraps errors of malformed import files
+var errInvalidPatientImport = fmt.Errorf("invalid import file")
+
+// errPatientImportTooLarge is returned when the file has more than maxPatientImportRows rows
+var errPatientImportTooLarge = fmt.Errorf("import is limited to %v rows", maxPatientImportRows)
+
+// patientImportColumns maps the CSV header names to the PatientInput fields
+var patientImportColumns = map[string]func(patient *PatientInput, value string){
+	"firstname":                    func(patient *PatientInput, value string) { patient.FirstName = value },
+	"lastname":                     func(patient *PatientInput, value string) { patient.LastName = value },
+	"birthday":                     func(patient *PatientInput, value string) { patient.Birthday = value },
+	"sex":                          func(patient *PatientInput, value string) { patient.Sex = Sex(strings.ToLower(value)) },
+	"bio":                          func(patient *PatientInput, value string) { patient.Bio = value },
+	"email":                        func(patient *PatientInput, value string) { patient.Email = value },
+	"phone":                        func(patient *PatientInput, value string) { patient.Phone = value },
+	"street":                       func(patient *PatientInput, value string) { patient.Address.Street = value },
+	"city":                         func(patient *PatientInput, value string) { patient.Address.City = value },
+	"postalcode":                   func(patient *PatientInput, value string) { patient.Address.PostalCode = value },
+	"country":                      func(patient *PatientInput, value string) { patient.Address.Country = value },
+	"preferredlanguage":            func(patient *PatientInput, value string) { patient.PreferredLanguage = value },
+	"emergencycontactname":         func(patient *PatientInput, value string) { patient.EmergencyContact.Name = value },
+	"emergencycontactrelationship": func(patient *PatientInput, value string) { patient.EmergencyContact.Relationship = value },
+	"emergencycontactphone":        func(patient *PatientInput, value string) { patient.EmergencyContact.Phone = value },
+}
+
+var requiredPatientImportColumns = []string{"firstname", "lastname", "birthday", "sex"}
+
+// patientImportRow is a row read from the imported file, err is set when the
+// row could not be decoded
+type patientImportRow struct {
+	line    int32
+	patient PatientInput
+	err     error
+}
+
+// PatientImporter creates patients from CSV or JSON Lines files
+type PatientImporter struct {
+	PatientDB db_service.DbService[Patient]
+}
+
+// PatientImportFormat returns the import format of the content type or file
+// extension, e.g. text/csv or .jsonl, ok is false for unsupported formats
+func PatientImportFormat(contentTypeOrExtension string) (format string, ok bool) {
+	value := strings.ToLower(strings.TrimSpace(strings.Split(contentTypeOrExtension, ";")[0]))
+	switch value {
+	case "text/csv", ".csv", "csv":
+		return PatientImportCSV, true
+	case "application/x-ndjson", "application/jsonl", "application/json-lines", ".jsonl", ".ndjson", "jsonl", "ndjson":
+		return PatientImportJSONLines, true
+	}
+	return "", false
+}
+
+// Import validates the rows, skips duplicates of existing patients and of
+// earlier rows and creates the remaining patients unless dryRun is set.
+// Invalid rows are reported in the result, error is returned only for a
+// malformed file or a failing database.
+func (this *PatientImporter) Import(ctx context.Context, reader io.Reader, format string, dryRun bool) (*PatientImportReport, error) {
+	var rows []patientImportRow
+	var err error
+	switch format {
+	case PatientImportCSV:
+		rows, err = readPatientImportCSV(reader)
+	case PatientImportJSONLines:
+		rows, err = readPatientImportJSONLines(reader)
+	default:
+		err = fmt.Errorf("unsupported import format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPatientImport, err)
+	}
+
+	existing, err := this.existingPatients(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PatientImportReport{
+		DryRun: dryRun,
+		Total:  int32(len(rows)),
+		Rows:   make([]PatientImportRow, 0, len(rows)),
+	}
+	for _, row := range rows {
+		result := PatientImportRow{Line: row.line}
+		if row.err == nil {
+			row.err = row.patient.Validate()
+		}
+		if row.err != nil {
+			result.Status = INVALID
+			result.Error = row.err.Error()
+			report.Invalid++
+			report.Rows = append(report.Rows, result)
+			continue
+		}
+
+		key := patientDuplicateKey(row.patient.FirstName, row.patient.LastName, row.patient.Birthday)
+		if patientId, duplicate := existing[key]; duplicate {
+			result.Status = DUPLICATE
+			result.PatientId = patientId
+			report.Duplicates++
+			report.Rows = append(report.Rows, result)
+			continue
+		}
+
+		patient := newPatient(uuid.New().String(), row.patient)
+		if dryRun {
+			result.Status = VALID
+		} else {
+			if err := this.PatientDB.CreateDocument(ctx, patient.Id, &patient); err != nil {
+				return nil, fmt.Errorf("failed to create patient of line %v: %w", row.line, err)
+			}
+			result.Status = IMPORTED
+			result.PatientId = patient.Id
+		}
+		existing[key] = patient.Id
+		report.Imported++
+		report.Rows = append(report.Rows, result)
+	}
+	return report, nil
+}
+
+// existingPatients returns ids of the stored patients with the birthdays of
+// the rows, keyed by patientDuplicateKey
+func (this *PatientImporter) existingPatients(ctx context.Context, rows []patientImportRow) (map[string]string, error) {
+	birthdays := []string{}
+	seen := map[string]bool{}
+	for _, row := range rows {
+		if row.err == nil && !seen[row.patient.Birthday] {
+			seen[row.patient.Birthday] = true
+			birthdays = append(birthdays, row.patient.Birthday)
+		}
+	}
+
+	existing := map[string]string{}
+	if len(birthdays) == 0 {
+		return existing, nil
+	}
+	patients, err := this.PatientDB.FindDocuments(ctx, db_service.NewQuery(db_service.In("birthday", birthdays)))
+	if err != nil {
+		return nil, err
+	}
+	for _, patient := range patients {
+		existing[patientDuplicateKey(patient.FirstName, patient.LastName, patient.Birthday)] = patient.Id
+	}
+	return existing, nil
+}
+
+// patientDuplicateKey identifies the patient by name and birthday, names are
+// compared case and diacritics insensitive
+func patientDuplicateKey(firstName string, lastName string, birthday string) string {
+	return strings.Join([]string{normalizeName(firstName), normalizeName(lastName), birthday}, "|")
+}
+
+// newPatient creates patient with the id from the input
+func newPatient(id string, input PatientInput) Patient {
+	return Patient{
+		Id:                id,
+		FirstName:         input.FirstName,
+		LastName:          input.LastName,
+		Birthday:          input.Birthday,
+		Sex:               input.Sex,
+		Bio:               input.Bio,
+		Email:             input.Email,
+		Phone:             input.Phone,
+		Address:           input.Address,
+		PreferredLanguage: input.PreferredLanguage,
+		EmergencyContact:  input.EmergencyContact,
+	}
+}
+
+// readPatientImportCSV reads the rows of CSV file with header, line numbers
+// count the header as line 1
+func readPatientImportCSV(reader io.Reader) ([]patientImportRow, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("CSV header is missing")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	setters := make([]func(patient *PatientInput, value string), len(header))
+	present := map[string]bool{}
+	for i, name := range header {
+		column := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		setter, ok := patientImportColumns[column]
+		if !ok {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		if present[column] {
+			return nil, fmt.Errorf("duplicate CSV column %q", name)
+		}
+		present[column] = true
+		setters[i] = setter
+	}
+	for _, column := range requiredPatientImportColumns {
+		if !present[column] {
+			return nil, fmt.Errorf("required CSV column %q is missing", column)
+		}
+	}
+
+	rows := []patientImportRow{}
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		if len(rows) == maxPatientImportRows {
+			return nil, errPatientImportTooLarge
+		}
+
+		line, _ := csvReader.FieldPos(0)
+		row := patientImportRow{line: int32(line)}
+		if len(record) != len(header) {
+			row.err = fmt.Errorf("Row has %v fields, header has %v", len(record), len(header))
+		} else {
+			for i, value := range record {
+				setters[i](&row.patient, strings.TrimSpace(value))
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// readPatientImportJSONLines reads one PatientInput object per line, empty lines are skipped
+func readPatientImportJSONLines(reader io.Reader) ([]patientImportRow, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 4096), maxPatientImportLineLen)
+
+	rows := []patientImportRow{}
+	line := int32(0)
+	for scanner.Scan() {
+		line++
+		content := bytes.TrimSpace(scanner.Bytes())
+		if len(content) == 0 {
+			continue
+		}
+		if len(rows) == maxPatientImportRows {
+			return nil, errPatientImportTooLarge
+		}
+
+		row := patientImportRow{line: line}
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&row.patient); err != nil {
+			row.err = fmt.Errorf("Invalid JSON: %v", err)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read JSON Lines: %w", err)
+	}
+	return rows, nil
+}
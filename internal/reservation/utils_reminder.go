@@ -0,0 +1,211 @@
+package reservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/notification"
+)
+
+// ReminderRecord claims a reminder of the reservation. The record is created
+// before the reminder is sent, the unique id makes sure only one replica sends it.
+// It records the channels the reminder was delivered through, the failed ones
+// are retried by the next scans once the claim expires.
+type ReminderRecord struct {
+	// Id is "{reservationId}:{start}:{offset}", rescheduled reservations get
+	// the reminders of the new start
+	Id            string    `json:"id"`
+	ReservationId string    `json:"reservationId"`
+	Start         time.Time `json:"start"`
+	Offset        string    `json:"offset"`
+	// SentAt is the time of the first attempt
+	SentAt time.Time `json:"sentAt"`
+	// Delivered are the names of the channels the reminder was delivered through
+	Delivered []string `json:"delivered"`
+	// ClaimedUntil is set while a replica is sending the reminder
+	ClaimedUntil time.Time `json:"claimedUntil"`
+}
+
+// reminderClaimTimeout is how long a replica may take to send a reminder
+// before other replicas retry its undelivered channels
+const reminderClaimTimeout = 5 * time.Minute
+
+// ReminderScheduler periodically sends reminders of the upcoming reservations
+type ReminderScheduler struct {
+	ReservationDB db_service.DbService[ReservationInput]
+	PatientDB     db_service.DbService[Patient]
+	AmbulanceDB   db_service.DbService[Ambulance]
+	ReminderDB    db_service.DbService[ReminderRecord]
+	Notifier      notification.Notifier
+	// Offsets before the reservation start when the reminders are sent
+	Offsets []time.Duration
+	// Interval between scans of the upcoming reservations
+	Interval time.Duration
+}
+
+// ParseReminderOffsets parses comma separated list of durations, e.g. "24h,2h"
+func ParseReminderOffsets(value string) ([]time.Duration, error) {
+	offsets := []time.Duration{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		offset, err := time.ParseDuration(item)
+		if err != nil {
+			return nil, err
+		}
+		if offset <= 0 {
+			return nil, fmt.Errorf("reminder offset must be positive: %v", item)
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets, nil
+}
+
+// Run scans the reservations every Interval until the context is cancelled
+func (this *ReminderScheduler) Run(ctx context.Context) {
+	if len(this.Offsets) == 0 {
+		log.Printf("Reminders are disabled")
+		return
+	}
+	log.Printf("Reminder scheduler started with offsets %v", this.Offsets)
+
+	ticker := time.NewTicker(this.Interval)
+	defer ticker.Stop()
+	for {
+		if err := this.SendDueReminders(ctx, time.Now()); err != nil {
+			log.Printf("Failed to send reminders: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDueReminders sends reminders of the reservations starting after now.
+// Only the reminder with the smallest due offset is sent, so reservation
+// created shortly before its start gets a single reminder and reminders
+// missed during downtime are not sent all at once.
+func (this *ReminderScheduler) SendDueReminders(ctx context.Context, now time.Time) error {
+	offsets := append([]time.Duration{}, this.Offsets...)
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	reservationInputs, err := this.ReservationDB.FindDocuments(ctx, db_service.NewQuery(db_service.And(
+		db_service.Gt("start", now),
+		db_service.Lte("start", now.Add(offsets[len(offsets)-1])),
+		activeReservationFilter(),
+	)).SortBy("start", false))
+	if err != nil {
+		return err
+	}
+
+	for _, reservationInput := range reservationInputs {
+		remaining := reservationInput.Start.Sub(now)
+		for _, offset := range offsets {
+			if remaining > offset {
+				continue
+			}
+			if err := this.sendReminder(ctx, reservationInput, offset); err != nil {
+				log.Printf("Failed to send %v reminder of reservation %v: %v", offset, reservationInput.Id, err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func (this *ReminderScheduler) sendReminder(ctx context.Context, reservationInput ReservationInput, offset time.Duration) error {
+	channels := notification.Channels(this.Notifier)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	record, claimed, err := this.claimReminder(ctx, reservationInput, offset, channels, now)
+	if err != nil || !claimed {
+		return err
+	}
+
+	reservations, err := expandReservations(ctx, this.PatientDB, this.AmbulanceDB, []ReservationInput{reservationInput})
+	var message notification.Message
+	if err == nil {
+		message, err = patientMessage(EventReservationReminder, reservations[0].Patient, reservations[0])
+	}
+	if err == nil {
+		var errs []error
+		for _, channel := range channels {
+			if slices.Contains(record.Delivered, channel.Name) {
+				continue
+			}
+			if channelErr := channel.Notify(ctx, message); channelErr != nil {
+				errs = append(errs, fmt.Errorf("%v: %w", channel.Name, channelErr))
+				continue
+			}
+			record.Delivered = append(record.Delivered, channel.Name)
+		}
+		err = errors.Join(errs...)
+	}
+
+	// release the claim, so the failed channels are retried by the next scan
+	record.ClaimedUntil = time.Time{}
+	if updateErr := this.ReminderDB.UpdateDocument(ctx, record.Id, record); updateErr != nil {
+		log.Printf("Failed to record reminder %v: %v", record.Id, updateErr)
+	}
+	return err
+}
+
+// claimReminder creates the record of the reminder or takes over the record
+// with undelivered channels whose claim expired. It reports false when the
+// reminder was delivered or is being sent by another replica.
+func (this *ReminderScheduler) claimReminder(
+	ctx context.Context,
+	reservationInput ReservationInput,
+	offset time.Duration,
+	channels []notification.Channel,
+	now time.Time,
+) (*ReminderRecord, bool, error) {
+	record := &ReminderRecord{
+		Id:            fmt.Sprintf("%v:%v:%v", reservationInput.Id, reservationInput.Start.UTC().Format(time.RFC3339), offset),
+		ReservationId: reservationInput.Id,
+		Start:         reservationInput.Start,
+		Offset:        offset.String(),
+		SentAt:        now,
+		Delivered:     []string{},
+		ClaimedUntil:  now.Add(reminderClaimTimeout),
+	}
+	switch err := this.ReminderDB.CreateDocument(ctx, record.Id, record); err {
+	case nil:
+		return record, true, nil
+	case db_service.ErrConflict:
+	default:
+		return nil, false, err
+	}
+
+	existing, err := this.ReminderDB.FindDocument(ctx, record.Id)
+	if err != nil {
+		return nil, false, err
+	}
+	delivered := !slices.ContainsFunc(channels, func(channel notification.Channel) bool {
+		return !slices.Contains(existing.Delivered, channel.Name)
+	})
+	if delivered || existing.ClaimedUntil.After(now) {
+		return nil, false, nil
+	}
+
+	claimedUntil := existing.ClaimedUntil
+	existing.ClaimedUntil = record.ClaimedUntil
+	switch err := this.ReminderDB.UpdateDocumentIf(ctx, existing.Id, db_service.Eq("claimeduntil", claimedUntil), existing); err {
+	case nil:
+		return existing, true, nil
+	case db_service.ErrNotFound:
+		return nil, false, nil // claimed by another replica
+	default:
+		return nil, false, err
+	}
+}
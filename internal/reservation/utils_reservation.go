@@ -1,14 +1,265 @@
 package reservation
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/hl7"
 )
 
+var errReservationOverlap = fmt.Errorf("reservation overlaps with another reservation of the ambulance")
+
+// checkReservationOverlap assigns the reservation to a free resource of the
+// ambulance running its examination and to a free qualified staff member. It
+// returns errReservationOverlap if the reservations and pending waitlist offers
+// in its time range take all the resources, and errNoStaffAvailable if no
+// staff member is free. Call it in a transaction after locking the ambulance,
+// so concurrent bookings cannot slip in between.
+func checkReservationOverlap(
+	ctx context.Context,
+	db db_service.DbService[ReservationInput],
+	staffDB db_service.DbService[Staff],
+	waitlistDB db_service.DbService[WaitlistEntry],
+	ambulance *Ambulance,
+	reservationInput *ReservationInput,
+) error {
+	overlapping, err := db.FindDocuments(ctx, db_service.NewQuery(db_service.And(
+		db_service.Eq("ambulanceid", reservationInput.AmbulanceId),
+		db_service.Ne("id", reservationInput.Id),
+		db_service.Lt("start", reservationInput.End),
+		db_service.Gt("end", reservationInput.Start),
+		activeReservationFilter(),
+	)).Project("id", "resourceid", "examinationtype", "start", "end"))
+	if err != nil {
+		return err
+	}
+	held, err := offerHolds(ctx, waitlistDB, db_service.And(
+		db_service.Eq("offer.ambulanceid", reservationInput.AmbulanceId),
+		db_service.Lt("offer.start", reservationInput.End),
+		db_service.Gt("offer.end", reservationInput.Start),
+	), reservationInput.Id)
+	if err != nil {
+		return err
+	}
+	overlapping = append(overlapping, held...)
+
+	if err := assignReservationResource(ambulance, reservationInput, overlapping); err != nil {
+		return err
+	}
+	return assignReservationStaff(ctx, staffDB, db, waitlistDB, ambulance, reservationInput)
+}
+
+// activeReservationFilter matches reservations occupying their time slot,
+// reservations stored before cancellation was introduced have no status
+func activeReservationFilter() db_service.Filter {
+	return db_service.Ne("status", CANCELLED)
+}
+
+// createReservation books the validated reservation and announces it, the
+// SIU message is stored in the same transaction. It returns the reservation
+// as stored, with the resource, staff member and sequence assigned while
+// booking.
+func createReservation(
+	ctx *gin.Context,
+	transactor db_service.Transactor,
+	db db_service.DbService[ReservationInput],
+	patientDB db_service.DbService[Patient],
+	ambulanceDB db_service.DbService[Ambulance],
+	staffDB db_service.DbService[Staff],
+	waitlistDB db_service.DbService[WaitlistEntry],
+	reservationInput *ReservationInput,
+) (*Reservation, error) {
+	outbox := hl7Outbox(ctx)
+	var reservation Reservation
+	err := transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		if err := insertReservation(txCtx, db, ambulanceDB, staffDB, waitlistDB, reservationInput); err != nil {
+			return err
+		}
+		reservations, err := expandReservations(txCtx, patientDB, ambulanceDB, []ReservationInput{*reservationInput})
+		if err != nil {
+			return err
+		}
+		reservation = reservations[0]
+		return outbox.Export(txCtx, hl7.TriggerNewAppointment, reservation)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notifyReservation(ctx, EventReservationCreated, reservation)
+	publishWebhook(ctx, RESERVATION_CREATED, reservation)
+	return &reservation, nil
+}
+
+// insertReservation stores the new reservation unless its time slot is
+// taken, call it in a transaction
+func insertReservation(
+	txCtx context.Context,
+	db db_service.DbService[ReservationInput],
+	ambulanceDB db_service.DbService[Ambulance],
+	staffDB db_service.DbService[Staff],
+	waitlistDB db_service.DbService[WaitlistEntry],
+	reservationInput *ReservationInput,
+) error {
+	reservationInput.Status = SCHEDULED
+	reservationInput.Sequence = 0
+	reservationInput.UpdatedAt = time.Now().UTC()
+	// lock the ambulance so the overlap check and insert are atomic
+	if err := ambulanceDB.LockDocument(txCtx, reservationInput.AmbulanceId); err != nil {
+		return err
+	}
+	ambulance, err := ambulanceDB.FindDocument(txCtx, reservationInput.AmbulanceId)
+	if err != nil {
+		return err
+	}
+	if err := checkReservationOverlap(txCtx, db, staffDB, waitlistDB, ambulance, reservationInput); err != nil {
+		return err
+	}
+	if err := lockReservationStaff(txCtx, staffDB, reservationInput); err != nil {
+		return err
+	}
+	return db.CreateDocument(txCtx, reservationInput.Id, reservationInput)
+}
+
+// expandReservations fills patient and ambulance data into the reservations,
+// the referenced documents are loaded with one query per collection
+func expandReservations(
+	ctx context.Context,
+	patientDB db_service.DbService[Patient],
+	ambulanceDB db_service.DbService[Ambulance],
+	reservationInputs []ReservationInput,
+) ([]Reservation, error) {
+	if len(reservationInputs) == 0 {
+		return []Reservation{}, nil
+	}
+
+	patientIds := make([]string, 0, len(reservationInputs))
+	ambulanceIds := make([]string, 0, len(reservationInputs))
+	for _, input := range reservationInputs {
+		patientIds = append(patientIds, input.PatientId)
+		ambulanceIds = append(ambulanceIds, input.AmbulanceId)
+	}
+
+	patients, err := patientDB.FindDocuments(ctx, db_service.NewQuery(db_service.In("id", patientIds)))
+	if err != nil {
+		return nil, err
+	}
+
+	ambulances, err := ambulanceDB.FindDocuments(ctx, db_service.NewQuery(db_service.In("id", ambulanceIds)))
+	if err != nil {
+		return nil, err
+	}
+	return joinReservations(reservationInputs, patients, ambulances)
+}
+
+// joinReservations fills the patients and ambulances into the reservations
+func joinReservations(reservationInputs []ReservationInput, patients []Patient, ambulances []Ambulance) ([]Reservation, error) {
+	reservations := make([]Reservation, len(reservationInputs))
+	patientsById := make(map[string]Patient, len(patients))
+	for _, patient := range patients {
+		patientsById[patient.Id] = patient
+	}
+	ambulancesById := make(map[string]Ambulance, len(ambulances))
+	for _, ambulance := range ambulances {
+		ambulancesById[ambulance.Id] = ambulance
+	}
+
+	for i, input := range reservationInputs {
+		patient, ok := patientsById[input.PatientId]
+		if !ok {
+			return nil, fmt.Errorf("patient %v of reservation %v: %w", input.PatientId, input.Id, db_service.ErrNotFound)
+		}
+		ambulance, ok := ambulancesById[input.AmbulanceId]
+		if !ok {
+			return nil, fmt.Errorf("ambulance %v of reservation %v: %w", input.AmbulanceId, input.Id, db_service.ErrNotFound)
+		}
+
+		// times are returned in the time zone of the ambulance
+		location := ambulance.location()
+		reservations[i] = Reservation{
+			Id:              input.Id,
+			Patient:         patient,
+			Ambulance:       ambulance,
+			Start:           input.Start.In(location),
+			End:             input.End.In(location),
+			ExaminationType: input.ExaminationType,
+			Message:         input.Message,
+			Status:          input.Status,
+			Sequence:        input.Sequence,
+			UpdatedAt:       input.UpdatedAt,
+			SeriesId:        input.SeriesId,
+			RecurrenceId:    input.RecurrenceId,
+			ResourceId:      input.ResourceId,
+			StaffId:         input.StaffId,
+		}
+		if !input.RecurrenceId.IsZero() {
+			reservations[i].RecurrenceId = input.RecurrenceId.In(location)
+		}
+	}
+	return reservations, nil
+}
+
+// deletedReservations expands the reservations deleted together with their
+// patient or ambulance, call it in the transaction deleting them. The deleted
+// documents are passed in by the caller and the other side is loaded from the
+// database. Orphaned reservations referencing missing documents are skipped.
+func deletedReservations(
+	ctx context.Context,
+	patientDB db_service.DbService[Patient],
+	ambulanceDB db_service.DbService[Ambulance],
+	reservationInputs []ReservationInput,
+	patients []Patient,
+	ambulances []Ambulance,
+) ([]Reservation, error) {
+	if len(reservationInputs) == 0 {
+		return nil, nil
+	}
+
+	var err error
+	if patients == nil {
+		patientIds := make([]string, 0, len(reservationInputs))
+		for _, reservationInput := range reservationInputs {
+			patientIds = append(patientIds, reservationInput.PatientId)
+		}
+		if patients, err = patientDB.FindDocuments(ctx, db_service.NewQuery(db_service.In("id", patientIds))); err != nil {
+			return nil, err
+		}
+	}
+	if ambulances == nil {
+		ambulanceIds := make([]string, 0, len(reservationInputs))
+		for _, reservationInput := range reservationInputs {
+			ambulanceIds = append(ambulanceIds, reservationInput.AmbulanceId)
+		}
+		if ambulances, err = ambulanceDB.FindDocuments(ctx, db_service.NewQuery(db_service.In("id", ambulanceIds))); err != nil {
+			return nil, err
+		}
+	}
+
+	patientIds := make(map[string]bool, len(patients))
+	for _, patient := range patients {
+		patientIds[patient.Id] = true
+	}
+	ambulanceIds := make(map[string]bool, len(ambulances))
+	for _, ambulance := range ambulances {
+		ambulanceIds[ambulance.Id] = true
+	}
+	complete := make([]ReservationInput, 0, len(reservationInputs))
+	for _, reservationInput := range reservationInputs {
+		if !patientIds[reservationInput.PatientId] || !ambulanceIds[reservationInput.AmbulanceId] {
+			log.Printf("Skipping orphaned reservation %v", reservationInput.Id)
+			continue
+		}
+		complete = append(complete, reservationInput)
+	}
+	return joinReservations(complete, patients, ambulances)
+}
+
 // Validate checks if the Reservation struct is valid
 func (reservation *Reservation) Validate() error {
 	currentTime := time.Now()
@@ -37,6 +288,14 @@ func (reservation *Reservation) Validate() error {
 		return fmt.Errorf("Invalid examination type")
 	}
 
+	if !slices.Contains(reservation.Ambulance.MedicalExaminations, reservation.ExaminationType) {
+		return fmt.Errorf("The ambulance does not offer the examination %v", reservation.ExaminationType)
+	}
+
+	if err := reservation.Ambulance.validateSlot(reservation.ExaminationType, reservation.Start, reservation.End); err != nil {
+		return err
+	}
+
 	if len(reservation.Message) > 200 {
 		return fmt.Errorf("Message exceeds maximum length of 200 characters")
 	}
@@ -51,7 +310,11 @@ type reservationUpdater = func(
 
 func updateReservationFunc(ctx *gin.Context, updater reservationUpdater) {
     value, exists := ctx.Get("db_service_reservation")
-    if !exists {
+    ambulanceValue, ambulanceExists := ctx.Get("db_service_ambulance")
+    staffValue, staffExists := ctx.Get("db_service_staff")
+    waitlistValue, waitlistExists := ctx.Get("db_service_waitlist")
+    transactorValue, transactorExists := ctx.Get("db_transactor")
+    if !exists || !ambulanceExists || !staffExists || !waitlistExists || !transactorExists {
         ctx.JSON(
             http.StatusInternalServerError,
             gin.H{
@@ -63,7 +326,11 @@ func updateReservationFunc(ctx *gin.Context, updater reservationUpdater) {
     }
 
     db, ok := value.(db_service.DbService[ReservationInput])
-    if !ok {
+    ambulanceDB, ambulanceOK := ambulanceValue.(db_service.DbService[Ambulance])
+    staffDB, staffOK := staffValue.(db_service.DbService[Staff])
+    waitlistDB, waitlistOK := waitlistValue.(db_service.DbService[WaitlistEntry])
+    transactor, transactorOK := transactorValue.(db_service.Transactor)
+    if !ok || !ambulanceOK || !staffOK || !waitlistOK || !transactorOK {
         ctx.JSON(
             http.StatusInternalServerError,
             gin.H{
@@ -102,27 +369,74 @@ func updateReservationFunc(ctx *gin.Context, updater reservationUpdater) {
         return
     }
 
-    if !ok {
-        ctx.JSON(
-            http.StatusInternalServerError,
-            gin.H{
-                "status":  "Internal Server Error",
-                "message": "Failed to cast reservation from database",
-                "error":   "Failed to cast reservation from database",
-            })
-        return
-    }
+    originalStart, originalEnd, originalStatus := reservation.Start, reservation.End, reservation.Status
 
     updatedReservation, responseObject, status := updater(ctx, reservation)
 
+    rescheduled, cancelled := false, false
     if updatedReservation != nil {
-        err = db.UpdateDocument(ctx, reservationId, updatedReservation)
+        rescheduled = !updatedReservation.Start.Equal(originalStart) || !updatedReservation.End.Equal(originalEnd)
+        cancelled = originalStatus != CANCELLED && updatedReservation.Status == CANCELLED
+        // calendar clients apply only changes with higher sequence
+        updatedReservation.Sequence++
+        updatedReservation.UpdatedAt = time.Now().UTC()
+        if reservation, ok := responseObject.(Reservation); ok {
+            reservation.Sequence = updatedReservation.Sequence
+            reservation.UpdatedAt = updatedReservation.UpdatedAt
+            responseObject = reservation
+        }
+        outbox := hl7Outbox(ctx)
+        err = transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+            if rescheduled {
+                // lock the ambulance so the overlap check and update are atomic
+                if err := ambulanceDB.LockDocument(txCtx, updatedReservation.AmbulanceId); err != nil {
+                    return err
+                }
+                ambulance, err := ambulanceDB.FindDocument(txCtx, updatedReservation.AmbulanceId)
+                if err != nil {
+                    return err
+                }
+                if err := checkReservationOverlap(txCtx, db, staffDB, waitlistDB, ambulance, updatedReservation); err != nil {
+                    return err
+                }
+                if err := lockReservationStaff(txCtx, staffDB, updatedReservation); err != nil {
+                    return err
+                }
+            }
+            if err := db.UpdateDocument(txCtx, reservationId, updatedReservation); err != nil {
+                return err
+            }
+            trigger := ""
+            if cancelled {
+                trigger = hl7.TriggerCancelled
+            } else if rescheduled {
+                trigger = hl7.TriggerRescheduled
+            }
+            if reservation, ok := responseObject.(Reservation); ok && trigger != "" {
+                return outbox.Export(txCtx, trigger, reservation)
+            }
+            return nil
+        })
     } else {
         err = nil // redundant but for clarity
     }
 
     switch err {
     case nil:
+        if reservation, ok := responseObject.(Reservation); ok && updatedReservation != nil {
+            event := EventReservationUpdated
+            if cancelled {
+                event = EventReservationCancelled
+            }
+            notifyReservation(ctx, event, reservation)
+            publishWebhook(ctx, RESERVATION_UPDATED, reservation)
+        }
+        if rescheduled || cancelled {
+            // the original time slot is free now
+            freedSlot := *updatedReservation
+            freedSlot.Start, freedSlot.End, freedSlot.Status = originalStart, originalEnd, originalStatus
+            offerFreedSlot(ctx, freedSlot)
+        }
         if responseObject != nil {
             ctx.JSON(status, responseObject)
         } else {
@@ -137,6 +451,24 @@ func updateReservationFunc(ctx *gin.Context, updater reservationUpdater) {
                 "error":   err.Error(),
             },
         )
+    case errReservationOverlap:
+        ctx.JSON(
+            http.StatusConflict,
+            gin.H{
+                "status":  "Conflict",
+                "message": "The time slot is already reserved",
+                "error":   err.Error(),
+            },
+        )
+    case errNoStaffAvailable:
+        ctx.JSON(
+            http.StatusConflict,
+            gin.H{
+                "status":  "Conflict",
+                "message": "No staff member is available in the time slot",
+                "error":   err.Error(),
+            },
+        )
     default:
         ctx.JSON(
             http.StatusBadGateway,
@@ -147,4 +479,4 @@ func updateReservationFunc(ctx *gin.Context, updater reservationUpdater) {
             })
     }
 
-}
\ No newline at end of file
+}
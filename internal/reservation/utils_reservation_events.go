@@ -0,0 +1,157 @@
+package reservation
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+)
+
+// reservationEventsPollInterval is the period of polling on servers without
+// change streams
+const reservationEventsPollInterval = 5 * time.Second
+
+// reservationEventsHeartbeat keeps idle event streams open through proxies
+const reservationEventsHeartbeat = 25 * time.Second
+
+// reservationDeletedData is the data of the reservation.deleted live event
+type reservationDeletedData struct {
+	Id string `json:"id"`
+}
+
+// watchAmbulanceReservations passes changes of the ambulance reservations to
+// the handler until the context is cancelled. Changes come from the change
+// stream of the collection, so changes made by any replica of the service are
+// observed. Standalone servers do not support change streams and servers
+// without pre-images cannot match deletions, the reservations are polled
+// instead.
+func watchAmbulanceReservations(
+	ctx context.Context,
+	db db_service.DbService[ReservationInput],
+	ambulanceId string,
+	handler func(change db_service.ChangeEvent[ReservationInput]) error,
+) error {
+	err := db.Watch(ctx, db_service.Eq("ambulanceid", ambulanceId), handler)
+	if err != db_service.ErrWatchNotSupported {
+		return err
+	}
+	return pollAmbulanceReservations(ctx, db, ambulanceId, reservationEventsPollInterval, handler)
+}
+
+// pollAmbulanceReservations emulates the change stream by comparing
+// snapshots of the ambulance reservations taken every interval
+func pollAmbulanceReservations(
+	ctx context.Context,
+	db db_service.DbService[ReservationInput],
+	ambulanceId string,
+	interval time.Duration,
+	handler func(change db_service.ChangeEvent[ReservationInput]) error,
+) error {
+	snapshot := func() (map[string]ReservationInput, error) {
+		reservations, err := db.GetDocumentsByField(ctx, "ambulanceid", ambulanceId)
+		if err != nil {
+			return nil, err
+		}
+		byId := make(map[string]ReservationInput, len(reservations))
+		for _, reservation := range reservations {
+			byId[reservation.Id] = reservation
+		}
+		return byId, nil
+	}
+
+	previous, err := snapshot()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current, err := snapshot()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			// the next poll compares with the last successful snapshot
+			log.Printf("Failed to poll reservations of ambulance %v: %v", ambulanceId, err)
+			continue
+		}
+
+		for id := range current {
+			reservation := current[id]
+			before, exists := previous[id]
+			change := db_service.ChangeEvent[ReservationInput]{Operation: db_service.ChangeInsert, Document: &reservation}
+			if exists {
+				if reflect.DeepEqual(before, reservation) {
+					continue
+				}
+				change.Operation = db_service.ChangeUpdate
+				change.Previous = &before
+			}
+			if err := handler(change); err != nil {
+				return err
+			}
+		}
+		for id := range previous {
+			if _, exists := current[id]; !exists {
+				reservation := previous[id]
+				if err := handler(db_service.ChangeEvent[ReservationInput]{Operation: db_service.ChangeDelete, Previous: &reservation}); err != nil {
+					return err
+				}
+			}
+		}
+		previous = current
+	}
+}
+
+// reservationLiveEvent returns the name and data of the server-sent event
+// of the change, ok is false when the change is not published
+func reservationLiveEvent(
+	ctx context.Context,
+	patientDB db_service.DbService[Patient],
+	ambulanceDB db_service.DbService[Ambulance],
+	ambulanceId string,
+	change db_service.ChangeEvent[ReservationInput],
+) (name string, data interface{}, ok bool) {
+	deleted := func() (string, interface{}, bool) {
+		if change.Previous == nil {
+			return "", nil, false
+		}
+		return EventReservationDeleted, reservationDeletedData{Id: change.Previous.Id}, true
+	}
+
+	switch change.Operation {
+	case db_service.ChangeInsert:
+		name = EventReservationCreated
+	case db_service.ChangeUpdate, db_service.ChangeReplace:
+		name = EventReservationUpdated
+	case db_service.ChangeDelete:
+		return deleted()
+	default:
+		return "", nil, false
+	}
+
+	if change.Document == nil {
+		// deleted before the change was looked up, the deletion follows
+		return "", nil, false
+	}
+	if change.Document.AmbulanceId != ambulanceId {
+		// moved to another ambulance
+		return deleted()
+	}
+
+	reservations, err := expandReservations(ctx, patientDB, ambulanceDB, []ReservationInput{*change.Document})
+	if err != nil {
+		log.Printf("Cannot stream %v of reservation %v: %v", name, change.Document.Id, err)
+		return "", nil, false
+	}
+	return name, reservations[0], true
+}
@@ -0,0 +1,266 @@
+package reservation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/hl7"
+)
+
+// maxSeriesOccurrences limits the number of occurrences of one series
+const maxSeriesOccurrences = 100
+
+// seriesServices are the services used by the reservation series handlers
+type seriesServices struct {
+	seriesDB      db_service.DbService[ReservationSeries]
+	reservationDB db_service.DbService[ReservationInput]
+	patientDB     db_service.DbService[Patient]
+	ambulanceDB   db_service.DbService[Ambulance]
+	staffDB       db_service.DbService[Staff]
+	waitlistDB    db_service.DbService[WaitlistEntry]
+	transactor    db_service.Transactor
+}
+
+func reservationSeriesServices(ctx *gin.Context) (*seriesServices, bool) {
+	reservationDB, patientDB, ambulanceDB, ok := reservationServices(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	seriesValue, seriesExists := ctx.Get("db_service_reservation_series")
+	staffValue, staffExists := ctx.Get("db_service_staff")
+	waitlistValue, waitlistExists := ctx.Get("db_service_waitlist")
+	transactorValue, transactorExists := ctx.Get("db_transactor")
+	if !seriesExists || !staffExists || !waitlistExists || !transactorExists {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service not found",
+				"error":   "db_service not found",
+			})
+		return nil, false
+	}
+
+	seriesDB, seriesOK := seriesValue.(db_service.DbService[ReservationSeries])
+	staffDB, staffOK := staffValue.(db_service.DbService[Staff])
+	waitlistDB, waitlistOK := waitlistValue.(db_service.DbService[WaitlistEntry])
+	transactor, transactorOK := transactorValue.(db_service.Transactor)
+	if !seriesOK || !staffOK || !waitlistOK || !transactorOK {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service context is not of type db_service.DbService",
+				"error":   "cannot cast db_service context to db_service.DbService",
+			})
+		return nil, false
+	}
+
+	return &seriesServices{
+		seriesDB:      seriesDB,
+		reservationDB: reservationDB,
+		patientDB:     patientDB,
+		ambulanceDB:   ambulanceDB,
+		staffDB:       staffDB,
+		waitlistDB:    waitlistDB,
+		transactor:    transactor,
+	}, true
+}
+
+// Validate checks the recurrence rule of the series starting at start
+func (this *Recurrence) Validate(start time.Time) error {
+	switch this.Frequency {
+	case DAILY, WEEKLY, MONTHLY:
+	default:
+		return fmt.Errorf("Invalid frequency %q", this.Frequency)
+	}
+
+	if this.Interval < 0 {
+		return fmt.Errorf("Interval must be positive")
+	}
+
+	if (this.Count > 0) == !this.Until.IsZero() {
+		return fmt.Errorf("Exactly one of count and until is required")
+	}
+	if this.Count < 0 || this.Count > maxSeriesOccurrences {
+		return fmt.Errorf("Count must be between 1 and %v", maxSeriesOccurrences)
+	}
+	if !this.Until.IsZero() && this.Until.Before(start) {
+		return fmt.Errorf("until must not be before start")
+	}
+
+	if len(this.occurrences(start)) > maxSeriesOccurrences {
+		return fmt.Errorf("Series exceeds maximum of %v occurrences", maxSeriesOccurrences)
+	}
+	return nil
+}
+
+// occurrences returns starts of the occurrences of the series starting at
+// start, up to one more than maxSeriesOccurrences. Occurrences keep the
+// wall-clock time of start in its location.
+func (this *Recurrence) occurrences(start time.Time) []time.Time {
+	interval := max(int(this.Interval), 1)
+	starts := []time.Time{}
+	for i := 0; len(starts) <= maxSeriesOccurrences; i++ {
+		var next time.Time
+		switch this.Frequency {
+		case DAILY:
+			next = start.AddDate(0, 0, i*interval)
+		case WEEKLY:
+			next = start.AddDate(0, 0, 7*i*interval)
+		case MONTHLY:
+			next = start.AddDate(0, i*interval, 0)
+		default:
+			return starts
+		}
+
+		if !this.Until.IsZero() && next.After(this.Until) {
+			break
+		}
+		// as in RRULE, months without the day are skipped, e.g. the 31st
+		if this.Frequency == MONTHLY && next.Day() != start.Day() {
+			continue
+		}
+		starts = append(starts, next)
+		if this.Count > 0 && len(starts) >= int(this.Count) {
+			break
+		}
+	}
+	return starts
+}
+
+// Validate checks the reservation series, the occurrences are validated
+// when booked
+func (this *ReservationSeriesInput) Validate() error {
+	if this.AmbulanceId == "" {
+		return fmt.Errorf("ambulanceId is required")
+	}
+
+	if !this.Start.Before(this.End) {
+		return fmt.Errorf("start time must be before end time")
+	}
+
+	if !this.ExaminationType.IsValid() {
+		return fmt.Errorf("Invalid examination type")
+	}
+
+	if len(this.Message) > 200 {
+		return fmt.Errorf("Message exceeds maximum length of 200 characters")
+	}
+
+	return this.Recurrence.Validate(this.Start)
+}
+
+// bookSeriesOccurrences books the occurrences starting at the starts, every
+// occurrence is checked and booked as a single reservation. It returns the
+// booked reservations and the occurrences that could not be booked.
+func bookSeriesOccurrences(
+	ctx *gin.Context,
+	services *seriesServices,
+	series *ReservationSeries,
+	patient Patient,
+	ambulance Ambulance,
+	starts []time.Time,
+) ([]Reservation, []UnplacedOccurrence) {
+	duration := series.End.Sub(series.Start)
+	booked := []Reservation{}
+	unplaced := []UnplacedOccurrence{}
+	for _, start := range starts {
+		reservation := Reservation{
+			Id:              uuid.New().String(),
+			Patient:         patient,
+			Ambulance:       ambulance,
+			Start:           start,
+			End:             start.Add(duration),
+			ExaminationType: series.ExaminationType,
+			Message:         series.Message,
+			SeriesId:        series.Id,
+			RecurrenceId:    start,
+		}
+
+		err := reservation.Validate()
+		if err == nil {
+			reservationInput := ReservationInput{
+				Id:              reservation.Id,
+				AmbulanceId:     ambulance.Id,
+				PatientId:       patient.Id,
+				Start:           reservation.Start,
+				End:             reservation.End,
+				ExaminationType: reservation.ExaminationType,
+				Message:         reservation.Message,
+				SeriesId:        series.Id,
+				RecurrenceId:    start,
+			}
+			var created *Reservation
+			created, err = createReservation(ctx, services.transactor, services.reservationDB, services.patientDB, services.ambulanceDB, services.staffDB, services.waitlistDB, &reservationInput)
+			if err == nil {
+				reservation = *created
+			}
+		}
+
+		switch err {
+		case nil:
+			booked = append(booked, reservation)
+		case errReservationOverlap:
+			unplaced = append(unplaced, UnplacedOccurrence{Start: reservation.Start, End: reservation.End, Reason: "The time slot is already reserved"})
+		case errNoStaffAvailable:
+			unplaced = append(unplaced, UnplacedOccurrence{Start: reservation.Start, End: reservation.End, Reason: "No staff member is available in the time slot"})
+		default:
+			unplaced = append(unplaced, UnplacedOccurrence{Start: reservation.Start, End: reservation.End, Reason: err.Error()})
+		}
+	}
+	return booked, unplaced
+}
+
+// cancelSeriesOccurrence cancels the occurrence unless it was cancelled
+// meanwhile and releases its time slot, the cancellation is exported in the
+// same transaction
+func cancelSeriesOccurrence(ctx *gin.Context, services *seriesServices, reservationInput ReservationInput) error {
+	freedSlot := reservationInput
+	reservationInput.Status = CANCELLED
+	reservationInput.Sequence++
+	reservationInput.UpdatedAt = time.Now().UTC()
+	outbox := hl7Outbox(ctx)
+	var reservations []Reservation
+	err := services.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		if err := services.reservationDB.UpdateDocumentIf(txCtx, reservationInput.Id, activeReservationFilter(), &reservationInput); err != nil {
+			return err
+		}
+		var err error
+		reservations, err = expandReservations(txCtx, services.patientDB, services.ambulanceDB, []ReservationInput{reservationInput})
+		if err != nil {
+			return err
+		}
+		return outbox.Export(txCtx, hl7.TriggerCancelled, reservations[0])
+	})
+	switch err {
+	case nil:
+	case db_service.ErrNotFound:
+		return nil
+	default:
+		return err
+	}
+
+	notifyReservation(ctx, EventReservationCancelled, reservations[0])
+	publishWebhook(ctx, RESERVATION_UPDATED, reservations[0])
+	offerFreedSlot(ctx, freedSlot)
+	return nil
+}
+
+// futureSeriesOccurrences loads occurrences of the series that start, or were
+// scheduled by the series rule to start, after now
+func futureSeriesOccurrences(ctx context.Context, db db_service.DbService[ReservationInput], seriesId string, now time.Time) ([]ReservationInput, error) {
+	return db.FindDocuments(ctx, db_service.NewQuery(db_service.And(
+		db_service.Eq("seriesid", seriesId),
+		db_service.Or(
+			db_service.Gt("start", now),
+			db_service.Gt("recurrenceid", now),
+		),
+	)).SortBy("start", false))
+}
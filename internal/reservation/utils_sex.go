@@ -2,7 +2,7 @@ package reservation
 
 func (sex Sex) IsValid() bool {
 	switch sex {
-	case FEMALE, MALE:
+	case FEMALE, MALE, OTHER, UNKNOWN:
 		return true
 	default:
 		return false
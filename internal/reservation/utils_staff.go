@@ -0,0 +1,353 @@
+package reservation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/scheduling"
+)
+
+var errNoStaffAvailable = fmt.Errorf("no qualified staff member is available for the reservation")
+
+func staffService(ctx *gin.Context) (db_service.DbService[Staff], bool) {
+	value, exists := ctx.Get("db_service_staff")
+	if !exists {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service not found",
+				"error":   "db_service not found",
+			})
+		return nil, false
+	}
+
+	db, ok := value.(db_service.DbService[Staff])
+	if !ok {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service context is not of type db_service.DbService",
+				"error":   "cannot cast db_service context to db_service.DbService",
+			})
+		return nil, false
+	}
+	return db, true
+}
+
+// IsValid checks if the weekday is one of the enum values
+func (w Weekday) IsValid() bool {
+	switch w {
+	case MONDAY, TUESDAY, WEDNESDAY, THURSDAY, FRIDAY, SATURDAY, SUNDAY:
+		return true
+	}
+	return false
+}
+
+// weekdayOf returns the weekday of t in its location
+func weekdayOf(t time.Time) Weekday {
+	return Weekday(strings.ToLower(t.Weekday().String()))
+}
+
+// clockMinutes returns minutes since midnight of the wall-clock time in the
+// 15:04 format
+func clockMinutes(clock string) (int, error) {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// Validate checks if the Staff struct is valid
+func (s *Staff) Validate() error {
+	if len(s.Name) == 0 || len(s.Name) > 50 {
+		return fmt.Errorf("Invalid name. Name must be at least one character long and max 50 characters long.")
+	}
+
+	switch s.Role {
+	case DOCTOR, TECHNICIAN, NURSE:
+	default:
+		return fmt.Errorf("Invalid role %q", s.Role)
+	}
+
+	if len(s.AmbulanceIds) == 0 {
+		return fmt.Errorf("The staff member is not assigned to any ambulance")
+	}
+	for i, ambulanceId := range s.AmbulanceIds {
+		if ambulanceId == "" || slices.Contains(s.AmbulanceIds[:i], ambulanceId) {
+			return fmt.Errorf("Invalid or duplicate ambulance id %q", ambulanceId)
+		}
+	}
+
+	if len(s.MedicalExaminations) == 0 {
+		return fmt.Errorf("The medical examinations are empty")
+	}
+	if validExams, incorrectExams := ValidateMedicalExaminations(s.MedicalExaminations); !validExams {
+		return fmt.Errorf("Invalid medical examinations: %v", incorrectExams)
+	}
+	if duplicateExams, duplicates := CheckMedicalExaminationDuplicates(s.MedicalExaminations); duplicateExams {
+		return fmt.Errorf("The medical examinations contain duplicate values: %v", duplicates)
+	}
+
+	for _, shift := range s.Shifts {
+		if !slices.Contains(s.AmbulanceIds, shift.AmbulanceId) {
+			return fmt.Errorf("Shift at ambulance %q the staff member is not assigned to", shift.AmbulanceId)
+		}
+		if !shift.Weekday.IsValid() {
+			return fmt.Errorf("Invalid weekday %q", shift.Weekday)
+		}
+		start, err := clockMinutes(shift.Start)
+		if err != nil {
+			return fmt.Errorf("Invalid shift start %q, use the 15:04 format", shift.Start)
+		}
+		end, err := clockMinutes(shift.End)
+		if err != nil {
+			return fmt.Errorf("Invalid shift end %q, use the 15:04 format", shift.End)
+		}
+		if start >= end {
+			return fmt.Errorf("Shift on %v must start before it ends", shift.Weekday)
+		}
+	}
+
+	return nil
+}
+
+// shiftsOn returns the shifts of the staff member at the ambulance on the
+// calendar date of day, shifts are wall-clock times in the location of day
+func (s *Staff) shiftsOn(ambulanceId string, day time.Time) []scheduling.Interval {
+	year, month, date := day.Date()
+	weekday := weekdayOf(day)
+	shifts := []scheduling.Interval{}
+	for _, shift := range s.Shifts {
+		if shift.AmbulanceId != ambulanceId || shift.Weekday != weekday {
+			continue
+		}
+		shiftStart, startErr := clockMinutes(shift.Start)
+		shiftEnd, endErr := clockMinutes(shift.End)
+		if startErr == nil && endErr == nil {
+			shifts = append(shifts, scheduling.Interval{
+				Start: time.Date(year, month, date, 0, shiftStart, 0, 0, day.Location()),
+				End:   time.Date(year, month, date, 0, shiftEnd, 0, 0, day.Location()),
+			})
+		}
+	}
+	return shifts
+}
+
+// shiftsWithin returns the shifts of the staff member at the ambulance on the
+// day of the office hours, cut to the office hours
+func (s *Staff) shiftsWithin(ambulanceId string, hours scheduling.Interval) []scheduling.Interval {
+	shifts := []scheduling.Interval{}
+	for _, shift := range s.shiftsOn(ambulanceId, hours.Start) {
+		if shift.Start.Before(hours.Start) {
+			shift.Start = hours.Start
+		}
+		if shift.End.After(hours.End) {
+			shift.End = hours.End
+		}
+		if shift.Start.Before(shift.End) {
+			shifts = append(shifts, shift)
+		}
+	}
+	return shifts
+}
+
+// worksAt checks if a shift of the staff member at the ambulance covers the
+// reserved time within the office hours
+func (s *Staff) worksAt(ambulanceId string, hours scheduling.Interval, reserved scheduling.Interval) bool {
+	return slices.ContainsFunc(s.shiftsWithin(ambulanceId, hours), func(shift scheduling.Interval) bool {
+		return shift.Contains(reserved)
+	})
+}
+
+// qualifiedStaff loads the staff of the ambulance qualified for the
+// examination. It also reports if the ambulance has any staff, reservations
+// at ambulances without staff are not assigned to anyone.
+func qualifiedStaff(
+	ctx context.Context,
+	staffDB db_service.DbService[Staff],
+	ambulanceId string,
+	examinationType MedicalExaminations,
+) ([]Staff, bool, error) {
+	staff, err := staffDB.FindDocuments(ctx, db_service.NewQuery(db_service.Eq("ambulanceids", ambulanceId)).SortBy("id", false))
+	if err != nil || len(staff) == 0 {
+		return nil, false, err
+	}
+
+	qualified := make([]Staff, 0, len(staff))
+	for _, member := range staff {
+		if slices.Contains(member.MedicalExaminations, examinationType) {
+			qualified = append(qualified, member)
+		}
+	}
+	return qualified, true, nil
+}
+
+// assignReservationStaff assigns the reservation to a qualified staff member
+// working at the ambulance during the reservation within its office hours
+// and having no other reservation or pending waitlist offer, at any
+// ambulance, at that time. Shifts are wall-clock times in the time zone of
+// the ambulance. Rescheduled reservations keep their staff member when
+// possible. It returns errNoStaffAvailable when no such staff member exists.
+func assignReservationStaff(
+	ctx context.Context,
+	staffDB db_service.DbService[Staff],
+	db db_service.DbService[ReservationInput],
+	waitlistDB db_service.DbService[WaitlistEntry],
+	ambulance *Ambulance,
+	reservationInput *ReservationInput,
+) error {
+	staff, staffed, err := qualifiedStaff(ctx, staffDB, reservationInput.AmbulanceId, reservationInput.ExaminationType)
+	if err != nil {
+		return err
+	}
+	if !staffed {
+		reservationInput.StaffId = ""
+		return nil
+	}
+
+	hours, err := ambulance.officeHoursOn(reservationInput.Start.In(ambulance.location()))
+	if err != nil {
+		return err
+	}
+	reserved := scheduling.Interval{Start: reservationInput.Start, End: reservationInput.End}
+	candidates := make([]string, 0, len(staff))
+	for i := range staff {
+		if staff[i].worksAt(reservationInput.AmbulanceId, hours, reserved) {
+			candidates = append(candidates, staff[i].Id)
+		}
+	}
+	if len(candidates) == 0 {
+		return errNoStaffAvailable
+	}
+
+	busy, err := db.FindDocuments(ctx, db_service.NewQuery(db_service.And(
+		db_service.In("staffid", candidates),
+		db_service.Ne("id", reservationInput.Id),
+		db_service.Lt("start", reservationInput.End),
+		db_service.Gt("end", reservationInput.Start),
+		activeReservationFilter(),
+	)).Project("staffid"))
+	if err != nil {
+		return err
+	}
+	held, err := offerHolds(ctx, waitlistDB, db_service.And(
+		db_service.In("offer.staffid", candidates),
+		db_service.Lt("offer.start", reservationInput.End),
+		db_service.Gt("offer.end", reservationInput.Start),
+	), reservationInput.Id)
+	if err != nil {
+		return err
+	}
+	taken := make(map[string]bool, len(busy)+len(held))
+	for _, other := range append(busy, held...) {
+		taken[other.StaffId] = true
+	}
+
+	if slices.Contains(candidates, reservationInput.StaffId) && !taken[reservationInput.StaffId] {
+		return nil
+	}
+	for _, staffId := range candidates {
+		if !taken[staffId] {
+			reservationInput.StaffId = staffId
+			return nil
+		}
+	}
+	return errNoStaffAvailable
+}
+
+// unassignAmbulanceStaff removes the ambulance and its shifts from the staff
+// members working at it
+func unassignAmbulanceStaff(ctx context.Context, staffDB db_service.DbService[Staff], ambulanceId string) error {
+	staff, err := staffDB.FindDocuments(ctx, db_service.NewQuery(db_service.Eq("ambulanceids", ambulanceId)))
+	if err != nil {
+		return err
+	}
+	for i := range staff {
+		member := &staff[i]
+		member.AmbulanceIds = slices.DeleteFunc(member.AmbulanceIds, func(id string) bool { return id == ambulanceId })
+		member.Shifts = slices.DeleteFunc(member.Shifts, func(shift StaffShift) bool { return shift.AmbulanceId == ambulanceId })
+		if err := staffDB.UpdateDocument(ctx, member.Id, member); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockReservationStaff locks the staff member assigned to the reservation, so
+// concurrent bookings at other ambulances cannot assign the same time of the
+// staff member
+func lockReservationStaff(ctx context.Context, staffDB db_service.DbService[Staff], reservationInput *ReservationInput) error {
+	if reservationInput.StaffId == "" {
+		return nil
+	}
+	return staffDB.LockDocument(ctx, reservationInput.StaffId)
+}
+
+// staffTimelines returns the timelines of every staff member qualified for
+// the examination during the office hours, shifts are taken in the location
+// of hours and cut to them, pending waitlist offers keep the staff member
+// busy. Ambulances without staff get one timeline available during the
+// office hours.
+func staffTimelines(
+	ctx context.Context,
+	staffDB db_service.DbService[Staff],
+	reservationDB db_service.DbService[ReservationInput],
+	waitlistDB db_service.DbService[WaitlistEntry],
+	ambulanceId string,
+	examinationType MedicalExaminations,
+	hours scheduling.Interval,
+) ([]scheduling.Timeline, error) {
+	staff, staffed, err := qualifiedStaff(ctx, staffDB, ambulanceId, examinationType)
+	if err != nil {
+		return nil, err
+	}
+	if !staffed {
+		return []scheduling.Timeline{{Available: []scheduling.Interval{hours}}}, nil
+	}
+	if len(staff) == 0 {
+		return []scheduling.Timeline{}, nil
+	}
+
+	staffIds := make([]string, len(staff))
+	for i := range staff {
+		staffIds[i] = staff[i].Id
+	}
+	reservationInputs, err := reservationDB.FindDocuments(ctx, db_service.NewQuery(db_service.And(
+		db_service.In("staffid", staffIds),
+		db_service.Lt("start", hours.End),
+		db_service.Gt("end", hours.Start),
+		activeReservationFilter(),
+	)).Project("staffid", "start", "end"))
+	if err != nil {
+		return nil, err
+	}
+	held, err := offerHolds(ctx, waitlistDB, db_service.And(
+		db_service.In("offer.staffid", staffIds),
+		db_service.Lt("offer.start", hours.End),
+		db_service.Gt("offer.end", hours.Start),
+	), "")
+	if err != nil {
+		return nil, err
+	}
+	reservationInputs = append(reservationInputs, held...)
+
+	timelines := make([]scheduling.Timeline, len(staff))
+	for i := range staff {
+		timelines[i].Available = staff[i].shiftsWithin(ambulanceId, hours)
+		for _, reservationInput := range reservationInputs {
+			if reservationInput.StaffId == staff[i].Id {
+				timelines[i].Busy = append(timelines[i].Busy, scheduling.Interval{Start: reservationInput.Start, End: reservationInput.End})
+			}
+		}
+	}
+	return timelines, nil
+}
@@ -0,0 +1,442 @@
+package reservation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/hl7"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/notification"
+)
+
+var errNoWaitlistOffer = fmt.Errorf("waitlist entry has no pending offer")
+var errWaitlistOfferExpired = fmt.Errorf("waitlist offer has expired")
+
+// WaitlistService offers time slots freed by deleted, cancelled or rescheduled
+// reservations to the patients on the waitlist
+type WaitlistService struct {
+	WaitlistDB    db_service.DbService[WaitlistEntry]
+	ReservationDB db_service.DbService[ReservationInput]
+	PatientDB     db_service.DbService[Patient]
+	AmbulanceDB   db_service.DbService[Ambulance]
+	StaffDB       db_service.DbService[Staff]
+	Transactor    db_service.Transactor
+	// Notifier informs patients about offers and bookings, optional
+	Notifier notification.Notifier
+	// Outbox exports the bookings to the radiology information system, optional
+	Outbox *Hl7Outbox
+	// Webhooks publish the bookings to partner systems, optional
+	Webhooks *WebhookDispatcher
+	// OfferTTL is the time the patient has to claim the offered slot
+	OfferTTL time.Duration
+}
+
+// waitlistOfferNotification is the data of the waitlist.offered templates
+type waitlistOfferNotification struct {
+	Reservation
+	EntryId   string
+	ExpiresAt time.Time
+}
+
+func waitlistService(ctx *gin.Context) (db_service.DbService[WaitlistEntry], bool) {
+	value, exists := ctx.Get("db_service_waitlist")
+	if !exists {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service not found",
+				"error":   "db_service not found",
+			})
+		return nil, false
+	}
+
+	db, ok := value.(db_service.DbService[WaitlistEntry])
+	if !ok {
+		ctx.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"status":  "Internal Server Error",
+				"message": "db_service context is not of type db_service.DbService",
+				"error":   "cannot cast db_service context to db_service.DbService",
+			})
+		return nil, false
+	}
+	return db, true
+}
+
+// Validate checks if the WaitlistEntryInput struct is valid
+func (input *WaitlistEntryInput) Validate() error {
+	if !input.ExaminationType.IsValid() {
+		return fmt.Errorf("invalid examination type")
+	}
+	if input.From.IsZero() || input.To.IsZero() || !input.From.Before(input.To) {
+		return fmt.Errorf("from must be before to")
+	}
+	if !input.To.After(time.Now()) {
+		return fmt.Errorf("to must be in the future")
+	}
+	return nil
+}
+
+// offerHolds returns the slots held by the pending offers matching the filter
+// as reservations occupying their resource and staff member. The hold of the
+// reservation being booked, excludeId, is skipped.
+func offerHolds(
+	ctx context.Context,
+	waitlistDB db_service.DbService[WaitlistEntry],
+	filter db_service.Filter,
+	excludeId string,
+) ([]ReservationInput, error) {
+	filters := []db_service.Filter{
+		db_service.Eq("status", OFFERED),
+		db_service.Gt("offer.expiresat", time.Now()),
+		filter,
+	}
+	if excludeId != "" {
+		filters = append(filters, db_service.Ne("offer.reservationid", excludeId))
+	}
+	entries, err := waitlistDB.FindDocuments(ctx, db_service.NewQuery(db_service.And(filters...)))
+	if err != nil {
+		return nil, err
+	}
+
+	holds := make([]ReservationInput, 0, len(entries))
+	for _, entry := range entries {
+		holds = append(holds, ReservationInput{
+			Id:              entry.Offer.ReservationId,
+			AmbulanceId:     entry.Offer.AmbulanceId,
+			PatientId:       entry.PatientId,
+			Start:           entry.Offer.Start,
+			End:             entry.Offer.End,
+			ExaminationType: entry.ExaminationType,
+			ResourceId:      entry.Offer.ResourceId,
+			StaffId:         entry.Offer.StaffId,
+		})
+	}
+	return holds, nil
+}
+
+// OfferSlot offers the free slot to the first matching waiting patient, or
+// books it directly when the patient asked for automatic booking
+func (this *WaitlistService) OfferSlot(ctx context.Context, slot ReservationInput) error {
+	now := time.Now()
+	if !slot.Start.After(now) {
+		return nil
+	}
+
+	// another replica may take the same entry, then the next one is tried
+	for attempt := 0; attempt < 5; attempt++ {
+		var entry *WaitlistEntry
+		var reservationInput ReservationInput
+		err := this.Transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+			var err error
+			entry, reservationInput, err = this.takeSlot(txCtx, slot, now)
+			return err
+		})
+		switch err {
+		case nil:
+		case db_service.ErrNotFound:
+			continue
+		case errReservationOverlap, errNoStaffAvailable:
+			// the slot was booked or offered meanwhile
+			return nil
+		default:
+			return err
+		}
+
+		if entry == nil {
+			return nil
+		}
+		if entry.AutoBook {
+			this.announceBooking(ctx, entry, reservationInput)
+		} else {
+			this.announceOffer(ctx, entry, reservationInput)
+		}
+		return nil
+	}
+	return nil
+}
+
+// takeSlot offers the slot to the first matching waiting entry, or books and
+// exports it for the entry asking for automatic booking. Call it in a
+// transaction, the ambulance is locked so concurrent bookings and offers
+// cannot take the slot meanwhile, an offer holds the slot until it is claimed
+// or expires. It returns no entry when the ambulance no longer exists or
+// nobody waits for the slot, and ErrNotFound when the entry was taken by
+// another replica.
+func (this *WaitlistService) takeSlot(txCtx context.Context, slot ReservationInput, now time.Time) (*WaitlistEntry, ReservationInput, error) {
+	switch err := this.AmbulanceDB.LockDocument(txCtx, slot.AmbulanceId); err {
+	case nil:
+	case db_service.ErrNotFound:
+		return nil, ReservationInput{}, nil
+	default:
+		return nil, ReservationInput{}, err
+	}
+	ambulance, err := this.AmbulanceDB.FindDocument(txCtx, slot.AmbulanceId)
+	if err != nil {
+		return nil, ReservationInput{}, err
+	}
+
+	entries, err := this.WaitlistDB.FindDocuments(txCtx, db_service.NewQuery(db_service.And(
+		db_service.Eq("status", WAITING),
+		db_service.Eq("examinationtype", slot.ExaminationType),
+		db_service.Lte("from", slot.Start),
+		db_service.Gte("to", slot.End),
+		db_service.Or(
+			db_service.Eq("ambulanceids", slot.AmbulanceId),
+			db_service.Eq("ambulanceids", nil),
+			db_service.Eq("ambulanceids", []string{}),
+		),
+	)).SortBy("createdat", false).Page(0, 1))
+	if err != nil || len(entries) == 0 {
+		return nil, ReservationInput{}, err
+	}
+	entry := &entries[0]
+
+	reservationInput := ReservationInput{
+		Id:              uuid.New().String(),
+		AmbulanceId:     slot.AmbulanceId,
+		PatientId:       entry.PatientId,
+		Start:           slot.Start,
+		End:             slot.End,
+		ExaminationType: entry.ExaminationType,
+	}
+	if entry.AutoBook {
+		if err := insertReservation(txCtx, this.ReservationDB, this.AmbulanceDB, this.StaffDB, this.WaitlistDB, &reservationInput); err != nil {
+			return nil, ReservationInput{}, err
+		}
+		reservations, err := expandReservations(txCtx, this.PatientDB, this.AmbulanceDB, []ReservationInput{reservationInput})
+		if err != nil {
+			return nil, ReservationInput{}, err
+		}
+		if err := this.Outbox.Export(txCtx, hl7.TriggerNewAppointment, reservations[0]); err != nil {
+			return nil, ReservationInput{}, err
+		}
+		entry.Status = BOOKED
+		entry.ReservationId = reservationInput.Id
+		entry.Offer = WaitlistOffer{AmbulanceId: slot.AmbulanceId, Start: slot.Start, End: slot.End}
+	} else {
+		if err := checkReservationOverlap(txCtx, this.ReservationDB, this.StaffDB, this.WaitlistDB, ambulance, &reservationInput); err != nil {
+			return nil, ReservationInput{}, err
+		}
+		if err := lockReservationStaff(txCtx, this.StaffDB, &reservationInput); err != nil {
+			return nil, ReservationInput{}, err
+		}
+		entry.Status = OFFERED
+		entry.Offer = WaitlistOffer{
+			AmbulanceId:   slot.AmbulanceId,
+			Start:         slot.Start,
+			End:           slot.End,
+			ExpiresAt:     now.Add(this.OfferTTL),
+			ReservationId: reservationInput.Id,
+			ResourceId:    reservationInput.ResourceId,
+			StaffId:       reservationInput.StaffId,
+		}
+	}
+	if err := this.WaitlistDB.UpdateDocumentIf(txCtx, entry.Id, db_service.Eq("status", WAITING), entry); err != nil {
+		return nil, ReservationInput{}, err
+	}
+	return entry, reservationInput, nil
+}
+
+// announceOffer informs the patient about the slot offered to the entry
+func (this *WaitlistService) announceOffer(ctx context.Context, entry *WaitlistEntry, reservationInput ReservationInput) {
+	log.Printf("Offered slot %v of ambulance %v to waitlist entry %v", reservationInput.Start, reservationInput.AmbulanceId, entry.Id)
+	if this.Notifier == nil {
+		return
+	}
+	reservations, err := expandReservations(ctx, this.PatientDB, this.AmbulanceDB, []ReservationInput{reservationInput})
+	if err == nil {
+		err = sendPatientNotification(ctx, this.Notifier, EventWaitlistOffered, reservations[0].Patient, waitlistOfferNotification{
+			Reservation: reservations[0],
+			EntryId:     entry.Id,
+			ExpiresAt:   entry.Offer.ExpiresAt.In(reservations[0].Ambulance.location()),
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to notify about offer of waitlist entry %v: %v", entry.Id, err)
+	}
+}
+
+// announceBooking informs the patient and the partner systems about the slot
+// booked for the entry, the radiology information system got the booking
+// with the transaction
+func (this *WaitlistService) announceBooking(ctx context.Context, entry *WaitlistEntry, reservationInput ReservationInput) {
+	log.Printf("Booked slot %v of ambulance %v for waitlist entry %v", reservationInput.Start, reservationInput.AmbulanceId, entry.Id)
+	reservations, err := expandReservations(ctx, this.PatientDB, this.AmbulanceDB, []ReservationInput{reservationInput})
+	if err != nil {
+		log.Printf("Failed to load booking of waitlist entry %v: %v", entry.Id, err)
+		return
+	}
+	reservation := reservations[0]
+	if this.Notifier != nil {
+		if err := sendReservationNotification(ctx, this.Notifier, EventReservationCreated, reservation); err != nil {
+			log.Printf("Failed to notify about booking of waitlist entry %v: %v", entry.Id, err)
+		}
+	}
+	if this.Webhooks != nil {
+		if err := this.Webhooks.Publish(ctx, RESERVATION_CREATED, reservation); err != nil {
+			log.Printf("Failed to publish booking of waitlist entry %v: %v", entry.Id, err)
+		}
+	}
+}
+
+// Claim books the slot offered to the waitlist entry. The reservation is
+// inserted, the entry marked booked and the booking exported in one
+// transaction. When the slot was taken meanwhile the entry returns to the
+// waitlist.
+func (this *WaitlistService) Claim(ctx context.Context, entryId string) (*Reservation, error) {
+	var reservation Reservation
+	err := this.Transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		entry, err := this.WaitlistDB.FindDocument(txCtx, entryId)
+		if err != nil {
+			return err
+		}
+		if entry.Status != OFFERED {
+			return errNoWaitlistOffer
+		}
+		if time.Now().After(entry.Offer.ExpiresAt) {
+			return errWaitlistOfferExpired
+		}
+
+		reservationInput := ReservationInput{
+			Id:              entry.Offer.ReservationId,
+			AmbulanceId:     entry.Offer.AmbulanceId,
+			PatientId:       entry.PatientId,
+			Start:           entry.Offer.Start,
+			End:             entry.Offer.End,
+			ExaminationType: entry.ExaminationType,
+			ResourceId:      entry.Offer.ResourceId,
+			StaffId:         entry.Offer.StaffId,
+		}
+		if reservationInput.Id == "" {
+			// offers made before the slots were held
+			reservationInput.Id = uuid.New().String()
+		}
+		if err := insertReservation(txCtx, this.ReservationDB, this.AmbulanceDB, this.StaffDB, this.WaitlistDB, &reservationInput); err != nil {
+			return err
+		}
+
+		entry.Status = BOOKED
+		entry.ReservationId = reservationInput.Id
+		switch err := this.WaitlistDB.UpdateDocumentIf(txCtx, entry.Id, db_service.Eq("status", OFFERED), entry); err {
+		case nil:
+		case db_service.ErrNotFound:
+			// the offer expired or was claimed meanwhile
+			return errNoWaitlistOffer
+		default:
+			return err
+		}
+
+		reservations, err := expandReservations(txCtx, this.PatientDB, this.AmbulanceDB, []ReservationInput{reservationInput})
+		if err != nil {
+			return err
+		}
+		reservation = reservations[0]
+		return this.Outbox.Export(txCtx, hl7.TriggerNewAppointment, reservation)
+	})
+	switch err {
+	case nil:
+		return &reservation, nil
+	case errReservationOverlap, errNoStaffAvailable:
+		this.returnToWaitlist(ctx, entryId)
+		return nil, err
+	default:
+		return nil, err
+	}
+}
+
+// returnToWaitlist withdraws the offer of the entry whose slot was taken
+func (this *WaitlistService) returnToWaitlist(ctx context.Context, entryId string) {
+	entry, err := this.WaitlistDB.FindDocument(ctx, entryId)
+	if err == nil && entry.Status == OFFERED {
+		entry.Status = WAITING
+		entry.Offer = WaitlistOffer{}
+		err = this.WaitlistDB.UpdateDocumentIf(ctx, entry.Id, db_service.Eq("status", OFFERED), entry)
+	}
+	if err != nil && err != db_service.ErrNotFound {
+		log.Printf("Failed to return waitlist entry %v to the waitlist: %v", entryId, err)
+	}
+}
+
+// ExpireOffers marks the offers not claimed in time expired and offers
+// their slots to the next patients
+func (this *WaitlistService) ExpireOffers(ctx context.Context, now time.Time) error {
+	entries, err := this.WaitlistDB.FindDocuments(ctx, db_service.NewQuery(db_service.And(
+		db_service.Eq("status", OFFERED),
+		db_service.Lt("offer.expiresat", now),
+	)))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entry.Status = EXPIRED
+		switch err := this.WaitlistDB.UpdateDocumentIf(ctx, entry.Id, db_service.Eq("status", OFFERED), &entry); err {
+		case nil:
+		case db_service.ErrNotFound:
+			continue // claimed meanwhile
+		default:
+			return err
+		}
+
+		err := this.OfferSlot(ctx, ReservationInput{
+			AmbulanceId:     entry.Offer.AmbulanceId,
+			Start:           entry.Offer.Start,
+			End:             entry.Offer.End,
+			ExaminationType: entry.ExaminationType,
+		})
+		if err != nil {
+			log.Printf("Failed to offer slot of expired waitlist entry %v: %v", entry.Id, err)
+		}
+	}
+	return nil
+}
+
+// Run expires the offers every interval until the context is cancelled
+func (this *WaitlistService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := this.ExpireOffers(ctx, time.Now()); err != nil {
+				log.Printf("Failed to expire waitlist offers: %v", err)
+			}
+		}
+	}
+}
+
+// offerFreedSlot offers the time slot of the reservation to the waitlist in
+// the background. Cancelled reservations do not occupy their slot any more.
+func offerFreedSlot(ctx *gin.Context, reservationInput ReservationInput) {
+	if reservationInput.Status == CANCELLED {
+		return
+	}
+
+	value, exists := ctx.Get("waitlist")
+	if !exists {
+		return
+	}
+	waitlist, ok := value.(*WaitlistService)
+	if !ok {
+		log.Printf("waitlist context is not of type *WaitlistService")
+		return
+	}
+
+	go func() {
+		offerCtx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+		defer cancel()
+		if err := waitlist.OfferSlot(offerCtx, reservationInput); err != nil {
+			log.Printf("Failed to offer slot of reservation %v to the waitlist: %v", reservationInput.Id, err)
+		}
+	}()
+}
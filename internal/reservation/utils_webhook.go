@@ -0,0 +1,307 @@
+package reservation
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wac24-xbublavy-xskriba/xskriba-xbublavy-reservation-webapi/internal/db_service"
+)
+
+// maxWebhookBatch limits the number of deliveries attempted in one run
+const maxWebhookBatch = 100
+
+// WebhookRecord is the stored webhook subscription with its signing secret
+type WebhookRecord struct {
+	Webhook `bson:",inline"`
+
+	Secret string `json:"-"`
+}
+
+// webhookPayload is the JSON body of the delivery
+type webhookPayload struct {
+	Id        string       `json:"id"`
+	Event     WebhookEvent `json:"event"`
+	CreatedAt time.Time    `json:"createdAt"`
+	Data      interface{}  `json:"data"`
+}
+
+// patientDeletedData is the data of the patient.deleted event
+type patientDeletedData struct {
+	PatientId      string   `json:"patientId"`
+	ReservationIds []string `json:"reservationIds"`
+}
+
+// WebhookDispatcher queues the events for the subscribed webhooks and
+// delivers them with retries
+type WebhookDispatcher struct {
+	WebhookDB  db_service.DbService[WebhookRecord]
+	DeliveryDB db_service.DbService[WebhookDelivery]
+	Client     *http.Client
+	// MaxAttempts of delivery before it is moved to dead letter
+	MaxAttempts int32
+	// Backoff is the delay after the first failed attempt, it doubles with
+	// every next attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Publish queues delivery of the event to every webhook subscribed to it
+func (this *WebhookDispatcher) Publish(ctx context.Context, event WebhookEvent, data interface{}) error {
+	webhooks, err := this.WebhookDB.FindDocuments(ctx, db_service.NewQuery(db_service.Eq("events", event)))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, webhook := range webhooks {
+		delivery := WebhookDelivery{
+			Id:            uuid.New().String(),
+			WebhookId:     webhook.Id,
+			Event:         event,
+			Status:        QUEUED,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+		payload, err := json.Marshal(webhookPayload{Id: delivery.Id, Event: event, CreatedAt: now, Data: data})
+		if err != nil {
+			return err
+		}
+		delivery.Payload = string(payload)
+		if err := this.DeliveryDB.CreateDocument(ctx, delivery.Id, &delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeliverDue attempts the queued deliveries whose next attempt is due. A
+// failed delivery does not block the others, it is retried after backoff.
+func (this *WebhookDispatcher) DeliverDue(ctx context.Context) error {
+	now := time.Now().UTC()
+	deliveries, err := this.DeliveryDB.FindDocuments(ctx, db_service.NewQuery(db_service.And(
+		db_service.Eq("status", QUEUED),
+		db_service.Lte("nextattemptat", now),
+	)).SortBy("nextattemptat", false).Page(0, maxWebhookBatch))
+	if err != nil {
+		return err
+	}
+
+	webhooks := map[string]*WebhookRecord{}
+	for _, delivery := range deliveries {
+		// claim the attempt and schedule the retry upfront, so replicas do not
+		// attempt the same delivery concurrently and a crashed attempt is retried
+		attempts := delivery.Attempts
+		delivery.Attempts++
+		delivery.NextAttemptAt = time.Now().UTC().Add(this.backoff(delivery.Attempts))
+		switch err := this.DeliveryDB.UpdateDocumentIf(ctx, delivery.Id, db_service.And(
+			db_service.Eq("status", QUEUED),
+			db_service.Eq("attempts", attempts),
+		), &delivery); err {
+		case nil:
+		case db_service.ErrNotFound:
+			continue
+		default:
+			return err
+		}
+
+		webhook, ok := webhooks[delivery.WebhookId]
+		if !ok {
+			webhook, err = this.WebhookDB.FindDocument(ctx, delivery.WebhookId)
+			if err != nil && err != db_service.ErrNotFound {
+				return err
+			}
+			webhooks[delivery.WebhookId] = webhook
+		}
+
+		var statusCode int
+		var sendErr error
+		if webhook == nil {
+			sendErr = fmt.Errorf("webhook was deleted")
+		} else {
+			statusCode, sendErr = this.send(ctx, webhook, &delivery)
+		}
+
+		delivery.LastStatusCode = int32(statusCode)
+		if sendErr == nil {
+			delivery.Status = DELIVERED
+			delivery.DeliveredAt = time.Now().UTC()
+			delivery.NextAttemptAt = time.Time{}
+			delivery.LastError = ""
+		} else {
+			delivery.LastError = sendErr.Error()
+			if delivery.Attempts >= this.MaxAttempts || webhook == nil {
+				delivery.Status = DEAD_LETTER
+				delivery.NextAttemptAt = time.Time{}
+				log.Printf("Webhook delivery %v moved to dead letter after %v attempts: %v", delivery.Id, delivery.Attempts, sendErr)
+			}
+		}
+		if err := this.DeliveryDB.UpdateDocument(ctx, delivery.Id, &delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run delivers the due deliveries every interval until the context is cancelled
+func (this *WebhookDispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := this.DeliverDue(ctx); err != nil {
+			log.Printf("Failed to deliver webhooks: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// send POSTs the signed payload, any 2xx response acknowledges the delivery
+func (this *WebhookDispatcher) send(ctx context.Context, webhook *WebhookRecord, delivery *WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "reservation-webapi-webhooks")
+	request.Header.Set("X-Webhook-Id", webhook.Id)
+	request.Header.Set("X-Webhook-Delivery", delivery.Id)
+	request.Header.Set("X-Webhook-Event", string(delivery.Event))
+	request.Header.Set("X-Webhook-Timestamp", timestamp)
+	request.Header.Set("X-Webhook-Signature", "sha256="+signWebhookPayload(webhook.Secret, timestamp, delivery.Payload))
+
+	response, err := this.Client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("webhook responded with %v", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// backoff returns the delay before the attempt following the given one
+func (this *WebhookDispatcher) backoff(attempts int32) time.Duration {
+	delay := this.Backoff
+	for i := int32(1); i < attempts && delay < this.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, this.MaxBackoff)
+}
+
+// signWebhookPayload returns hex encoded HMAC-SHA256 of "<timestamp>.<payload>",
+// the timestamp is signed so receivers can reject replayed deliveries
+func signWebhookPayload(secret string, timestamp string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newWebhookSecret generates random signing secret
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Validate checks the webhook subscription
+func (this *WebhookInput) Validate() error {
+	target, err := url.Parse(this.Url)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("Invalid url %q, use absolute http or https URL", this.Url)
+	}
+
+	if len(this.Events) == 0 {
+		return fmt.Errorf("At least one event is required")
+	}
+	for _, event := range this.Events {
+		switch event {
+		case RESERVATION_CREATED, RESERVATION_UPDATED, RESERVATION_DELETED, PATIENT_DELETED:
+		default:
+			return fmt.Errorf("Invalid event %q", event)
+		}
+	}
+
+	if len(this.Description) > 200 {
+		return fmt.Errorf("Description exceeds maximum length of 200 characters")
+	}
+
+	if this.Secret != "" && len(this.Secret) < 16 {
+		return fmt.Errorf("Secret must have at least 16 characters")
+	}
+	return nil
+}
+
+// publishWebhook queues the event for the subscribed webhooks, webhooks are
+// disabled when no dispatcher is set in the context. Failures are logged,
+// the change is already stored.
+func publishWebhook(ctx *gin.Context, event WebhookEvent, data interface{}) {
+	value, exists := ctx.Get("webhooks")
+	if !exists {
+		return
+	}
+	dispatcher, ok := value.(*WebhookDispatcher)
+	if !ok {
+		log.Printf("webhooks context is not of type *WebhookDispatcher")
+		return
+	}
+
+	if err := dispatcher.Publish(ctx, event, data); err != nil {
+		log.Printf("Failed to publish %v webhook: %v", event, err)
+	}
+}
+
+// publishReservationInput loads patient and ambulance of the stored
+// reservation and publishes the event
+func publishReservationInput(ctx *gin.Context, event WebhookEvent, reservationInput ReservationInput) {
+	if _, exists := ctx.Get("webhooks"); !exists {
+		return
+	}
+
+	patientValue, _ := ctx.Get("db_service_patient")
+	ambulanceValue, _ := ctx.Get("db_service_ambulance")
+	patientDB, patientOK := patientValue.(db_service.DbService[Patient])
+	ambulanceDB, ambulanceOK := ambulanceValue.(db_service.DbService[Ambulance])
+	if !patientOK || !ambulanceOK {
+		log.Printf("Cannot publish %v of reservation %v: db_service not found", event, reservationInput.Id)
+		return
+	}
+
+	reservations, err := expandReservations(ctx, patientDB, ambulanceDB, []ReservationInput{reservationInput})
+	if err != nil {
+		log.Printf("Cannot publish %v of reservation %v: %v", event, reservationInput.Id, err)
+		return
+	}
+	publishWebhook(ctx, event, reservations[0])
+}
+
+// publishDeletedReservations publishes reservation.deleted for the
+// reservations deleted together with their ambulance
+func publishDeletedReservations(ctx *gin.Context, reservations []Reservation) {
+	for _, reservation := range reservations {
+		publishWebhook(ctx, RESERVATION_DELETED, reservation)
+	}
+}
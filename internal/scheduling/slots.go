@@ -0,0 +1,107 @@
+// Package scheduling computes the free slots of an examination on one day.
+// Office hours are split into steps of the slot granularity, a slot starts at
+// a step and needs one resource and one staff member free for the whole
+// examination. The computation is pure, the callers load the office hours,
+// shifts and reservations and pass the current time.
+package scheduling
+
+import (
+	"slices"
+	"time"
+)
+
+// Interval is the half-open time range [Start, End)
+type Interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Overlaps checks if the intervals share some time
+func (this Interval) Overlaps(other Interval) bool {
+	return this.Start.Before(other.End) && other.Start.Before(this.End)
+}
+
+// Contains checks if the other interval lies within the interval
+func (this Interval) Contains(other Interval) bool {
+	return !other.Start.Before(this.Start) && !other.End.After(this.End)
+}
+
+// Timeline is a resource or a staff member, both take part in one
+// examination at a time
+type Timeline struct {
+	// Available are the intervals the timeline can be used in, a slot must
+	// lie within one of them, e.g. the office hours or the shifts
+	Available []Interval
+	// Busy are the intervals already taken by reservations
+	Busy []Interval
+}
+
+// Free checks if the whole interval lies within one available interval and
+// overlaps no busy one
+func (this Timeline) Free(interval Interval) bool {
+	return slices.ContainsFunc(this.Available, func(available Interval) bool {
+		return available.Contains(interval)
+	}) && !slices.ContainsFunc(this.Busy, interval.Overlaps)
+}
+
+// Request describes the examination looked for on one day
+type Request struct {
+	// Hours are the office hours of the day, slots start at Hours.Start or
+	// a multiple of Step after it and end by Hours.End
+	Hours    Interval
+	Step     time.Duration
+	Duration time.Duration
+	// Now is the current time, slots starting before it have passed
+	Now time.Time
+	// Resources are the timelines of the resources running the examination
+	Resources []Timeline
+	// Staff are the timelines of the staff members qualified for the
+	// examination, callers without staff pass one timeline available
+	// during the office hours
+	Staff []Timeline
+}
+
+// FreeSlots returns the free slots of the examination ordered by start. For
+// every pair of a resource and a staff member the earliest non-overlapping
+// slots are taken, so consecutive slots of one pair do not overlap, while
+// slots of different pairs may.
+func FreeSlots(request Request) []Interval {
+	open := request.Hours.End.Sub(request.Hours.Start)
+	if request.Step <= 0 || request.Duration <= 0 || open < request.Duration {
+		return []Interval{}
+	}
+
+	// the last slot ends by closing, it may start after the last whole step
+	// when the examination is shorter than a step
+	numSteps := int((open-request.Duration)/request.Step) + 1
+	// a slot occupies whole steps, the next one of the pair starts at the
+	// first step after it ends
+	stepsPerSlot := int((request.Duration + request.Step - 1) / request.Step)
+
+	slotAt := func(step int) Interval {
+		start := request.Hours.Start.Add(request.Step * time.Duration(step))
+		return Interval{Start: start, End: start.Add(request.Duration)}
+	}
+
+	free := make([]bool, numSteps)
+	for _, resource := range request.Resources {
+		for _, staff := range request.Staff {
+			for step := 0; step < numSteps; step++ {
+				slot := slotAt(step)
+				if slot.Start.Before(request.Now) || !resource.Free(slot) || !staff.Free(slot) {
+					continue
+				}
+				free[step] = true
+				step += stepsPerSlot - 1
+			}
+		}
+	}
+
+	slots := []Interval{}
+	for step, isFree := range free {
+		if isFree {
+			slots = append(slots, slotAt(step))
+		}
+	}
+	return slots
+}
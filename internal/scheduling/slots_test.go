@@ -0,0 +1,341 @@
+package scheduling
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+	_ "time/tzdata"
+)
+
+var day = time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+
+// at returns the time of the test day at the wall-clock time
+func at(hour int, minute int) time.Time {
+	return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+}
+
+func interval(start time.Time, end time.Time) Interval {
+	return Interval{Start: start, End: end}
+}
+
+// starts returns the starts of the slots in the 15:04 format
+func starts(slots []Interval) []string {
+	formatted := []string{}
+	for _, slot := range slots {
+		formatted = append(formatted, slot.Start.Format("15:04"))
+	}
+	return formatted
+}
+
+func TestFreeSlots(t *testing.T) {
+	hours := interval(at(8, 0), at(10, 0))
+	open := []Timeline{{Available: []Interval{hours}}}
+
+	tests := []struct {
+		name      string
+		request   Request
+		wantSlots []string
+	}{
+		{
+			name:      "offers the last slot of the day",
+			request:   Request{Hours: hours, Step: 30 * time.Minute, Duration: 30 * time.Minute, Resources: open, Staff: open},
+			wantSlots: []string{"08:00", "08:30", "09:00", "09:30"},
+		},
+		{
+			name:      "skips the slot not fitting before closing",
+			request:   Request{Hours: hours, Step: 15 * time.Minute, Duration: 45 * time.Minute, Resources: open, Staff: open},
+			wantSlots: []string{"08:00", "08:45"},
+		},
+		{
+			name:      "duration not a multiple of the step occupies whole steps",
+			request:   Request{Hours: hours, Step: 30 * time.Minute, Duration: 45 * time.Minute, Resources: open, Staff: open},
+			wantSlots: []string{"08:00", "09:00"},
+		},
+		{
+			name:      "offers the last slot starting after the last whole step",
+			request:   Request{Hours: interval(at(8, 0), at(9, 30)), Step: time.Hour, Duration: 15 * time.Minute, Resources: open, Staff: open},
+			wantSlots: []string{"08:00", "09:00"},
+		},
+		{
+			name: "skips the passed slots",
+			request: Request{
+				Hours: hours, Step: 30 * time.Minute, Duration: 30 * time.Minute, Now: at(8, 40),
+				Resources: open, Staff: open,
+			},
+			wantSlots: []string{"09:00", "09:30"},
+		},
+		{
+			name: "offers the slot starting now",
+			request: Request{
+				Hours: hours, Step: 30 * time.Minute, Duration: 30 * time.Minute, Now: at(9, 30),
+				Resources: open, Staff: open,
+			},
+			wantSlots: []string{"09:30"},
+		},
+		{
+			name: "offers nothing on a passed day",
+			request: Request{
+				Hours: hours, Step: 30 * time.Minute, Duration: 30 * time.Minute, Now: at(23, 0),
+				Resources: open, Staff: open,
+			},
+			wantSlots: []string{},
+		},
+		{
+			name: "reservations outside of the office hours",
+			request: Request{
+				Hours: hours, Step: 30 * time.Minute, Duration: 30 * time.Minute,
+				Resources: []Timeline{{
+					Available: []Interval{hours},
+					Busy: []Interval{
+						interval(at(6, 0), at(8, 30)),
+						interval(at(9, 30), at(12, 0)),
+						interval(at(20, 0), at(21, 0)),
+					},
+				}},
+				Staff: open,
+			},
+			wantSlots: []string{"08:30", "09:00"},
+		},
+		{
+			name: "reservation not aligned to the steps",
+			request: Request{
+				Hours: hours, Step: 30 * time.Minute, Duration: 30 * time.Minute,
+				Resources: []Timeline{{Available: []Interval{hours}, Busy: []Interval{interval(at(8, 50), at(9, 10))}}},
+				Staff:     open,
+			},
+			wantSlots: []string{"08:00", "09:30"},
+		},
+		{
+			name: "second resource frees the time",
+			request: Request{
+				Hours: hours, Step: 30 * time.Minute, Duration: time.Hour,
+				Resources: []Timeline{
+					{Available: []Interval{hours}, Busy: []Interval{interval(at(8, 0), at(9, 0))}},
+					{Available: []Interval{hours}, Busy: []Interval{interval(at(8, 30), at(9, 30))}},
+				},
+				Staff: open,
+			},
+			wantSlots: []string{"09:00"},
+		},
+		{
+			name: "slot lies within one shift",
+			request: Request{
+				Hours: hours, Step: 30 * time.Minute, Duration: time.Hour,
+				Resources: open,
+				Staff: []Timeline{{Available: []Interval{
+					interval(at(8, 0), at(8, 30)),
+					interval(at(8, 30), at(10, 0)),
+				}}},
+			},
+			wantSlots: []string{"08:30"},
+		},
+		{
+			name: "busy staff member",
+			request: Request{
+				Hours: hours, Step: 30 * time.Minute, Duration: 30 * time.Minute,
+				Resources: open,
+				Staff:     []Timeline{{Available: []Interval{hours}, Busy: []Interval{interval(at(8, 0), at(9, 30))}}},
+			},
+			wantSlots: []string{"09:30"},
+		},
+		{
+			name:      "no qualified staff",
+			request:   Request{Hours: hours, Step: 30 * time.Minute, Duration: 30 * time.Minute, Resources: open, Staff: []Timeline{}},
+			wantSlots: []string{},
+		},
+		{
+			name:      "no resource running the examination",
+			request:   Request{Hours: hours, Step: 30 * time.Minute, Duration: 30 * time.Minute, Staff: open},
+			wantSlots: []string{},
+		},
+		{
+			name:      "examination longer than the office hours",
+			request:   Request{Hours: hours, Step: 30 * time.Minute, Duration: 3 * time.Hour, Resources: open, Staff: open},
+			wantSlots: []string{},
+		},
+		{
+			name:      "closed ambulance",
+			request:   Request{Hours: interval(at(10, 0), at(8, 0)), Step: 30 * time.Minute, Duration: 30 * time.Minute, Resources: open, Staff: open},
+			wantSlots: []string{},
+		},
+		{
+			name:      "invalid step",
+			request:   Request{Hours: hours, Duration: 30 * time.Minute, Resources: open, Staff: open},
+			wantSlots: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slots := FreeSlots(test.request)
+			if got := starts(slots); !reflect.DeepEqual(got, test.wantSlots) {
+				t.Errorf("FreeSlots() starts = %v, want %v", got, test.wantSlots)
+			}
+			for _, slot := range slots {
+				if slot.End.Sub(slot.Start) != test.request.Duration {
+					t.Errorf("slot %v lasts %v, want %v", slot.Start, slot.End.Sub(slot.Start), test.request.Duration)
+				}
+			}
+		})
+	}
+}
+
+func TestFreeSlotsDaylightSavingTime(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Bratislava")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		date      time.Time
+		wantSlots int
+	}{
+		// the clocks skip 02:00-03:00, the night is an hour shorter
+		{name: "spring forward", date: time.Date(2024, 3, 31, 0, 0, 0, 0, location), wantSlots: 4},
+		// the clocks repeat 02:00-03:00, the night is an hour longer
+		{name: "fall back", date: time.Date(2024, 10, 27, 0, 0, 0, 0, location), wantSlots: 6},
+		{name: "regular day", date: time.Date(2024, 10, 28, 0, 0, 0, 0, location), wantSlots: 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			year, month, date := test.date.Date()
+			hours := interval(
+				time.Date(year, month, date, 0, 0, 0, 0, location),
+				time.Date(year, month, date, 5, 0, 0, 0, location),
+			)
+			open := []Timeline{{Available: []Interval{hours}}}
+			slots := FreeSlots(Request{Hours: hours, Step: time.Hour, Duration: time.Hour, Resources: open, Staff: open})
+			if len(slots) != test.wantSlots {
+				t.Errorf("FreeSlots() = %v slots, want %v", len(slots), test.wantSlots)
+			}
+			if len(slots) > 0 && !slots[len(slots)-1].End.Equal(hours.End) {
+				t.Errorf("last slot ends at %v, want %v", slots[len(slots)-1].End, hours.End)
+			}
+		})
+	}
+}
+
+// randomRequest generates requests on the test day with random office hours,
+// granularity, current time, resources and staff
+type randomRequest struct {
+	Request
+}
+
+func (randomRequest) Generate(random *rand.Rand, size int) reflect.Value {
+	minutes := func(from int, to int) time.Time {
+		return day.Add(time.Duration(from+random.Intn(to-from+1)) * time.Minute)
+	}
+	randomIntervals := func(count int) []Interval {
+		intervals := make([]Interval, count)
+		for i := range intervals {
+			start := minutes(5*60, 20*60)
+			intervals[i] = interval(start, start.Add(time.Duration(1+random.Intn(180))*time.Minute))
+		}
+		return intervals
+	}
+	randomTimelines := func(hours Interval) []Timeline {
+		timelines := make([]Timeline, random.Intn(4))
+		for i := range timelines {
+			if random.Intn(2) == 0 {
+				timelines[i].Available = []Interval{hours}
+			} else {
+				timelines[i].Available = randomIntervals(random.Intn(3))
+			}
+			timelines[i].Busy = randomIntervals(random.Intn(6))
+		}
+		return timelines
+	}
+
+	steps := []time.Duration{5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 20 * time.Minute, 30 * time.Minute, time.Hour}
+	hours := interval(minutes(6*60, 10*60), minutes(12*60, 18*60))
+	request := Request{
+		Hours:    hours,
+		Step:     steps[random.Intn(len(steps))],
+		Duration: time.Duration(5+random.Intn(120)) * time.Minute,
+		Now:      minutes(0, 24*60),
+	}
+	request.Resources = randomTimelines(hours)
+	request.Staff = randomTimelines(hours)
+	return reflect.ValueOf(randomRequest{request})
+}
+
+// freePair checks if some resource and some staff member are free during
+// the slot
+func freePair(request Request, slot Interval) bool {
+	for _, resource := range request.Resources {
+		for _, staff := range request.Staff {
+			if resource.Free(slot) && staff.Free(slot) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestFreeSlotsAreFree(t *testing.T) {
+	property := func(random randomRequest) bool {
+		request := random.Request
+		previous := time.Time{}
+		for _, slot := range FreeSlots(request) {
+			offset := slot.Start.Sub(request.Hours.Start)
+			switch {
+			case offset < 0 || offset%request.Step != 0:
+				t.Logf("slot %v does not start at a step", slot.Start)
+			case slot.End.Sub(slot.Start) != request.Duration:
+				t.Logf("slot %v lasts %v", slot.Start, slot.End.Sub(slot.Start))
+			case slot.End.After(request.Hours.End):
+				t.Logf("slot %v ends after closing", slot.Start)
+			case slot.Start.Before(request.Now):
+				t.Logf("slot %v has passed at %v", slot.Start, request.Now)
+			case !slot.Start.After(previous):
+				t.Logf("slot %v is not ordered", slot.Start)
+			case !freePair(request, slot):
+				t.Logf("slot %v has no free resource and staff member", slot.Start)
+			default:
+				previous = slot.Start
+				continue
+			}
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFreeSlotsMissNoFreeTime(t *testing.T) {
+	// every free start is offered or lies within an offered slot, so the
+	// free time of the day is never hidden
+	property := func(random randomRequest) bool {
+		request := random.Request
+		slots := FreeSlots(request)
+		for start := request.Hours.Start; ; start = start.Add(request.Step) {
+			candidate := interval(start, start.Add(request.Duration))
+			if candidate.End.After(request.Hours.End) {
+				return true
+			}
+			if candidate.Start.Before(request.Now) || !freePair(request, candidate) {
+				continue
+			}
+			covered := false
+			for _, slot := range slots {
+				if !start.Before(slot.Start) && start.Before(slot.End) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				t.Logf("free start %v is not offered", start)
+				return false
+			}
+		}
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
@@ -12,6 +12,11 @@ export RESERVATION_API_ENVIRONMENT="Development"
 export RESERVATION_API_PORT="8080"
 export RESERVATION_API_MONGODB_USERNAME="root"
 export RESERVATION_API_MONGODB_PASSWORD="neUhaDnes"
+# the development mongo is a standalone server without transactions
+export RESERVATION_API_MONGODB_ALLOW_STANDALONE="true"
+export RESERVATION_API_NOTIFIERS="log,smtp"
+export RESERVATION_API_SMTP_HOST="localhost"
+export RESERVATION_API_SMTP_PORT="1025"
 
 mongo() {
     docker-compose --file "${ProjectRoot}/deployments/docker-compose/compose.yaml" "$@"
@@ -34,6 +39,10 @@ case "$command" in
     "mongo")
         mongo up
         ;;
+    "migrate")
+        mongo up --detach
+        go run "${ProjectRoot}/cmd/reservation-api-service" migrate
+        ;;
     "docker")
         docker build -t annotaid/reservation-webapi:local-build -f ${ProjectRoot}/build/docker/Dockerfile .
         ;;